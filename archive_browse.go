@@ -0,0 +1,359 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// browseArchive decrypts the package once to read its records, then shows the browser.
+// The container and the unlocked key stay in memory, so later extractions need no new key;
+// browseArchive takes over the hold on p, which the browser releases when it is closed.
+func browseArchive(win fyne.Window, logs *widget.RichText, p *qds.Payload, srcPath string) {
+	runJob(fmt.Sprintf(tr("job_read_archive"), archiveJobName(srcPath)), int64(p.Container().PayloadSize()), func(j *job) error {
+		src := p.Open(j.progress)
+		entries, err := qds.ListArchive(j.reader(src))
+		src.Close()
+
+		runOnMain(func() {
+			if err != nil {
+				releasePayload(p)
+				addLog(logs, fmt.Sprintf(tr("decrypt_error"), localizeError(err)))
+				return
+			}
+			ShowArchiveBrowser(win, logs, p, entries, srcPath)
+		})
+		return err
+	})
+}
+
+func archiveJobName(srcPath string) string {
+	if srcPath == "" {
+		return tr("job_pasted")
+	}
+	return path.Base(filepath.ToSlash(srcPath))
+}
+
+func ShowArchiveBrowser(win fyne.Window, logs *widget.RichText, p *qds.Payload, all []qds.Entry, srcPath string) {
+	files := make([]qds.Entry, 0, len(all))
+	for _, e := range all {
+		if !e.Dir {
+			files = append(files, e)
+		}
+	}
+	checked := make([]bool, len(files))
+	selected := -1
+	var dlg *dialog.CustomDialog
+
+	human := humanSize
+	infoLbl := widget.NewLabelWithStyle("", fyne.TextAlignCenter, fyne.TextStyle{Italic: true})
+	updateInfo := func() {
+		n := 0
+		var sum int64
+		for i, on := range checked {
+			if on {
+				n++
+				sum += files[i].Size
+			}
+		}
+		infoLbl.SetText(fmt.Sprintf("%s: %d / %d  •  %s: %s",
+			tr("selected"), n, len(files),
+			tr("size"), human(sum),
+		))
+	}
+
+	newItem := func() fyne.CanvasObject {
+		check := widget.NewCheck("", nil)
+		title := widget.NewLabelWithStyle("file", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+		sub := widget.NewLabelWithStyle("path • size", fyne.TextAlignLeading, fyne.TextStyle{Italic: true})
+		return container.NewBorder(nil, nil, check, nil, container.NewVBox(title, sub))
+	}
+
+	var list *widget.List
+	updateItem := func(i widget.ListItemID, o fyne.CanvasObject) {
+		if i < 0 || i >= len(files) {
+			return
+		}
+		e := files[i]
+		row := o.(*fyne.Container)
+		texts := row.Objects[0].(*fyne.Container)
+		check := row.Objects[1].(*widget.Check)
+
+		dir := path.Dir(e.Name)
+		if dir == "." {
+			dir = "/"
+		}
+		texts.Objects[0].(*widget.Label).SetText(path.Base(e.Name))
+		texts.Objects[1].(*widget.Label).SetText(dir + "  •  " + human(e.Size))
+
+		check.OnChanged = nil
+		check.SetChecked(checked[i])
+		check.OnChanged = func(on bool) {
+			checked[i] = on
+			updateInfo()
+		}
+	}
+
+	list = widget.NewList(
+		func() int { return len(files) },
+		newItem,
+		updateItem,
+	)
+	list.OnSelected = func(id widget.ListItemID) { selected = int(id) }
+
+	setAll := func(on bool) {
+		for i := range checked {
+			checked[i] = on
+		}
+		list.Refresh()
+		updateInfo()
+	}
+	selectAllBtn := widget.NewButtonWithIcon(tr("select_all"), theme.CheckButtonCheckedIcon(), func() { setAll(true) })
+	selectNoneBtn := widget.NewButtonWithIcon(tr("select_none"), theme.CheckButtonIcon(), func() { setAll(false) })
+
+	policySelect := widget.NewSelect(conflictPolicyOptions(), func(s string) {
+		extractPolicy = labelToConflictPolicy(s)
+		saveExtractPrefs()
+	})
+	policySelect.SetSelected(conflictPolicyLabel(extractPolicy))
+	subfolderCheck := widget.NewCheck(fmt.Sprintf(tr("extract_to_subfolder"), archiveFolderName(srcPath)), func(on bool) {
+		extractToSubfolder = on
+		saveExtractPrefs()
+	})
+	subfolderCheck.SetChecked(extractToSubfolder)
+
+	extract := func(want func(*qds.Entry) bool) {
+		folderDlg := dialog.NewFolderOpen(func(lu fyne.ListableURI, err error) {
+			if err != nil || lu == nil {
+				return
+			}
+			dest := lu.Path()
+			if strings.TrimSpace(dest) == "" {
+				return
+			}
+			holdPayload(p)
+			dlg.Hide()
+
+			policy := extractPolicy
+			runJob(fmt.Sprintf(tr("job_extract"), archiveJobName(srcPath)), int64(p.Container().PayloadSize()), func(j *job) error {
+				defer releasePayload(p)
+				if err := j.ctx.Err(); err != nil {
+					return err
+				}
+				opts := qds.UnpackOptions{Policy: policy, Want: want, Ask: askConflict(win, j)}
+				dest := dest
+				if extractToSubfolder {
+					sub, err := makeExtractFolder(dest, srcPath)
+					if err != nil {
+						uiLog(logs, fmt.Sprintf(tr("decrypt_error"), err))
+						return err
+					}
+					dest = sub
+				}
+
+				src := p.Open(j.progress)
+				defer src.Close()
+
+				sum, err := qds.Unpack(j.reader(src), dest, opts)
+				if err != nil {
+					uiLog(logs, fmt.Sprintf(tr("decrypt_error"), localizeError(err)))
+				}
+
+				runOnMain(func() {
+					if sum != nil {
+						showUnpackSummary(win, logs, dest, sum)
+					}
+					if err == nil {
+						addLog(logs, tr("decrypt_saved_ok"))
+					}
+				})
+				return err
+			})
+		}, win)
+		folderDlg.Resize(fyne.NewSize(700, 700))
+		folderDlg.Show()
+	}
+
+	extractAllBtn := widget.NewButtonWithIcon(tr("extract_all"), iconFrom("assets/addfolder.png", theme.FolderOpenIcon()), func() {
+		extract(nil)
+	})
+
+	// checkedFilter returns nil when every file is ticked, so folders are kept as well
+	checkedFilter := func() (func(*qds.Entry) bool, bool) {
+		want := map[string]bool{}
+		for i, on := range checked {
+			if on {
+				want[files[i].Name] = true
+			}
+		}
+		if len(want) == 0 {
+			return nil, false
+		}
+		if len(want) == len(files) {
+			return nil, true
+		}
+		return func(e *qds.Entry) bool { return want[e.Name] }, true
+	}
+
+	extractSelBtn := widget.NewButtonWithIcon(tr("extract_selected"), iconFrom("assets/decrypt.png", theme.DownloadIcon()), func() {
+		want, ok := checkedFilter()
+		if !ok {
+			dialog.ShowInformation(tr("warning"), tr("nothing_selected"), win)
+			return
+		}
+		extract(want)
+	})
+
+	exportBtn := widget.NewButtonWithIcon(tr("export_archive"), theme.UploadIcon(), func() {
+		want, ok := checkedFilter()
+		if !ok {
+			dialog.ShowInformation(tr("warning"), tr("nothing_selected"), win)
+			return
+		}
+		format := widget.NewRadioGroup([]string{exportZip, exportTarGz}, nil)
+		format.Horizontal = true
+		format.SetSelected(exportZip)
+
+		dialog.ShowCustomConfirm(tr("export_archive"), tr("save"), tr("cancel"),
+			container.NewVBox(widget.NewLabel(tr("export_format")), format), func(ok bool) {
+				if !ok {
+					return
+				}
+				f := format.Selected
+				saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+					if err != nil {
+						addLog(logs, fmt.Sprintf(tr("save_error"), err))
+						return
+					}
+					if writer == nil {
+						return
+					}
+					holdPayload(p)
+					dlg.Hide()
+					runJob(fmt.Sprintf(tr("job_export"), writer.URI().Name()), int64(p.Container().PayloadSize()), func(j *job) error {
+						defer releasePayload(p)
+						src := p.Open(j.progress)
+						defer src.Close()
+
+						n, err := exportQpkg(j.reader(src), writer, f, want)
+						if cerr := writer.Close(); err == nil {
+							err = cerr
+						}
+						if err != nil {
+							// the partial archive may hold the unverified data of a damaged entry
+							storage.Delete(writer.URI())
+						}
+						runOnMain(func() {
+							if err != nil {
+								addLog(logs, fmt.Sprintf(tr("decrypt_error"), localizeError(err)))
+								return
+							}
+							addLog(logs, fmt.Sprintf(tr("exported_entries"), n, writer.URI().Name()))
+						})
+						return err
+					})
+				}, win)
+				saveDialog.Resize(fyne.NewSize(700, 700))
+				saveDialog.SetFileName(exportFileName(srcPath, f))
+				saveDialog.Show()
+			}, win)
+	})
+
+	saveAsBtn := widget.NewButtonWithIcon(tr("save_entry_as"), theme.DocumentSaveIcon(), func() {
+		if selected < 0 || selected >= len(files) {
+			dialog.ShowInformation(tr("warning"), tr("select_entry_first"), win)
+			return
+		}
+		e := files[selected]
+
+		saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				addLog(logs, fmt.Sprintf(tr("save_error"), err))
+				return
+			}
+			if writer == nil {
+				return
+			}
+			holdPayload(p)
+			runJob(fmt.Sprintf(tr("job_decrypt"), writer.URI().Name()), int64(p.Container().PayloadSize()), func(j *job) error {
+				defer releasePayload(p)
+				src := p.Open(j.progress)
+				defer src.Close()
+
+				err := qds.ExtractEntry(j.reader(src), e.Name, writer)
+				if cerr := writer.Close(); err == nil {
+					err = cerr
+				}
+				if err != nil {
+					storage.Delete(writer.URI())
+					uiLog(logs, fmt.Sprintf(tr("decrypt_error"), localizeError(err)))
+					return err
+				}
+				uiLog(logs, tr("decrypt_saved_ok"))
+				return nil
+			})
+		}, win)
+		saveDialog.Resize(fyne.NewSize(700, 700))
+		saveDialog.SetFileName(qds.SanitizeFileName(path.Base(e.Name)))
+		saveDialog.Show()
+	})
+
+	listCard := widget.NewCard("", "", container.NewMax(list))
+	listWrap := container.NewGridWrap(fyne.NewSize(680, 320), listCard)
+
+	header := container.NewHBox(layout.NewSpacer(), infoLbl, layout.NewSpacer())
+
+	const BTN_H float32 = 40
+	wrap := func(w float32, o fyne.CanvasObject) fyne.CanvasObject {
+		return container.NewGridWrap(fyne.NewSize(w, BTN_H), o)
+	}
+
+	actionsGrid := container.New(
+		layout.NewGridLayoutWithColumns(6),
+		wrap(160, selectAllBtn),
+		wrap(160, selectNoneBtn),
+		wrap(160, saveAsBtn),
+		wrap(160, exportBtn),
+		wrap(160, extractSelBtn),
+		wrap(160, extractAllBtn),
+	)
+	optionsRow := container.NewHBox(
+		layout.NewSpacer(),
+		widget.NewLabel(tr("if_file_exists")),
+		container.NewGridWrap(fyne.NewSize(200, 36), policySelect),
+		widget.NewLabel("  "),
+		subfolderCheck,
+		layout.NewSpacer(),
+	)
+	footer := container.NewVBox(
+		widget.NewSeparator(),
+		optionsRow,
+		container.NewCenter(actionsGrid),
+	)
+
+	bg := canvas.NewImageFromFile("assets/background.png")
+	bg.FillMode = canvas.ImageFillStretch
+
+	content := container.NewStack(
+		bg,
+		container.NewPadded(container.NewBorder(header, footer, nil, nil, listWrap)),
+	)
+
+	dlg = dialog.NewCustom(tr("archive_contents"), tr("close"), content, win)
+	dlg.SetOnClosed(func() { releasePayload(p) })
+	dlg.Resize(fyne.NewSize(1040, 600))
+
+	setAll(true)
+	dlg.Show()
+}
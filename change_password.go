@@ -1,14 +1,10 @@
 package main
 
 import (
-	"QalqanDS/qalqan"
-	"bytes"
-	"encoding/hex"
+	"QalqanDS/qds"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
-	"unicode"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -19,62 +15,52 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
-/*
-	футер: 16 байт перед финальным IMIT-блоком
+// passwordMaxAgeChoices are the days a password may be used, 0 for no limit.
+var passwordMaxAgeChoices = []int{30, 60, 90, 180, 365, 0}
 
-[0..3]  = 'Q','P','W','D'
-[4]     = версия (1)
-[5]     = flags (bit0 = 1 если пароль уже меняли)
-[6..15] = 0
-*/
-var footerMagic = [4]byte{'Q', 'P', 'W', 'D'}
+// passwordExpiryWarnDays is how long before the password expires the log starts to say so.
+const passwordExpiryWarnDays = 7
 
-func buildFooter(changed bool) [qalqan.BLOCKLEN]byte {
-	var f [qalqan.BLOCKLEN]byte
-	copy(f[0:4], footerMagic[:])
-	f[4] = 1
-	if changed {
-		f[5] = f[5] | 0x01
+func passwordMaxAgeLabel(days int) string {
+	if days == 0 {
+		return tr("password_no_max_age")
 	}
-	return f
+	return fmt.Sprintf(tr("password_n_days"), days)
 }
 
-func parseFooter(data []byte) (hasFooter bool, changed bool) {
-	if len(data) < 2*qalqan.BLOCKLEN {
-		return false, false
-	}
-	off := len(data) - 2*qalqan.BLOCKLEN
-	if off < 0 {
-		return false, false
-	}
-	if data[off+0] == 'Q' && data[off+1] == 'P' && data[off+2] == 'W' && data[off+3] == 'D' {
-		changed = (data[off+5] & 0x01) != 0
-		return true, changed
+// checkPasswordAge tells whether the password of the open key file has to be changed before
+// the keys are used. A key file that doesn't record the time of the last change starts
+// counting from now.
+func checkPasswordAge() (expired bool, err error) {
+	if keyring.PasswordSetAt().IsZero() {
+		if err := keyring.SetPasswordMaxAge(keyring.PasswordMaxAge()); err != nil {
+			return false, err
+		}
 	}
-	return false, false
+	exp := keyring.PasswordExpires()
+	return !exp.IsZero() && !time.Now().Before(exp), nil
 }
 
-func passwordValid(p string) (ok bool, hasLen, hasUpper, hasLower, hasDigit, hasSpec bool) {
-	if len([]rune(p)) >= 10 {
-		hasLen = true
+// checkCurrentPassword verifies the current password before a change from the main window.
+// Wrong ones count as failed sign-ins; once they lead to a lockout or a wipe, lock is true
+// and the session has to be locked.
+func checkCurrentPassword(password string) (lock bool, err error) {
+	keysPath := keyring.Path()
+	if err := checkSignIn(keysPath); err != nil {
+		return false, err
 	}
-	for _, r := range p {
-		switch {
-		case unicode.IsUpper(r):
-			hasUpper = true
-		case unicode.IsLower(r):
-			hasLower = true
-		case unicode.IsDigit(r):
-			hasDigit = true
-		case unicode.IsPunct(r) || unicode.IsSymbol(r):
-			hasSpec = true
-		}
+	if keyring.CheckPassword(password) {
+		return false, signInSucceeded(keyring)
 	}
-	ok = hasLen && hasUpper && hasLower && hasDigit && hasSpec
-	return
+	err = signInFailed(keysPath, keyring)
+	a, _ := qds.ReadAttempts(keysPath)
+	lock = time.Now().Before(a.LockedUntil) || (a.WipeAfter > 0 && a.Failures >= a.WipeAfter)
+	return lock, fmt.Errorf("%s\n%v", tr("current_password_wrong"), err)
 }
 
-func ShowChangePassword(app fyne.App, parent fyne.Window, filePath string, fileData []byte, plainKikey []byte) {
+// ShowChangePassword asks for a new password. From the main window requireCurrent asks for the
+// current one as well; the change forced at sign-in follows the password just entered.
+func ShowChangePassword(app fyne.App, parent fyne.Window, requireCurrent bool) {
 	parent.Hide()
 	win := app.NewWindow(tr("change_password"))
 	win.Resize(fyne.NewSize(560, 460))
@@ -82,13 +68,17 @@ func ShowChangePassword(app fyne.App, parent fyne.Window, filePath string, fileD
 	win.SetFixedSize(true)
 	setWindowIcon(win)
 
+	changePasswordWin = win
 	win.SetOnClosed(func() {
+		changePasswordWin = nil
 		parent.Show()
 	})
 
 	bg := canvas.NewImageFromFile("assets/background.png")
 	bg.FillMode = canvas.ImageFillStretch
 
+	curPass := widget.NewPasswordEntry()
+	curPass.SetPlaceHolder(tr("current_password"))
 	newPass := widget.NewPasswordEntry()
 	newPass.SetPlaceHolder(tr("new_password"))
 	confirm := widget.NewPasswordEntry()
@@ -106,12 +96,18 @@ func ShowChangePassword(app fyne.App, parent fyne.Window, filePath string, fileD
 		return &ruleRow{icon: i, label: l, box: row}
 	}
 
-	lenRow := makeRule(tr("rule_min_length"))
+	lenRow := makeRule(fmt.Sprintf(tr("rule_min_length"), passwordMinLength()))
 	uppRow := makeRule(tr("rule_upper"))
 	lowRow := makeRule(tr("rule_lower"))
 	digRow := makeRule(tr("rule_digit"))
 	specRow := makeRule(tr("rule_special"))
 	matchRow := makeRule(tr("rule_match"))
+	recentRow := makeRule(fmt.Sprintf(tr("rule_not_recent"), qds.PasswordHistory))
+	commonRow := makeRule(tr("rule_not_common"))
+	wordRow := makeRule(tr("rule_no_words"))
+	walkRow := makeRule(tr("rule_no_keyboard"))
+	repeatRow := makeRule(tr("rule_no_repeats"))
+	strengthRow := makeRule("")
 
 	setOK := func(r *ruleRow, ok bool) {
 		if ok {
@@ -121,21 +117,46 @@ func ShowChangePassword(app fyne.App, parent fyne.Window, filePath string, fileD
 		}
 	}
 	updateHints := func() {
-		ok, hasLen, hasUpper, hasLower, hasDigit, hasSpec := passwordValid(newPass.Text)
-		_ = ok
-		setOK(lenRow, hasLen)
-		setOK(uppRow, hasUpper)
-		setOK(lowRow, hasLower)
-		setOK(digRow, hasDigit)
-		setOK(specRow, hasSpec)
+		c := checkPassword(newPass.Text)
+		typed := newPass.Text != ""
+		setOK(lenRow, c.Len)
+		setOK(uppRow, c.Upper)
+		setOK(lowRow, c.Lower)
+		setOK(digRow, c.Digit)
+		setOK(specRow, c.Special)
+		setOK(commonRow, typed && !c.Common)
+		setOK(wordRow, typed && !c.Word)
+		setOK(walkRow, typed && !c.Keyboard)
+		setOK(repeatRow, typed && !c.Repeat)
+		setOK(strengthRow, c.Score >= passwordMinScore())
+		strengthRow.label.SetText(fmt.Sprintf(tr("rule_strength"), passwordScoreLabel(c.Score), passwordScoreLabel(passwordMinScore())))
 		setOK(matchRow, newPass.Text != "" && confirm.Text != "" && newPass.Text == confirm.Text)
+		setOK(recentRow, newPass.Text != "" && !keyring.PasswordUsed(newPass.Text))
 	}
 	newPass.OnChanged = func(string) { updateHints() }
 	confirm.OnChanged = func(string) { updateHints() }
 
 	saveBtn := widget.NewButton(tr("save"), func() {
-		ok, _, _, _, _, _ := passwordValid(newPass.Text)
-		if !ok {
+		if requireCurrent {
+			if curPass.Text == "" {
+				dialog.ShowInformation(tr("error"), tr("enter_current_password"), win)
+				return
+			}
+			lock, err := checkCurrentPassword(curPass.Text)
+			curPass.SetText("")
+			if err != nil {
+				d := dialog.NewError(err, win)
+				if lock {
+					d.SetOnClosed(func() {
+						win.Close()
+						lockSession(app, parent)
+					})
+				}
+				d.Show()
+				return
+			}
+		}
+		if !checkPassword(newPass.Text).ok() {
 			dialog.ShowInformation(tr("error"), tr("password_not_valid"), win)
 			return
 		}
@@ -144,140 +165,15 @@ func ShowChangePassword(app fyne.App, parent fyne.Window, filePath string, fileD
 			return
 		}
 
-		newKey32 := qalqan.Hash512(newPass.Text)
-		newRKey := make([]byte, qalqan.EXPKLEN)
-		qalqan.Kexp(newKey32[:], qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, newRKey)
-
-		if len(plainKikey) != qalqan.DEFAULT_KEY_LEN {
-			dialog.ShowError(fmt.Errorf("kikey: bad kikey length"), win)
-			return
-		}
-		newEncKikey := make([]byte, qalqan.DEFAULT_KEY_LEN)
-		qalqan.Encrypt(plainKikey[0:16], newRKey, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, newEncKikey[0:16])
-		qalqan.Encrypt(plainKikey[16:32], newRKey, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, newEncKikey[16:32])
-
-		users := len(session_keys)
-		if users <= 0 {
-			dialog.ShowError(fmt.Errorf("no session keys loaded"), win)
-			return
-		}
-
-		isCenter := strings.EqualFold(filepath.Base(filePath), "center.bin")
-
-		var header [16]byte
-		if len(fileData) < 16+qalqan.DEFAULT_KEY_LEN {
-			dialog.ShowError(fmt.Errorf("%s: too short", filepath.Base(filePath)), win)
-			return
-		}
-		copy(header[:], fileData[:16])
-
-		const (
-			headerLen   = 16
-			kikeyLen    = 32
-			circleCount = 100
-			key32       = 32
-			footerLen   = qalqan.BLOCKLEN
-			imitLen     = qalqan.BLOCKLEN
-		)
-
-		inCnt := SkeyInCnt
-		outCnt := SkeyOutCnt
-		if inCnt < 0 {
-			inCnt = 0
-		}
-		if outCnt < 0 {
-			outCnt = 0
-		}
-
-		var bodyLen int
-		if isCenter {
-			bodyLen = headerLen + kikeyLen + circleCount*key32 + users*(inCnt+outCnt)*key32
-		} else {
-			bodyLen = headerLen + kikeyLen + circleCount*key32 + (inCnt+outCnt)*key32
-		}
-
-		total := bodyLen + footerLen + imitLen
-
-		newFile := make([]byte, total)
-		off := 0
-
-		copy(newFile[off:off+headerLen], header[:])
-		off += headerLen
-
-		copy(newFile[off:off+kikeyLen], newEncKikey)
-		off += kikeyLen
-
-		enc32 := func(dst []byte, src32 []byte) {
-			qalqan.Encrypt(src32[0:16], newRKey, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, dst[0:16])
-			qalqan.Encrypt(src32[16:32], newRKey, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, dst[16:32])
-		}
-
-		for i := 0; i < circleCount; i++ {
-			enc32(newFile[off:off+key32], circle_keys[i][:])
-			off += key32
-		}
-
-		if isCenter {
-			for u := 0; u < users; u++ {
-				for i := 0; i < inCnt; i++ {
-					var src [key32]byte
-					if i < len(session_keys[u].In) {
-						src = session_keys[u].In[i]
-					}
-					enc32(newFile[off:off+key32], src[:])
-					off += key32
-				}
-				for i := 0; i < outCnt; i++ {
-					var src [key32]byte
-					if i < len(session_keys[u].Out) {
-						src = session_keys[u].Out[i]
-					}
-					enc32(newFile[off:off+key32], src[:])
-					off += key32
-				}
+		if err := keyring.ChangePassword(newPass.Text); err != nil {
+			if errors.Is(err, qds.ErrPasswordReused) {
+				dialog.ShowInformation(tr("error"), fmt.Sprintf(tr("password_reused"), qds.PasswordHistory), win)
+				return
 			}
-		} else {
-			for u := 0; u < 1; u++ {
-				for i := 0; i < inCnt; i++ {
-					var src [key32]byte
-					if i < len(session_keys[u].In) {
-						src = session_keys[u].In[i]
-					}
-					enc32(newFile[off:off+key32], src[:])
-					off += key32
-				}
-				for i := 0; i < outCnt; i++ {
-					var src [key32]byte
-					if i < len(session_keys[u].Out) {
-						src = session_keys[u].Out[i]
-					}
-					enc32(newFile[off:off+key32], src[:])
-					off += key32
-				}
-			}
-		}
-
-		if off != bodyLen {
-			dialog.ShowError(fmt.Errorf("size mismatch: wrote %d, expected %d", off, bodyLen), win)
-			return
-		}
-
-		f := buildFooter(true)
-		copy(newFile[off:off+footerLen], f[:])
-		off += footerLen
-
-		imit := make([]byte, imitLen)
-		qalqan.Qalqan_Imit(uint64(off), rimitkey, bytes.NewReader(newFile[:off]), imit)
-		copy(newFile[off:off+imitLen], imit)
-
-		if err := os.WriteFile(filePath, newFile, 0600); err != nil {
 			dialog.ShowError(err, win)
 			return
 		}
-
-		currentRKey = make([]byte, len(newRKey))
-		copy(currentRKey, newRKey)
-		lastKeyHashHex = hex.EncodeToString(newKey32[:])
+		lastKeyHashHex = keyring.KeyHash()
 
 		dialog.ShowInformation(tr("success"), tr("password_changed_ok"), win)
 		win.Close()
@@ -291,13 +187,28 @@ func ShowChangePassword(app fyne.App, parent fyne.Window, filePath string, fileD
 	})
 
 	title := widget.NewLabelWithStyle(tr("change_password"), fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
-	sub := widget.NewLabelWithStyle(tr("please_change_password"), fyne.TextAlignCenter, fyne.TextStyle{Italic: true})
+	subText := tr("please_change_password")
+	if requireCurrent {
+		subText = tr("change_password_current_hint")
+	}
+	if exp := keyring.PasswordExpires(); !exp.IsZero() && !time.Now().Before(exp) {
+		subText = fmt.Sprintf(tr("password_expired"), exp.Format("02.01.2006"))
+	}
+	sub := widget.NewLabelWithStyle(subText, fyne.TextAlignCenter, fyne.TextStyle{Italic: true})
+	sub.Wrapping = fyne.TextWrapWord
+
+	var passItems []*widget.FormItem
+	if requireCurrent {
+		passItems = append(passItems, widget.NewFormItem(tr("current_password"), curPass))
+		curPass.OnSubmitted = func(string) { win.Canvas().Focus(newPass) }
+	}
+	passItems = append(passItems,
+		widget.NewFormItem(tr("new_password"), newPass),
+		widget.NewFormItem(tr("confirm_password"), confirm),
+	)
 
 	form := container.NewVBox(
-		widget.NewForm(
-			widget.NewFormItem(tr("new_password"), newPass),
-			widget.NewFormItem(tr("confirm_password"), confirm),
-		),
+		widget.NewForm(passItems...),
 		widget.NewSeparator(),
 		widget.NewLabel(tr("password_rules")),
 		container.NewVBox(
@@ -306,7 +217,13 @@ func ShowChangePassword(app fyne.App, parent fyne.Window, filePath string, fileD
 			lowRow.box,
 			digRow.box,
 			specRow.box,
+			commonRow.box,
+			wordRow.box,
+			walkRow.box,
+			repeatRow.box,
+			strengthRow.box,
 			matchRow.box,
+			recentRow.box,
 		),
 	)
 
@@ -0,0 +1,1124 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cliName = "qalqands"
+
+const (
+	exitOK           = 0
+	exitFailure      = 1
+	exitUsage        = 2
+	exitKeysFile     = 3 // key file missing, expired, damaged or wrong password
+	exitNoKeys       = 4 // no suitable key left
+	exitBadContainer = 5 // invalid or damaged container
+	exitIO           = 6
+)
+
+const cliUsage = `usage: qalqands <command> [options] [arguments]
+
+commands:
+  encrypt [--to N[,N...]] [--key session|circle] [--out PATH] FILE|FOLDER...|-
+          one file gives a single container, several files or a folder give an archive;
+          "-" or no arguments with piped input encrypts stdin, of any length, to stdout
+          --out PATH            output file, "-" for stdout
+          --armor               write an ASCII-armored container
+          --compress            compress before encryption
+          --volume-size MB      split the container into volumes, not with --armor or --out -
+          --force               overwrite an existing output file
+  decrypt [--out PATH] FILE|-
+          "-" or no argument with piped input reads the container from stdin
+          --out PATH            output file, "-" for stdout; for archives the target folder
+          --on-conflict MODE    rename, overwrite or skip existing files (archives)
+          --no-subfolder        extract archives directly into the target folder
+          --force               overwrite an existing output file
+  inspect [--verify] FILE      show the container header; --verify also checks the imits
+  keys status                  show the keys left and the expiry date
+  version
+
+common options:
+  --keys PATH        key file (default: center.bin or abc.bin next to the program)
+  --password-fd N    read the password from file descriptor N (0 = stdin) instead of the terminal;
+                     0 can't be used while the data comes from stdin
+  --json             print the result as JSON
+
+The password is never taken from the command line.
+
+exit codes:
+  0 ok, 1 error, 2 usage, 3 key file or password, 4 no keys left,
+  5 invalid or damaged container, 6 read or write error
+`
+
+var cliCommands = map[string]bool{
+	"encrypt": true,
+	"decrypt": true,
+	"inspect": true,
+	"keys":    true,
+	"version": true,
+	"help":    true,
+}
+
+// isCLIInvocation reports whether the program was started with a command instead of for the window.
+func isCLIInvocation(args []string) bool {
+	return len(args) > 0 && cliCommands[args[0]]
+}
+
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+
+func cliErr(code int, err error) error { return &cliError{code: code, err: err} }
+
+func usageErr(format string, a ...any) error {
+	return cliErr(exitUsage, fmt.Errorf(format, a...))
+}
+
+type cliResult interface {
+	text() string
+}
+
+type cliStatus struct {
+	OK bool `json:"ok"`
+}
+
+type cliEnv struct {
+	stdin      io.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+	json       bool
+	keysPath   string
+	passwordFd int
+}
+
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	env := &cliEnv{stdin: os.Stdin, stdout: stdout, stderr: stderr, passwordFd: -1}
+
+	var res cliResult
+	var err error
+	switch args[0] {
+	case "encrypt":
+		res, err = env.encrypt(args[1:])
+	case "decrypt":
+		res, err = env.decrypt(args[1:])
+	case "inspect":
+		res, err = env.inspect(args[1:])
+	case "keys":
+		res, err = env.keys(args[1:])
+	case "version":
+		res = versionResult{cliStatus{true}, Version, Commit, Date}
+	default:
+		fmt.Fprint(stdout, cliUsage)
+		return exitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(stdout, cliUsage)
+		return exitOK
+	}
+	if err != nil {
+		return env.fail(err)
+	}
+
+	if env.json {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(res)
+	} else if t := res.text(); t != "" {
+		fmt.Fprintln(stdout, t)
+	}
+	return exitOK
+}
+
+func (env *cliEnv) fail(err error) int {
+	code := exitFailure
+	var ce *cliError
+	if errors.As(err, &ce) {
+		code = ce.code
+	}
+	if env.json {
+		enc := json.NewEncoder(env.stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			cliStatus
+			Error    string `json:"error"`
+			ExitCode int    `json:"exit_code"`
+		}{Error: err.Error(), ExitCode: code})
+		return code
+	}
+	fmt.Fprintf(env.stderr, "%s: %v\n", cliName, err)
+	if code == exitUsage {
+		fmt.Fprintf(env.stderr, "run '%s help' for usage\n", cliName)
+	}
+	return code
+}
+
+func (env *cliEnv) warn(format string, a ...any) {
+	fmt.Fprintf(env.stderr, "%s: %s\n", cliName, fmt.Sprintf(format, a...))
+}
+
+// journal warns about a journal entry that could not be written; the operation itself stands.
+func (env *cliEnv) journal(err error) {
+	if err != nil {
+		env.warn(tr("journal_error"), err)
+	}
+}
+
+// stdinInput reports whether the data comes from stdin: the argument "-", or none while stdin is not a terminal.
+func (env *cliEnv) stdinInput(args []string) bool {
+	if len(args) == 1 && args[0] == "-" {
+		return true
+	}
+	if len(args) > 0 {
+		return false
+	}
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice == 0
+}
+
+// checkStdinPassword keeps the password out of the data read from stdin.
+func (env *cliEnv) checkStdinPassword() error {
+	if env.passwordFd == 0 {
+		return usageErr("--password-fd 0 can't be used while the data comes from stdin")
+	}
+	return nil
+}
+
+func (env *cliEnv) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&env.keysPath, "keys", "", "")
+	fs.IntVar(&env.passwordFd, "password-fd", -1, "")
+	fs.BoolVar(&env.json, "json", false, "")
+	return fs
+}
+
+// parseCLIArgs parses flags placed anywhere among the arguments; everything after "--" is an argument.
+func parseCLIArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for i, a := range args {
+		if a == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, cliErr(exitUsage, err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+	return append(pos, rest...), nil
+}
+
+// userList collects --to values given as "2,5" or as repeated flags.
+type userList []int
+
+func (u *userList) String() string {
+	parts := make([]string, len(*u))
+	for i, n := range *u {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (u *userList) Set(s string) error {
+	for _, p := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad user number %q", p)
+		}
+		*u = append(*u, n)
+	}
+	return nil
+}
+
+func (env *cliEnv) readPassword() (string, error) {
+	if env.passwordFd < 0 {
+		return readPasswordTTY(tr("enter_password") + " ")
+	}
+	f := os.Stdin
+	if env.passwordFd != 0 {
+		f = os.NewFile(uintptr(env.passwordFd), "password-fd")
+		if f == nil {
+			return "", fmt.Errorf("bad --password-fd %d", env.passwordFd)
+		}
+		defer f.Close()
+	}
+	return readPasswordLine(f)
+}
+
+// readPasswordLine reads one line byte by byte, so nothing after it is consumed.
+func readPasswordLine(r io.Reader) (string, error) {
+	const maxPasswordLen = 1024
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) < maxPasswordLen {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	p := strings.TrimSuffix(string(line), "\r")
+	if p == "" {
+		return "", errors.New(tr("enter_password"))
+	}
+	return p, nil
+}
+
+// openKeys loads the key file the same way the login window does.
+func (env *cliEnv) openKeys() error {
+	path := env.keysPath
+	if path == "" {
+		p, err := locateKeysFile()
+		if err != nil {
+			return cliErr(exitKeysFile, err)
+		}
+		path = p
+	}
+	if !fileExists(path) {
+		return cliErr(exitKeysFile, fmt.Errorf("key file not found: %s", path))
+	}
+
+	leftDays, err := checkKeysExpiry(path)
+	if err != nil {
+		return cliErr(exitKeysFile, err)
+	}
+	if leftDays >= 0 {
+		env.warn(tr("keys_expiry_warning"), leftDays, daysWord(leftDays), keysExpiryCache.Format("02.01.2006"))
+	}
+
+	password, err := env.readPassword()
+	if err != nil {
+		return cliErr(exitKeysFile, err)
+	}
+	if err := loadKeysFile(path, password); err != nil {
+		return cliErr(exitKeysFile, err)
+	}
+	if !keyring.PasswordChanged() {
+		return cliErr(exitKeysFile, errors.New("the initial password has to be changed in the application first"))
+	}
+	if expired, err := checkPasswordAge(); err != nil {
+		return cliErr(exitKeysFile, err)
+	} else if expired {
+		return cliErr(exitKeysFile, errors.New("the password has expired and has to be changed in the application first"))
+	}
+	return nil
+}
+
+// keyCountFor counts the session keys left for user index uidx, numbered from 1 as in the window.
+func keyCountFor(uidx int) *qds.KeyCount {
+	user := uidx + 1
+	if !isCenterMode {
+		user = keyring.User() + 1
+	}
+	in, out := keyring.SessionKeysLeft(uidx)
+	return &qds.KeyCount{User: user, In: in, Out: out}
+}
+
+// cliTargets turns the --to numbers, counted from 1 as in the recipient list of the window, into user indexes.
+func cliTargets(to userList, useSession bool) ([]int, error) {
+	if !isCenterMode {
+		if len(to) > 0 {
+			return nil, usageErr("--to is only used with the center key file")
+		}
+		return []int{localUserIndex}, nil
+	}
+	if len(to) == 0 {
+		if useSession {
+			return nil, usageErr("--to is required with the center key file")
+		}
+		return []int{0}, nil
+	}
+	seen := map[int]bool{}
+	var targets []int
+	for _, n := range to {
+		if n > keyring.Users() {
+			return nil, usageErr("no user #%d in the key file (1..%d)", n, keyring.Users())
+		}
+		if !seen[n] {
+			seen[n] = true
+			targets = append(targets, n-1)
+		}
+	}
+	if !useSession && len(targets) > 1 {
+		return nil, usageErr("several recipients need --key session")
+	}
+	return targets, nil
+}
+
+func readLimitedFile(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, cliErr(exitIO, err)
+	}
+	defer f.Close()
+	lr := &io.LimitedReader{R: f, N: limit + 1}
+	data, err := io.ReadAll(lr)
+	if err != nil {
+		return nil, cliErr(exitIO, fmt.Errorf(tr("read_error"), err))
+	}
+	if int64(len(data)) > limit {
+		return nil, cliErr(exitFailure, errors.New(tr("file_too_big")))
+	}
+	return data, nil
+}
+
+func checkOutputFree(path string, force bool) error {
+	if _, err := os.Lstat(path); err == nil && !force {
+		return cliErr(exitIO, fmt.Errorf("%s already exists, use --force to overwrite", path))
+	}
+	return nil
+}
+
+func createOutputFile(path string, force bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, cliErr(exitIO, err)
+	}
+	return f, nil
+}
+
+func samePath(a, b string) bool {
+	aa, err1 := filepath.Abs(a)
+	bb, err2 := filepath.Abs(b)
+	return err1 == nil && err2 == nil && aa == bb
+}
+
+type encryptResult struct {
+	cliStatus
+	Outputs    []string      `json:"outputs"`
+	Archive    bool          `json:"archive"`
+	Files      int           `json:"files"`
+	Key        string        `json:"key"`
+	Recipients []int         `json:"recipients,omitempty"`
+	KeysLeft   *qds.KeyCount `json:"keys_left,omitempty"`
+}
+
+func (r encryptResult) text() string {
+	if len(r.Outputs) == 1 && r.Outputs[0] == "-" {
+		return "" // stdout holds the container
+	}
+	var b strings.Builder
+	for _, p := range r.Outputs {
+		b.WriteString(p + "\n")
+	}
+	if r.KeysLeft != nil {
+		b.WriteString(r.keysLeftLine() + "\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func (r encryptResult) keysLeftLine() string {
+	return fmt.Sprintf("session keys left for user #%d: in %d, out %d", r.KeysLeft.User, r.KeysLeft.In, r.KeysLeft.Out)
+}
+
+func (env *cliEnv) encrypt(args []string) (cliResult, error) {
+	fs := env.flags("encrypt")
+	var to userList
+	fs.Var(&to, "to", "")
+	keyKind := fs.String("key", "session", "")
+	out := fs.String("out", "", "")
+	armor := fs.Bool("armor", false, "")
+	compress := fs.Bool("compress", false, "")
+	volumeMb := fs.Int64("volume-size", 0, "")
+	force := fs.Bool("force", false, "")
+	files, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	stream := env.stdinInput(files)
+	if len(files) == 0 && !stream {
+		return nil, usageErr("encrypt: no files given")
+	}
+	var useSession bool
+	switch *keyKind {
+	case "session":
+		useSession = true
+	case "circle":
+	default:
+		return nil, usageErr("--key must be session or circle")
+	}
+	// volumes are binary files named after the output, as in the window
+	switch {
+	case *volumeMb < 0:
+		return nil, usageErr("--volume-size must be positive")
+	case *volumeMb > 0 && *armor:
+		return nil, usageErr("--volume-size can't be used with --armor")
+	case *volumeMb > 0 && *out == "-":
+		return nil, usageErr("--volume-size can't be used with --out -")
+	}
+	if stream {
+		return env.encryptStream(*out, *force, *armor, *compress, *volumeMb, to, useSession, *keyKind)
+	}
+	if *out == "-" && env.json {
+		return nil, usageErr("--out - can't be used with --json")
+	}
+
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			return nil, cliErr(exitIO, err)
+		}
+	}
+	single := len(files) == 1 && fileExists(files[0])
+
+	outPath := *out
+	if outPath == "" {
+		if single {
+			outPath = suggestEncryptedNameFromPath(files[0])
+		} else {
+			outPath = suggestArchiveName(files)
+		}
+		if *armor {
+			outPath = strings.TrimSuffix(outPath, ".bin") + qds.ArmorExt
+		}
+	}
+	for _, f := range files {
+		if samePath(f, outPath) {
+			return nil, usageErr("the output would overwrite %s", f)
+		}
+	}
+	volumeSize := *volumeMb << 20
+	if volumeSize > 0 {
+		if err := checkOutputFree(volumePath(outPath, 1), *force); err != nil {
+			return nil, err
+		}
+	} else if outPath != "-" {
+		if err := checkOutputFree(outPath, *force); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := env.openKeys(); err != nil {
+		return nil, err
+	}
+	targets, err := cliTargets(to, useSession)
+	if err != nil {
+		return nil, err
+	}
+	compressEnabled = *compress
+
+	var buf *bytes.Buffer
+	var sealed *qds.EncryptResult
+	count := 1
+	if single {
+		data, err := readLimitedFile(files[0], qds.MaxPlainSize)
+		if err != nil {
+			return nil, err
+		}
+		buf, sealed, err = buildContainer(nil, data, fileTypeFromPath(files[0]), false, useSession, targets, nil)
+	} else {
+		var entries []qds.Entry
+		entries, err = qds.CollectEntries(files)
+		if err != nil {
+			return nil, cliErr(exitIO, err)
+		}
+		count = 0
+		for _, e := range entries {
+			if !e.Dir {
+				count++
+			}
+		}
+		buf, sealed, err = buildQpkgContainer(nil, entries, useSession, targets, nil)
+	}
+	if err != nil {
+		return nil, encryptErr(err)
+	}
+	if single {
+		env.journal(journalSealed(nil, sealed, qds.JournalFile, files[0], viaCLI))
+	} else {
+		env.journal(journalSealed(nil, sealed, qds.JournalArchive, strings.TrimPrefix(outPath, "-"), viaCLI))
+	}
+
+	data := buf.Bytes()
+	if *armor {
+		data = qds.Armor(data)
+	}
+
+	var outputs []string
+	if volumeSize > 0 && int64(len(data)) > volumeSize {
+		outputs, err = writeVolumes(outPath, data, volumeSize, nil)
+		if err != nil {
+			return nil, cliErr(exitIO, err)
+		}
+	} else if outPath == "-" {
+		if _, err := env.stdout.Write(data); err != nil {
+			return nil, cliErr(exitIO, fmt.Errorf(tr("write_error"), err))
+		}
+		outputs = []string{outPath}
+	} else {
+		f, err := createOutputFile(outPath, *force)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(outPath)
+			return nil, cliErr(exitIO, fmt.Errorf(tr("write_error"), err))
+		}
+		outputs = []string{outPath}
+	}
+
+	return env.encryptResult(sealed, outputs, !single, count, *keyKind), nil
+}
+
+func (env *cliEnv) encryptResult(sealed *qds.EncryptResult, outputs []string, archive bool, files int, key string) encryptResult {
+	res := encryptResult{
+		cliStatus: cliStatus{true},
+		Outputs:   outputs,
+		Archive:   archive,
+		Files:     files,
+		Key:       key,
+	}
+	if isCenterMode {
+		for _, t := range sealed.Recipients {
+			res.Recipients = append(res.Recipients, t+1)
+		}
+	}
+	if sealed.Session && len(sealed.Recipients) == 1 {
+		res.KeysLeft = keyCountFor(sealed.Recipients[0])
+		if res.text() == "" {
+			env.warn("%s", res.keysLeftLine())
+		}
+	}
+	return res
+}
+
+func encryptErr(err error) error {
+	switch {
+	case errors.Is(err, qds.ErrNoKeys):
+		return cliErr(exitNoKeys, err)
+	case errors.Is(err, qds.ErrSaveKeys):
+		return cliErr(exitIO, err)
+	}
+	return err
+}
+
+// encryptStream encrypts stdin as it arrives; its length is not known in advance.
+func (env *cliEnv) encryptStream(outPath string, force, armor, compress bool, volumeMb int64, to userList, useSession bool, keyKind string) (cliResult, error) {
+	if outPath == "" {
+		outPath = "-"
+	}
+	if volumeMb > 0 {
+		return nil, usageErr("--volume-size can't be used with stdin")
+	}
+	if outPath == "-" && env.json {
+		return nil, usageErr("--json needs --out when the container goes to stdout")
+	}
+	if err := env.checkStdinPassword(); err != nil {
+		return nil, err
+	}
+	if outPath != "-" {
+		if err := checkOutputFree(outPath, force); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := env.openKeys(); err != nil {
+		return nil, err
+	}
+	targets, err := cliTargets(to, useSession)
+	if err != nil {
+		return nil, err
+	}
+
+	w := env.stdout
+	var f *os.File
+	if outPath != "-" {
+		if f, err = createOutputFile(outPath, force); err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	opts := encryptOptions(qds.FileTypeGeneric, useSession, targets, nil)
+	opts.Compress, opts.Armor = compress, armor
+	sealed, err := keyring.EncryptStream(w, env.stdin, opts)
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(outPath)
+		}
+	}
+	if errors.Is(err, qds.ErrNoKeys) || errors.Is(err, qds.ErrSaveKeys) {
+		return nil, encryptErr(err)
+	}
+	if err != nil {
+		return nil, cliErr(exitIO, err)
+	}
+	env.journal(journalSealed(nil, sealed, qds.JournalFile, strings.TrimPrefix(outPath, "-"), viaCLI))
+	return env.encryptResult(sealed, []string{outPath}, false, 1, keyKind), nil
+}
+
+// readContainerFile reads a container, an armored container or a whole volume set.
+func readContainerFile(path string) ([]byte, int, error) {
+	if !isVolumeFile(path) {
+		data, err := readLimitedFile(path, qds.MaxArmoredSize)
+		return data, 0, err
+	}
+	vr, err := openVolumeSet(path)
+	if err != nil {
+		return nil, 0, cliErr(exitBadContainer, err)
+	}
+	defer vr.Close()
+	lr := &io.LimitedReader{R: vr, N: qds.MaxEncryptedSize + 1}
+	data, err := io.ReadAll(lr)
+	if err != nil {
+		return nil, 0, cliErr(exitBadContainer, err)
+	}
+	if int64(len(data)) > qds.MaxEncryptedSize {
+		return nil, 0, errors.New(tr("file_too_big"))
+	}
+	return data, len(vr.paths), nil
+}
+
+type decryptResult struct {
+	cliStatus
+	Kind    string             `json:"kind"`
+	Output  string             `json:"output,omitempty"`
+	Bytes   int64              `json:"bytes,omitempty"`
+	Message string             `json:"message,omitempty"`
+	Summary *qds.UnpackSummary `json:"summary,omitempty"`
+}
+
+func (r decryptResult) text() string {
+	switch r.Kind {
+	case "message":
+		return r.Message
+	case "archive":
+		s := r.Summary
+		return fmt.Sprintf("%s\n", r.Output) + strings.TrimRight(fmt.Sprintf(tr("summary_log"),
+			len(s.Written), len(s.Overwritten), len(s.Renamed), len(s.Skipped), len(s.Damaged)), "\n")
+	}
+	if r.Output == "-" {
+		return ""
+	}
+	return r.Output
+}
+
+func (env *cliEnv) decrypt(args []string) (cliResult, error) {
+	fs := env.flags("decrypt")
+	out := fs.String("out", "", "")
+	onConflict := fs.String("on-conflict", "rename", "")
+	noSubfolder := fs.Bool("no-subfolder", false, "")
+	force := fs.Bool("force", false, "")
+	files, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	stream := env.stdinInput(files)
+	if len(files) != 1 && !stream {
+		return nil, usageErr("decrypt takes exactly one file")
+	}
+	src := "stdin"
+	if !stream {
+		src = files[0]
+	}
+
+	var policy qds.ConflictPolicy
+	switch *onConflict {
+	case "rename":
+		policy = qds.ConflictRename
+	case "overwrite":
+		policy = qds.ConflictOverwrite
+	case "skip":
+		policy = qds.ConflictSkip
+	default:
+		return nil, usageErr("--on-conflict must be rename, overwrite or skip")
+	}
+	if *out == "-" && env.json {
+		return nil, usageErr("--out - can't be used with --json")
+	}
+
+	var data []byte
+	if stream {
+		if err := env.checkStdinPassword(); err != nil {
+			return nil, err
+		}
+	} else {
+		var volumes int
+		if data, volumes, err = readContainerFile(src); err != nil {
+			return nil, err
+		}
+		if volumes > 0 {
+			src = volumeBaseName(src)
+		}
+	}
+
+	if err := env.openKeys(); err != nil {
+		return nil, err
+	}
+	var c *qds.Container
+	if stream {
+		c, err = keyring.OpenContainerStream(env.stdin)
+	} else {
+		c, err = keyring.OpenContainer(data)
+	}
+	if err != nil {
+		return nil, cliErr(exitBadContainer, localizeError(err))
+	}
+	defer c.Close()
+
+	// check the target before a session key is used up
+	outPath := *out
+	if !c.Message() && !c.Archive() {
+		if outPath == "" && stream {
+			if env.json {
+				return nil, usageErr("--json needs --out when the file goes to stdout")
+			}
+			outPath = "-"
+		}
+		if outPath == "" {
+			outPath = filepath.Join(filepath.Dir(src), qds.SanitizeFileName(suggestDecryptedNameFromPath(src, c.FileType)))
+		}
+		if outPath != "-" {
+			if err := checkOutputFree(outPath, *force); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	p, err := keyring.Unlock(c)
+	if err != nil {
+		if errors.Is(err, qds.ErrSaveKeys) {
+			return nil, cliErr(exitIO, err)
+		}
+		return nil, cliErr(exitNoKeys, localizeError(err))
+	}
+	defer p.Close()
+	if stream {
+		env.journal(journalOpened(nil, c, "", viaCLI))
+	} else {
+		env.journal(journalOpened(nil, c, src, viaCLI))
+	}
+
+	if c.Message() {
+		text, err := readMessagePayload(p)
+		if err != nil {
+			return nil, cliErr(exitBadContainer, err)
+		}
+		return decryptResult{cliStatus: cliStatus{true}, Kind: "message", Message: text}, nil
+	}
+
+	payload := p.Open(nil)
+	defer payload.Close()
+
+	if c.Archive() {
+		dest := outPath
+		if dest == "" {
+			dest = "."
+		}
+		if err := os.MkdirAll(dest, 0o755); err != nil {
+			return nil, cliErr(exitIO, err)
+		}
+		if !*noSubfolder {
+			if dest, err = makeExtractFolder(dest, src); err != nil {
+				return nil, cliErr(exitIO, err)
+			}
+		}
+		sum, err := qds.Unpack(payload, dest, qds.UnpackOptions{Policy: policy})
+		if err != nil {
+			return nil, cliErr(exitBadContainer, localizeError(err))
+		}
+		return decryptResult{cliStatus: cliStatus{true}, Kind: "archive", Output: dest, Summary: sum}, nil
+	}
+
+	var w io.Writer = env.stdout
+	var f *os.File
+	if outPath != "-" {
+		if f, err = createOutputFile(outPath, *force); err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	n, err := io.Copy(w, payload)
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(outPath)
+		}
+	}
+	if err != nil {
+		return nil, cliErr(exitIO, fmt.Errorf(tr("decrypt_error"), localizeError(err)))
+	}
+	return decryptResult{cliStatus: cliStatus{true}, Kind: "file", Output: outPath, Bytes: n}, nil
+}
+
+type inspectRecipient struct {
+	User       int `json:"user"`
+	SessionKey int `json:"session_key"`
+}
+
+type inspectResult struct {
+	cliStatus
+	File        string             `json:"file"`
+	Size        int                `json:"size"`
+	Armored     bool               `json:"armored"`
+	Volumes     int                `json:"volumes,omitempty"`
+	Sender      string             `json:"sender"`
+	Content     string             `json:"content"`
+	FileType    string             `json:"file_type"`
+	KeyType     string             `json:"key_type"`
+	CircleKey   int                `json:"circle_key,omitempty"`
+	SessionKey  int                `json:"session_key,omitempty"`
+	Recipients  []inspectRecipient `json:"recipients,omitempty"`
+	Compressed  bool               `json:"compressed"`
+	PayloadSize int                `json:"payload_size"`
+	Verified    *bool              `json:"verified,omitempty"`
+}
+
+func (r inspectResult) text() string {
+	var b strings.Builder
+	row := func(k string, v any) { fmt.Fprintf(&b, "%-13s %v\n", k+":", v) }
+	row("file", r.File)
+	row("size", r.Size)
+	if r.Armored {
+		row("format", "armored")
+	}
+	if r.Volumes > 0 {
+		row("volumes", r.Volumes)
+	}
+	row("sender", r.Sender)
+	row("content", r.Content)
+	row("file type", r.FileType)
+	row("key type", r.KeyType)
+	if r.CircleKey > 0 {
+		row("circle key", r.CircleKey)
+	}
+	if r.SessionKey > 0 {
+		row("session key", r.SessionKey)
+	}
+	for _, rc := range r.Recipients {
+		row("recipient", fmt.Sprintf("user %d, session key %d", rc.User, rc.SessionKey))
+	}
+	row("compressed", r.Compressed)
+	row("payload", r.PayloadSize)
+	if r.Verified != nil {
+		row("imits", "ok")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func fileTypeName(ft byte) string {
+	switch ft {
+	case qds.FileTypePhoto:
+		return "photo"
+	case qds.FileTypeAudio:
+		return "audio"
+	case qds.FileTypeVideo:
+		return "video"
+	}
+	return "generic"
+}
+
+func (env *cliEnv) inspect(args []string) (cliResult, error) {
+	fs := env.flags("inspect")
+	verify := fs.Bool("verify", false, "")
+	files, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) != 1 {
+		return nil, usageErr("inspect takes exactly one file")
+	}
+
+	raw, volumes, err := readContainerFile(files[0])
+	if err != nil {
+		return nil, err
+	}
+	c, err := qds.Inspect(raw)
+	if err != nil {
+		return nil, cliErr(exitBadContainer, localizeError(err))
+	}
+	res := describeContainer(c)
+	res.File = files[0]
+	res.Size = len(raw)
+	res.Armored = qds.IsArmored(raw)
+	res.Volumes = volumes
+
+	if *verify {
+		if err := env.openKeys(); err != nil {
+			return nil, err
+		}
+		if _, err := keyring.OpenContainer(raw); err != nil {
+			return nil, cliErr(exitBadContainer, localizeError(err))
+		}
+		ok := true
+		res.Verified = &ok
+	}
+	return res, nil
+}
+
+// describeContainer fills in what the service info of c tells.
+func describeContainer(c *qds.Container) inspectResult {
+	res := inspectResult{
+		cliStatus:   cliStatus{true},
+		Sender:      "center",
+		Content:     "file",
+		FileType:    fileTypeName(c.FileType),
+		Compressed:  c.Compressed(),
+		PayloadSize: c.PayloadSize(),
+	}
+	if !c.FromCenter() {
+		res.Sender = fmt.Sprintf("user %d", int(c.Owner)+1)
+	}
+	switch {
+	case c.Message():
+		res.Content = "message"
+	case c.Archive():
+		res.Content = "archive"
+	}
+	switch c.KeyType {
+	case qds.KeyTypeCircle:
+		res.KeyType = "circle"
+		res.CircleKey = c.CircleIndex + 1
+	case qds.KeyTypeMulti:
+		res.KeyType = "multi"
+		for _, e := range c.Recipients {
+			res.Recipients = append(res.Recipients, inspectRecipient{User: e.User + 1, SessionKey: e.SessionIndex + 1})
+		}
+	default:
+		res.KeyType = "session"
+		res.SessionKey = c.SessionIndex + 1
+	}
+	return res
+}
+
+type keysStatusResult struct {
+	cliStatus
+	KeysFile    string         `json:"keys_file"`
+	Mode        string         `json:"mode"`
+	User        int            `json:"user,omitempty"`
+	Expires     string         `json:"expires,omitempty"`
+	DaysLeft    *int           `json:"days_left,omitempty"`
+	PasswordSet string         `json:"password_set,omitempty"`
+	PasswordExp string         `json:"password_expires,omitempty"`
+	CircleKeys  int            `json:"circle_keys"`
+	SessionKeys []qds.KeyCount `json:"session_keys"`
+}
+
+func (r keysStatusResult) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "key file:    %s\n", r.KeysFile)
+	if r.Mode == "user" {
+		fmt.Fprintf(&b, "mode:        user #%d\n", r.User)
+	} else {
+		fmt.Fprintf(&b, "mode:        center\n")
+	}
+	if r.DaysLeft != nil {
+		fmt.Fprintf(&b, "expires:     %s (%d %s)\n", r.Expires, *r.DaysLeft, daysWord(*r.DaysLeft))
+	}
+	if r.PasswordSet != "" {
+		fmt.Fprintf(&b, "password:    set %s", r.PasswordSet)
+		if r.PasswordExp != "" {
+			fmt.Fprintf(&b, ", expires %s", r.PasswordExp)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "circle keys: %d\n", r.CircleKeys)
+	for _, k := range r.SessionKeys {
+		fmt.Fprintf(&b, "user #%-3d    in %d, out %d\n", k.User, k.In, k.Out)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func (env *cliEnv) keys(args []string) (cliResult, error) {
+	fs := env.flags("keys")
+	rest, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 1 || rest[0] != "status" {
+		return nil, usageErr("unknown keys command, expected: keys status")
+	}
+	if err := env.openKeys(); err != nil {
+		return nil, err
+	}
+	return keysStatus(), nil
+}
+
+// keysStatus describes the current keyring, with users numbered from 1.
+func keysStatus() keysStatusResult {
+	st := keyring.Status()
+	res := keysStatusResult{
+		cliStatus:  cliStatus{true},
+		KeysFile:   st.Path,
+		Mode:       "center",
+		CircleKeys: st.CircleKeys,
+	}
+	if !st.Center {
+		res.Mode = "user"
+		res.User = st.User + 1
+	}
+	if !st.Expires.IsZero() {
+		left := int(time.Until(st.Expires).Hours() / 24)
+		if left < 0 {
+			left = 0
+		}
+		res.Expires = st.Expires.Format("2006-01-02")
+		res.DaysLeft = &left
+	}
+	if !st.PasswordSetAt.IsZero() {
+		res.PasswordSet = st.PasswordSetAt.Format("2006-01-02")
+	}
+	if !st.PasswordExpires.IsZero() {
+		res.PasswordExp = st.PasswordExpires.Format("2006-01-02")
+	}
+	for _, n := range st.SessionKeys {
+		n.User++
+		res.SessionKeys = append(res.SessionKeys, n)
+	}
+	return res
+}
+
+type versionResult struct {
+	cliStatus
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+func (r versionResult) text() string {
+	return fmt.Sprintf("Qalqan-DS %s (%s, %s)", r.Version, r.Commit, r.Date)
+}
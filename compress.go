@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+var compressEnabled bool
+
+func compressionRatioText(plain, packed int64) string {
+	ratio := 0.0
+	if packed > 0 {
+		ratio = float64(plain) / float64(packed)
+	}
+	return fmt.Sprintf(tr("compression_ratio"), humanSize(plain), humanSize(packed), ratio)
+}
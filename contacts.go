@@ -0,0 +1,437 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const maxAvatarSize = 256 << 10
+
+// The address book of center.bin, by user number counted from 1. Jobs read it from their
+// goroutines, so it is only replaced whole under addressBookMu.
+var (
+	addressBookMu  sync.Mutex
+	addressBook    map[int]qds.Contact
+	addressBookErr error
+)
+
+// loadAddressBook reads the address book of the current key file; users have none.
+func loadAddressBook() {
+	var book map[int]qds.Contact
+	var err error
+	if keyring != nil && keyring.IsCenter() {
+		var list []qds.Contact
+		list, err = keyring.LoadContacts()
+		book = contactsByUser(list)
+	}
+	addressBookMu.Lock()
+	addressBook, addressBookErr = book, err
+	addressBookMu.Unlock()
+}
+
+func contactsByUser(list []qds.Contact) map[int]qds.Contact {
+	book := make(map[int]qds.Contact, len(list))
+	for _, c := range list {
+		book[c.User] = c
+	}
+	return book
+}
+
+// contactOf returns the contact of user u counted from 0.
+func contactOf(u int) (qds.Contact, bool) {
+	addressBookMu.Lock()
+	defer addressBookMu.Unlock()
+	c, ok := addressBook[u+1]
+	return c, ok && c.Name != ""
+}
+
+// userLabel names user u, counted from 0, for the log and the history: №17 (Name).
+func userLabel(u int) string {
+	s := fmt.Sprintf(tr("user_n"), u+1)
+	if c, ok := contactOf(u); ok {
+		s += " (" + c.Name + ")"
+	}
+	return s
+}
+
+// userOption is the choice of user u, counted from 0, in the recipient pickers.
+func userOption(u int) string {
+	s := strconv.Itoa(u + 1)
+	if c, ok := contactOf(u); ok {
+		s += " — " + c.Name
+	}
+	return s
+}
+
+func userOptions() []string {
+	opts := make([]string, keyring.Users())
+	for i := range opts {
+		opts[i] = userOption(i)
+	}
+	return opts
+}
+
+// parseUserOption reads back the user, counted from 0, from a choice made by userOption.
+func parseUserOption(s string) (int, bool) {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	i, err := strconv.Atoi(s[:n])
+	if err != nil || i < 1 || i > keyring.Users() {
+		return 0, false
+	}
+	return i - 1, true
+}
+
+// refreshUserOptions renames the users in the recipient picker of the main window.
+func refreshUserOptions() {
+	if recipientSelect == nil {
+		return
+	}
+	recipientSelect.Options = userOptions()
+	if len(selectedRecipients) > 1 {
+		recipientSelect.Refresh()
+		return
+	}
+	recipientSelect.SetSelected(userOption(selectedUserIdx))
+}
+
+func sortedContacts(book map[int]qds.Contact) []qds.Contact {
+	list := make([]qds.Contact, 0, len(book))
+	for _, c := range book {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].User < list[j].User })
+	return list
+}
+
+func writeContactsCSV(w io.Writer, list []qds.Contact) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"user", "name", "department", "note"})
+	for _, c := range list {
+		cw.Write([]string{strconv.Itoa(c.User), c.Name, c.Department, c.Note})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readContacts reads an export of the address book: JSON with avatars or CSV without them.
+func readContacts(data []byte, csvFile bool) ([]qds.Contact, error) {
+	if !csvFile {
+		var list []qds.Contact
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var list []qds.Contact
+	for i, r := range records {
+		if len(r) < 2 {
+			return nil, fmt.Errorf("line %d: expected user,name[,department,note]", i+1)
+		}
+		u, err := strconv.Atoi(strings.TrimSpace(r[0]))
+		if err != nil {
+			if i == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		c := qds.Contact{User: u, Name: r[1]}
+		if len(r) > 2 {
+			c.Department = r[2]
+		}
+		if len(r) > 3 {
+			c.Note = r[3]
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// mergeContacts puts the imported contacts into book, replacing those with the same number.
+// Contacts of users center.bin doesn't have are skipped.
+func mergeContacts(book map[int]qds.Contact, imported []qds.Contact) (added, skipped int) {
+	for _, c := range imported {
+		c.Name = strings.TrimSpace(c.Name)
+		if c.User < 1 || c.User > keyring.Users() || c.Name == "" || len(c.Avatar) > maxAvatarSize {
+			skipped++
+			continue
+		}
+		if old, ok := book[c.User]; ok && c.Avatar == nil {
+			c.Avatar = old.Avatar
+		}
+		book[c.User] = c
+		added++
+	}
+	return added, skipped
+}
+
+func avatarImage(c qds.Contact) *canvas.Image {
+	var img *canvas.Image
+	if len(c.Avatar) > 0 {
+		img = canvas.NewImageFromResource(fyne.NewStaticResource(fmt.Sprintf("avatar%d", c.User), c.Avatar))
+	} else {
+		img = canvas.NewImageFromFile("assets/avatar.png")
+	}
+	img.FillMode = canvas.ImageFillContain
+	return img
+}
+
+// ShowAddressBookWindow edits the names, departments, notes and pictures of the users of center.bin.
+func ShowAddressBookWindow(win fyne.Window, logs *widget.RichText) {
+	addressBookMu.Lock()
+	loadErr := addressBookErr
+	book := make(map[int]qds.Contact, len(addressBook))
+	for u, c := range addressBook {
+		book[u] = c
+	}
+	addressBookMu.Unlock()
+	if loadErr != nil {
+		dialog.ShowError(fmt.Errorf(tr("contacts_load_error"), localizeError(loadErr)), win)
+		return
+	}
+
+	save := func() bool {
+		if err := keyring.SaveContacts(sortedContacts(book)); err != nil {
+			dialog.ShowError(fmt.Errorf(tr("contacts_save_error"), err), win)
+			return false
+		}
+		addressBookMu.Lock()
+		addressBook = contactsByUser(sortedContacts(book))
+		addressBookMu.Unlock()
+		refreshUserOptions()
+		return true
+	}
+
+	var shown []int
+	search := widget.NewEntry()
+	search.SetPlaceHolder(tr("contacts_search_hint"))
+	list := widget.NewList(
+		func() int { return len(shown) },
+		func() fyne.CanvasObject {
+			img := canvas.NewImageFromResource(theme.AccountIcon())
+			img.SetMinSize(fyne.NewSize(32, 32))
+			l := widget.NewLabel("")
+			l.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, img, nil, l)
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			u := shown[id]
+			c := book[u+1]
+			row := o.(*fyne.Container)
+			text := strconv.Itoa(u + 1)
+			if c.Name != "" {
+				text += " — " + c.Name
+			}
+			if c.Department != "" {
+				text += "  •  " + c.Department
+			}
+			row.Objects[0].(*widget.Label).SetText(text)
+			img := row.Objects[1].(*canvas.Image)
+			next := avatarImage(c)
+			img.Resource, img.File = next.Resource, next.File
+			img.Refresh()
+		},
+	)
+	filter := func() {
+		q := strings.ToLower(strings.TrimSpace(search.Text))
+		shown = shown[:0]
+		for u := 0; u < keyring.Users(); u++ {
+			c := book[u+1]
+			text := strings.ToLower(strings.Join([]string{strconv.Itoa(u + 1), c.Name, c.Department, c.Note}, " "))
+			if q == "" || strings.Contains(text, q) {
+				shown = append(shown, u)
+			}
+		}
+		list.UnselectAll()
+		list.Refresh()
+	}
+	search.OnChanged = func(string) { filter() }
+
+	current := -1
+	var avatar []byte
+	nameEntry := widget.NewEntry()
+	deptEntry := widget.NewEntry()
+	noteEntry := widget.NewMultiLineEntry()
+	noteEntry.Wrapping = fyne.TextWrapWord
+	noteEntry.SetMinRowsVisible(4)
+	titleLbl := widget.NewLabelWithStyle(tr("contacts_pick_user"), fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	avatarBox := container.NewGridWrap(fyne.NewSize(96, 96), avatarImage(qds.Contact{}))
+	showAvatar := func() {
+		avatarBox.Objects = []fyne.CanvasObject{avatarImage(qds.Contact{User: current + 1, Avatar: avatar})}
+		avatarBox.Refresh()
+	}
+
+	pickBtn := widget.NewButtonWithIcon(tr("contacts_choose_picture"), theme.FileImageIcon(), func() {
+		d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil || r == nil {
+				return
+			}
+			defer r.Close()
+			data, err := io.ReadAll(io.LimitReader(r, maxAvatarSize+1))
+			if err != nil {
+				dialog.ShowError(fmt.Errorf(tr("read_error"), err), win)
+				return
+			}
+			if len(data) > maxAvatarSize {
+				dialog.ShowError(fmt.Errorf(tr("contacts_picture_too_big"), maxAvatarSize>>10), win)
+				return
+			}
+			avatar = data
+			showAvatar()
+		}, win)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{".png", ".jpg", ".jpeg"}))
+		d.Show()
+	})
+	clearPicBtn := widget.NewButtonWithIcon(tr("contacts_remove_picture"), theme.DeleteIcon(), func() {
+		avatar = nil
+		showAvatar()
+	})
+	saveBtn := widget.NewButtonWithIcon(tr("save"), theme.DocumentSaveIcon(), func() {
+		if current < 0 {
+			return
+		}
+		c := qds.Contact{
+			User:       current + 1,
+			Name:       strings.TrimSpace(nameEntry.Text),
+			Department: strings.TrimSpace(deptEntry.Text),
+			Note:       strings.TrimSpace(noteEntry.Text),
+			Avatar:     avatar,
+		}
+		old, had := book[c.User]
+		if c.Name == "" && c.Department == "" && c.Note == "" && c.Avatar == nil {
+			delete(book, c.User)
+		} else {
+			book[c.User] = c
+		}
+		if !save() {
+			if had {
+				book[c.User] = old
+			} else {
+				delete(book, c.User)
+			}
+			return
+		}
+		addLog(logs, fmt.Sprintf(tr("contacts_saved"), userLabel(current)))
+		list.Refresh()
+	})
+	editor := container.NewVBox(
+		titleLbl,
+		container.NewHBox(avatarBox, container.NewVBox(pickBtn, clearPicBtn)),
+		widget.NewForm(
+			widget.NewFormItem(tr("contacts_name"), nameEntry),
+			widget.NewFormItem(tr("contacts_department"), deptEntry),
+			widget.NewFormItem(tr("contacts_note"), noteEntry),
+		),
+		container.NewHBox(layout.NewSpacer(), saveBtn),
+	)
+	for _, w := range []fyne.Disableable{nameEntry, deptEntry, noteEntry, pickBtn, clearPicBtn, saveBtn} {
+		w.Disable()
+	}
+	list.OnSelected = func(id widget.ListItemID) {
+		current = shown[id]
+		c := book[current+1]
+		titleLbl.SetText(fmt.Sprintf(tr("user_n"), current+1))
+		nameEntry.SetText(c.Name)
+		deptEntry.SetText(c.Department)
+		noteEntry.SetText(c.Note)
+		avatar = c.Avatar
+		showAvatar()
+		for _, w := range []fyne.Disableable{nameEntry, deptEntry, noteEntry, pickBtn, clearPicBtn, saveBtn} {
+			w.Enable()
+		}
+	}
+	filter()
+
+	exportBtn := widget.NewButtonWithIcon(tr("contacts_export"), theme.UploadIcon(), func() {
+		snapshot := sortedContacts(book)
+		d := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				addLog(logs, fmt.Sprintf(tr("save_error"), err))
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+			if strings.EqualFold(writer.URI().Extension(), ".csv") {
+				err = writeContactsCSV(writer, snapshot)
+			} else {
+				enc := json.NewEncoder(writer)
+				enc.SetIndent("", "  ")
+				err = enc.Encode(snapshot)
+			}
+			if err != nil {
+				dialog.ShowError(fmt.Errorf(tr("save_error"), err), win)
+				return
+			}
+			addLog(logs, fmt.Sprintf(tr("contacts_exported"), len(snapshot), writer.URI().Name()))
+		}, win)
+		d.SetFileName("contacts.json")
+		d.Show()
+	})
+	importBtn := widget.NewButtonWithIcon(tr("contacts_import"), theme.DownloadIcon(), func() {
+		d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil || r == nil {
+				return
+			}
+			defer r.Close()
+			data, err := io.ReadAll(io.LimitReader(r, 64<<20))
+			if err != nil {
+				dialog.ShowError(fmt.Errorf(tr("read_error"), err), win)
+				return
+			}
+			imported, err := readContacts(data, strings.EqualFold(r.URI().Extension(), ".csv"))
+			if err != nil {
+				dialog.ShowError(fmt.Errorf(tr("contacts_import_error"), err), win)
+				return
+			}
+			before := sortedContacts(book)
+			added, skipped := mergeContacts(book, imported)
+			if !save() {
+				book = contactsByUser(before)
+				return
+			}
+			addLog(logs, fmt.Sprintf(tr("contacts_imported"), added, skipped))
+			filter()
+		}, win)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{".json", ".csv"}))
+		d.Show()
+	})
+
+	split := container.NewHSplit(
+		container.NewBorder(search, nil, nil, nil, list),
+		container.NewVScroll(editor),
+	)
+	split.Offset = 0.45
+	bottom := container.NewHBox(layout.NewSpacer(), importBtn, exportBtn)
+
+	bg := canvas.NewImageFromFile("assets/background.png")
+	bg.FillMode = canvas.ImageFillStretch
+	dlg := dialog.NewCustom(tr("address_book"), tr("close"), container.NewStack(bg, container.NewPadded(container.NewBorder(nil, bottom, nil, nil, split))), win)
+	dlg.Resize(fyne.NewSize(900, 600))
+	dlg.Show()
+}
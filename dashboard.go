@@ -0,0 +1,245 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// The forecast spreads the session keys left over the pace of the last forecastWindow in the journal.
+const (
+	forecastWindow          = 30 * 24 * time.Hour
+	defaultDashboardWarning = 10
+)
+
+type inventoryRow struct {
+	User     int // counted from 0
+	In, Out  int
+	Last     time.Time
+	Forecast int // days until IN or OUT runs out, -1 when the keys are not being used
+}
+
+func (r inventoryRow) low(threshold int) bool { return min(r.In, r.Out) < threshold }
+
+// userInventory puts the keys left of every user next to what the journal tells about them.
+func userInventory(counts []qds.KeyCount, entries []qds.JournalEntry, now time.Time) []inventoryRow {
+	rows := make([]inventoryRow, len(counts))
+	used := make([][2]int, len(counts))
+	since := now.Add(-forecastWindow)
+	first := now
+	for _, e := range entries {
+		u := e.Peer - 1
+		if u < 0 || u >= len(rows) {
+			continue
+		}
+		if e.Time.After(rows[u].Last) {
+			rows[u].Last = e.Time
+		}
+		if e.KeyType == "circle" || e.Time.Before(since) {
+			continue
+		}
+		if e.Time.Before(first) {
+			first = e.Time
+		}
+		if e.Direction == qds.DirectionIn {
+			used[u][0]++
+		} else {
+			used[u][1]++
+		}
+	}
+	days := max(now.Sub(first).Hours()/24, 1)
+
+	for i, c := range counts {
+		rows[i].User, rows[i].In, rows[i].Out, rows[i].Forecast = c.User, c.In, c.Out, -1
+		for d, left := range [2]int{c.In, c.Out} {
+			if used[i][d] == 0 {
+				continue
+			}
+			n := int(math.Floor(float64(left) / (float64(used[i][d]) / days)))
+			if rows[i].Forecast < 0 || n < rows[i].Forecast {
+				rows[i].Forecast = n
+			}
+		}
+	}
+	return rows
+}
+
+func dashboardThreshold() int {
+	return fyne.CurrentApp().Preferences().IntWithFallback("dashboard_threshold", defaultDashboardWarning)
+}
+
+func formatLastActivity(t time.Time) string {
+	if t.IsZero() {
+		return tr("dash_never")
+	}
+	return t.Local().Format("02.01.2006 15:04")
+}
+
+func formatForecast(r inventoryRow) string {
+	switch {
+	case r.In == 0 || r.Out == 0:
+		return tr("dash_depleted")
+	case r.Forecast < 0:
+		return "—"
+	}
+	return fmt.Sprintf(tr("dash_days"), r.Forecast)
+}
+
+func writeInventoryCSV(w io.Writer, rows []inventoryRow, threshold int) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"user", "in", "out", "last_activity", "forecast_days", "low"})
+	for _, r := range rows {
+		last := ""
+		if !r.Last.IsZero() {
+			last = r.Last.Format("2006-01-02T15:04:05Z07:00")
+		}
+		forecast := ""
+		if r.Forecast >= 0 {
+			forecast = strconv.Itoa(r.Forecast)
+		}
+		cw.Write([]string{
+			strconv.Itoa(r.User + 1),
+			strconv.Itoa(r.In),
+			strconv.Itoa(r.Out),
+			last,
+			forecast,
+			strconv.FormatBool(r.low(threshold)),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ShowDashboardWindow lists the session keys left of every user of center.bin with the last
+// activity and a forecast from the journal; users below the threshold are highlighted.
+func ShowDashboardWindow(win fyne.Window, logs *widget.RichText) {
+	var rows []inventoryRow
+	statusLbl := widget.NewLabel("")
+	statusLbl.Wrapping = fyne.TextWrapWord
+	statusLbl.TextStyle.Italic = true
+	load := func() {
+		entries, err := keyring.ReadJournal()
+		rows = userInventory(keyring.Status().SessionKeys, entries, time.Now())
+		statusLbl.SetText(tr("dash_hint"))
+		if err != nil {
+			statusLbl.SetText(fmt.Sprintf(tr("journal_error"), err))
+		}
+	}
+	load()
+
+	threshold := dashboardThreshold()
+	headers := []string{tr("dash_user"), tr("dash_in"), tr("dash_out"), tr("dash_last"), tr("dash_forecast")}
+	table := widget.NewTable(
+		func() (int, int) { return len(rows), len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			r := rows[id.Row]
+			l := o.(*widget.Label)
+			l.TextStyle.Bold = r.low(threshold)
+			l.Importance = widget.MediumImportance
+			if r.low(threshold) {
+				l.Importance = widget.DangerImportance
+			}
+			switch id.Col {
+			case 0:
+				l.SetText(userLabel(r.User))
+			case 1:
+				l.SetText(strconv.Itoa(r.In))
+			case 2:
+				l.SetText(strconv.Itoa(r.Out))
+			case 3:
+				l.SetText(formatLastActivity(r.Last))
+			default:
+				l.SetText(formatForecast(r))
+			}
+		},
+	)
+	table.ShowHeaderRow = true
+	table.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	}
+	table.UpdateHeader = func(id widget.TableCellID, o fyne.CanvasObject) {
+		o.(*widget.Label).SetText(headers[id.Col])
+	}
+	for i, w := range []float32{110, 90, 90, 170, 170} {
+		table.SetColumnWidth(i, w)
+	}
+
+	lowLbl := widget.NewLabel("")
+	countLow := func() {
+		n := 0
+		for _, r := range rows {
+			if r.low(threshold) {
+				n++
+			}
+		}
+		lowLbl.SetText(fmt.Sprintf(tr("dash_low_count"), n, len(rows)))
+	}
+	countLow()
+
+	thresholdEntry := widget.NewEntry()
+	thresholdEntry.SetText(strconv.Itoa(threshold))
+	thresholdEntry.OnChanged = func(s string) {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			return
+		}
+		threshold = n
+		fyne.CurrentApp().Preferences().SetInt("dashboard_threshold", n)
+		countLow()
+		table.Refresh()
+	}
+
+	refreshBtn := widget.NewButtonWithIcon(tr("dash_refresh"), theme.ViewRefreshIcon(), func() {
+		load()
+		countLow()
+		table.Refresh()
+	})
+	exportBtn := widget.NewButtonWithIcon(tr("dash_export"), theme.DocumentSaveIcon(), func() {
+		snapshot, limit := rows, threshold
+		d := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				addLog(logs, fmt.Sprintf(tr("save_error"), err))
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+			if err := writeInventoryCSV(writer, snapshot, limit); err != nil {
+				dialog.ShowError(fmt.Errorf(tr("save_error"), err), win)
+				return
+			}
+			addLog(logs, fmt.Sprintf(tr("dash_exported"), writer.URI().Name()))
+		}, win)
+		d.SetFileName("keys_" + time.Now().Format("2006-01-02") + ".csv")
+		d.Show()
+	})
+
+	top := container.NewVBox(
+		statusLbl,
+		container.NewHBox(widget.NewLabel(tr("dash_threshold")),
+			container.NewGridWrap(fyne.NewSize(80, 36), thresholdEntry),
+			layout.NewSpacer(), lowLbl),
+	)
+	bottom := container.NewHBox(layout.NewSpacer(), refreshBtn, exportBtn)
+
+	bg := canvas.NewImageFromFile("assets/background.png")
+	bg.FillMode = canvas.ImageFillStretch
+	d := dialog.NewCustom(tr("dashboard"), tr("close"), container.NewStack(bg, container.NewPadded(container.NewBorder(top, bottom, nil, nil, table))), win)
+	d.Resize(fyne.NewSize(760, 600))
+	d.Show()
+}
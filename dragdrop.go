@@ -0,0 +1,93 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// isDroppedContainer tells containers, armored ones and volumes from files to encrypt.
+func isDroppedContainer(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".bin", qds.ArmorExt:
+		return true
+	}
+	return isVolumeFile(path)
+}
+
+// handleDroppedURIs decrypts dropped containers and encrypts anything else with the key type
+// and recipients chosen in the window: one file directly, several files, folders or a mix
+// through the list of ShowMultiEncryptWindow.
+func handleDroppedURIs(win fyne.Window, logs *widget.RichText, keysLeft *widget.Label, uris []fyne.URI) {
+	if keyring == nil {
+		dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+		return
+	}
+
+	var paths, containers []string
+	dirs := false
+	for _, u := range uris {
+		if u.Scheme() != "file" {
+			addLog(logs, fmt.Sprintf(tr("drop_not_local"), u.String()))
+			continue
+		}
+		p := u.Path()
+		st, err := os.Stat(p)
+		if err != nil {
+			addLog(logs, fmt.Sprintf(tr("open_error"), err))
+			continue
+		}
+		paths = append(paths, p)
+		if st.IsDir() {
+			dirs = true
+		} else if isDroppedContainer(p) {
+			containers = append(containers, p)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	addLog(logs, fmt.Sprintf(tr("dropped_items"), len(paths)))
+
+	if len(containers) == len(paths) {
+		seen := map[string]bool{}
+		for _, p := range containers {
+			if isVolumeFile(p) {
+				if base := volumeBaseName(p); !seen[base] {
+					seen[base] = true
+					decryptVolumeSet(win, logs, p)
+				}
+				continue
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				addLog(logs, fmt.Sprintf(tr("open_error"), err))
+				continue
+			}
+			decryptContainerReader(win, logs, f, p)
+			f.Close()
+		}
+		return
+	}
+
+	if !hasEncryptionKeys() {
+		dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+		return
+	}
+	if len(paths) == 1 && !dirs {
+		f, err := os.Open(paths[0])
+		if err != nil {
+			addLog(logs, fmt.Sprintf(tr("open_error"), err))
+			return
+		}
+		go encryptSingleFile(win, logs, keysLeft, f, paths[0], filepath.Base(paths[0]))
+		return
+	}
+	ShowMultiEncryptWindow(win, logs, keysLeft, paths)
+}
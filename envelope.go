@@ -0,0 +1,149 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"fyne.io/fyne/v2/widget"
+)
+
+// localizeError turns the errors of the qds package into messages for the log and dialogs.
+func localizeError(err error) error {
+	var us *qds.UnknownSenderError
+	var ae *qds.ArmorError
+	var ce *qds.ChecksumError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &us):
+		return fmt.Errorf(tr("unknown_sender"), us.Owner)
+	case errors.As(err, &ae):
+		return fmt.Errorf(tr("armor_error"), ae.Err)
+	case errors.As(err, &ce):
+		return fmt.Errorf(tr("qpkg_damaged_files"), ce.Name)
+	}
+
+	keys := []struct {
+		err error
+		key string
+	}{
+		{qds.ErrWrongPassword, "file_corrupted"},
+		{qds.ErrTooShort, "file_too_short"},
+		{qds.ErrTooBig, "file_too_big"},
+		{qds.ErrCorrupted, "file_corrupted"},
+		{qds.ErrHeaderImit, "file_info_imit_mismatch"},
+		{qds.ErrNoIV, "invalid_file_no_iv"},
+		{qds.ErrTruncated, "invalid_file_not_enough_data"},
+		{qds.ErrOwnContainer, "center_file_decrypt_on_recipient"},
+		{qds.ErrNotRecipient, "not_a_recipient"},
+		{qds.ErrBadSession, "invalid_session_index"},
+		{qds.ErrKeyUsed, "decryption_key_not_available"},
+		{qds.ErrContactsBroken, "contacts_broken"},
+		{qds.ErrPasswordReused, "password_reused_short"},
+		{qds.ErrKeysInUse, "keys_in_use"},
+		{qds.ErrPayloadClosed, "payload_closed"},
+		{qds.ErrKeysWiped, "keys_wiped"},
+		{qds.ErrAttemptsBroken, "signin_record_broken_short"},
+		{context.Canceled, "job_canceled"},
+	}
+	for _, k := range keys {
+		if errors.Is(err, k.err) {
+			return errors.New(tr(k.key))
+		}
+	}
+	return err
+}
+
+// encryptOptions fills the options from the window; j, if not nil, gets the progress and can cancel.
+func encryptOptions(fileTypeCode byte, useSession bool, targets []int, j *job) qds.EncryptOptions {
+	opts := qds.EncryptOptions{
+		Recipients: targets,
+		Circle:     !useSession,
+		FileType:   fileTypeCode,
+		Compress:   compressEnabled,
+	}
+	if j != nil {
+		opts.Progress, opts.Context = j.progress, j.ctx
+	}
+	return opts
+}
+
+// buildContainer encrypts data in memory with the current keyring, compressing it when enabled and useful.
+func buildContainer(logs *widget.RichText, data []byte, fileTypeCode byte, message bool, useSession bool, targets []int, j *job) (*bytes.Buffer, *qds.EncryptResult, error) {
+	opts := encryptOptions(fileTypeCode, useSession, targets, j)
+	opts.Message = message
+	out := &bytes.Buffer{}
+	res, err := keyring.EncryptFile(out, bytes.NewReader(data), opts)
+	if err != nil {
+		return nil, nil, localizeError(err)
+	}
+	if res.Compressed {
+		uiLog(logs, compressionRatioText(res.PlainSize, res.StoredSize))
+	}
+	return out, res, nil
+}
+
+// buildQpkgContainer packs entries into a package and encrypts it like buildContainer.
+// The sources have all been read once it returns.
+func buildQpkgContainer(logs *widget.RichText, entries []qds.Entry, useSession bool, targets []int, j *job) (*bytes.Buffer, *qds.EncryptResult, error) {
+	out := &bytes.Buffer{}
+	res, err := keyring.EncryptArchive(out, entries, encryptOptions(qds.FileTypeGeneric, useSession, targets, j))
+	if err != nil {
+		return nil, nil, localizeError(err)
+	}
+	if res.Compressed {
+		uiLog(logs, compressionRatioText(res.PlainSize, res.StoredSize))
+	}
+	return out, res, nil
+}
+
+// openPayloads are the unlocked containers in use with the number of holders of each. The
+// last one to let go wipes the key of the container; a lock wipes them all.
+var (
+	payloadsMu   sync.Mutex
+	openPayloads = map[*qds.Payload]int{}
+)
+
+// openContainer verifies a container with the current keyring and finds its key.
+// Session keys are used up and saved. The payload is held for the caller, who releases it.
+func openContainer(data []byte) (*qds.Payload, error) {
+	c, err := keyring.OpenContainer(data)
+	if err != nil {
+		return nil, localizeError(err)
+	}
+	p, err := keyring.Unlock(c)
+	if err != nil {
+		return nil, localizeError(err)
+	}
+	holdPayload(p)
+	return p, nil
+}
+
+func holdPayload(p *qds.Payload) {
+	payloadsMu.Lock()
+	openPayloads[p]++
+	payloadsMu.Unlock()
+}
+
+func releasePayload(p *qds.Payload) {
+	payloadsMu.Lock()
+	defer payloadsMu.Unlock()
+	if openPayloads[p]--; openPayloads[p] <= 0 {
+		delete(openPayloads, p)
+		p.Close()
+	}
+}
+
+// closePayloads wipes the keys of every payload still held.
+func closePayloads() {
+	payloadsMu.Lock()
+	defer payloadsMu.Unlock()
+	for p := range openPayloads {
+		p.Close()
+	}
+	clear(openPayloads)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+var (
+	extractPolicy      = qds.ConflictRename
+	extractToSubfolder = true
+)
+
+func loadExtractPrefs() {
+	p := fyne.CurrentApp().Preferences()
+	extractPolicy = qds.ConflictPolicy(p.IntWithFallback("extract_policy", int(qds.ConflictRename)))
+	if extractPolicy < qds.ConflictRename || extractPolicy > qds.ConflictAsk {
+		extractPolicy = qds.ConflictRename
+	}
+	extractToSubfolder = p.BoolWithFallback("extract_subfolder", true)
+}
+
+func saveExtractPrefs() {
+	p := fyne.CurrentApp().Preferences()
+	p.SetInt("extract_policy", int(extractPolicy))
+	p.SetBool("extract_subfolder", extractToSubfolder)
+}
+
+func conflictPolicyOptions() []string {
+	return []string{tr("conflict_rename"), tr("conflict_overwrite"), tr("conflict_skip"), tr("conflict_ask")}
+}
+
+func conflictPolicyLabel(p qds.ConflictPolicy) string {
+	opts := conflictPolicyOptions()
+	if int(p) < 0 || int(p) >= len(opts) {
+		return opts[0]
+	}
+	return opts[p]
+}
+
+func labelToConflictPolicy(s string) qds.ConflictPolicy {
+	for i, o := range conflictPolicyOptions() {
+		if o == s {
+			return qds.ConflictPolicy(i)
+		}
+	}
+	return qds.ConflictRename
+}
+
+// archiveFolderName is the subfolder name for an archive: "docs_2024.bin" -> "docs_2024".
+func archiveFolderName(srcPath string) string {
+	b := baseName(volumeBaseName(srcPath))
+	for _, ext := range []string{qds.ArmorExt, ".bin"} {
+		if strings.EqualFold(filepath.Ext(b), ext) {
+			b = b[:len(b)-len(ext)]
+		}
+	}
+	return qds.SanitizeFileName(b)
+}
+
+// makeExtractFolder creates a fresh folder for the archive under dest.
+func makeExtractFolder(dest, srcPath string) (string, error) {
+	p := qds.UniquePath(filepath.Join(dest, archiveFolderName(srcPath)))
+	if err := os.Mkdir(p, 0o755); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// askConflict shows the per-file question on the UI thread and waits for the answer, or
+// until job j is canceled, which takes the question away and stops the extraction.
+func askConflict(win fyne.Window, j *job) func(name string) (qds.ConflictPolicy, bool, error) {
+	return func(name string) (qds.ConflictPolicy, bool, error) {
+		type answer struct {
+			action qds.ConflictPolicy
+			all    bool
+		}
+		ch := make(chan answer, 1)
+
+		var d *dialog.CustomDialog
+		runOnMain(func() {
+			allCheck := widget.NewCheck(tr("apply_to_all"), nil)
+			reply := func(a qds.ConflictPolicy) func() {
+				return func() {
+					d.Hide()
+					ch <- answer{a, allCheck.Checked}
+				}
+			}
+			msg := widget.NewLabel(fmt.Sprintf(tr("file_exists_question"), name))
+			msg.Wrapping = fyne.TextWrapWord
+
+			buttons := container.NewGridWithColumns(3,
+				widget.NewButton(tr("conflict_overwrite"), reply(qds.ConflictOverwrite)),
+				widget.NewButton(tr("conflict_rename"), reply(qds.ConflictRename)),
+				widget.NewButton(tr("conflict_skip"), reply(qds.ConflictSkip)),
+			)
+			d = dialog.NewCustomWithoutButtons(tr("file_exists"), container.NewVBox(msg, allCheck, buttons), win)
+			d.Resize(fyne.NewSize(520, 200))
+			d.Show()
+		})
+
+		// waiting for an answer is not activity that keeps the session unlocked
+		j.setAsking(true)
+		defer j.setAsking(false)
+		select {
+		case a := <-ch:
+			return a.action, a.all, nil
+		case <-j.ctx.Done():
+			runOnMain(func() { d.Hide() })
+			return qds.ConflictSkip, false, j.ctx.Err()
+		}
+	}
+}
+
+func summaryList(title string, names []string) string {
+	const maxShown = 10
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d\n", title, len(names))
+	for i, n := range names {
+		if i == maxShown {
+			fmt.Fprintf(&b, "  … +%d\n", len(names)-maxShown)
+			break
+		}
+		b.WriteString("  " + n + "\n")
+	}
+	return b.String()
+}
+
+func showUnpackSummary(win fyne.Window, logs *widget.RichText, dest string, s *qds.UnpackSummary) {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(tr("extracted_to"), dest) + "\n\n")
+	b.WriteString(summaryList(tr("summary_written"), s.Written))
+	if len(s.Overwritten) > 0 {
+		b.WriteString(summaryList(tr("summary_overwritten"), s.Overwritten))
+	}
+	if len(s.Renamed) > 0 {
+		b.WriteString(summaryList(tr("summary_renamed"), s.Renamed))
+	}
+	if len(s.Skipped) > 0 {
+		b.WriteString(summaryList(tr("summary_skipped"), s.Skipped))
+	}
+	if len(s.Damaged) > 0 {
+		b.WriteString(summaryList(tr("summary_damaged"), s.Damaged))
+	}
+
+	addLog(logs, fmt.Sprintf(tr("summary_log"),
+		len(s.Written), len(s.Overwritten), len(s.Renamed), len(s.Skipped), len(s.Damaged)))
+	if len(s.Damaged) > 0 {
+		addLog(logs, fmt.Sprintf(tr("qpkg_damaged_files"), strings.Join(s.Damaged, ", ")))
+	}
+
+	text := widget.NewLabel(b.String())
+	text.Wrapping = fyne.TextWrapWord
+	scroll := container.NewVScroll(text)
+	scroll.SetMinSize(fyne.NewSize(560, 300))
+
+	d := dialog.NewCustom(tr("extract_summary"), tr("close"), scroll, win)
+	d.Resize(fyne.NewSize(620, 420))
+	d.Show()
+}
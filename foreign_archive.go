@@ -0,0 +1,289 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+)
+
+const (
+	exportZip   = "ZIP"
+	exportTarGz = "TAR.GZ"
+)
+
+var foreignArchiveExts = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+func isForeignArchive(p string) bool {
+	l := strings.ToLower(p)
+	for _, ext := range foreignArchiveExts {
+		if strings.HasSuffix(l, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// foreignArchiveFilter shows the archives that can be imported in a file dialog. The extension
+// filter of fyne sees only the last extension, which would let any .gz through.
+type foreignArchiveFilter struct{}
+
+func (foreignArchiveFilter) Matches(u fyne.URI) bool { return isForeignArchive(u.Name()) }
+
+// foreignArchive is an imported zip or tar that feeds entry data while packing.
+// Tar has no random access, so entries are served by a forward-only reader
+// which is reopened only when an earlier entry is asked for.
+type foreignArchive struct {
+	path string
+	zip  bool
+
+	mu  sync.Mutex
+	zr  *zip.ReadCloser
+	f   *os.File
+	tr  *tar.Reader
+	pos int
+}
+
+func (a *foreignArchive) openTar() error {
+	a.closeLocked()
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = f
+	l := strings.ToLower(a.path)
+	if strings.HasSuffix(l, ".gz") || strings.HasSuffix(l, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		r = gz
+	}
+	a.f = f
+	a.tr = tar.NewReader(r)
+	a.pos = -1
+	return nil
+}
+
+func (a *foreignArchive) entry(i int) (io.ReadCloser, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.zip {
+		if a.zr == nil {
+			zr, err := zip.OpenReader(a.path)
+			if err != nil {
+				return nil, err
+			}
+			a.zr = zr
+		}
+		if i < 0 || i >= len(a.zr.File) {
+			return nil, fmt.Errorf("zip entry %d not found", i)
+		}
+		return a.zr.File[i].Open()
+	}
+
+	if a.tr == nil || i <= a.pos {
+		if err := a.openTar(); err != nil {
+			return nil, err
+		}
+	}
+	for a.pos < i {
+		if _, err := a.tr.Next(); err != nil {
+			return nil, err
+		}
+		a.pos++
+	}
+	return io.NopCloser(a.tr), nil
+}
+
+func (a *foreignArchive) closeLocked() {
+	if a.zr != nil {
+		a.zr.Close()
+		a.zr = nil
+	}
+	if a.f != nil {
+		a.f.Close()
+		a.f = nil
+	}
+	a.tr = nil
+}
+
+func (a *foreignArchive) Close() {
+	a.mu.Lock()
+	a.closeLocked()
+	a.mu.Unlock()
+}
+
+// importForeignArchive lists the regular files of a zip or tar as packable entries.
+// Entries with unsafe names are returned in skipped.
+func importForeignArchive(p string) (*foreignArchive, []qds.Entry, []string, error) {
+	a := &foreignArchive{path: p, zip: strings.HasSuffix(strings.ToLower(p), ".zip")}
+	var entries []qds.Entry
+	var skipped []string
+
+	add := func(i int, name string, size int64, e qds.Entry) {
+		name = strings.TrimPrefix(strings.ReplaceAll(name, "\\", "/"), "./")
+		if !qds.ValidEntryName(name) {
+			skipped = append(skipped, name)
+			return
+		}
+		idx := i
+		e.Name = name
+		e.Size = size
+		e.Source = func() (io.ReadCloser, error) { return a.entry(idx) }
+		entries = append(entries, e)
+	}
+
+	if a.zip {
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		defer zr.Close()
+		for i, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			add(i, f.Name, int64(f.UncompressedSize64), qds.Entry{Mode: f.Mode().Perm(), MTime: f.Modified})
+		}
+		return a, entries, skipped, nil
+	}
+
+	if err := a.openTar(); err != nil {
+		return nil, nil, nil, err
+	}
+	defer a.Close()
+	for i := 0; ; i++ {
+		h, err := a.tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		add(i, h.Name, h.Size, qds.Entry{Mode: h.FileInfo().Mode().Perm(), MTime: h.ModTime})
+	}
+	return a, entries, skipped, nil
+}
+
+// exportQpkg streams the entries of a package into a zip or tar.gz and returns how many files were written.
+// Each entry is verified before the next one starts; a damaged entry stops the export.
+func exportQpkg(r io.Reader, w io.Writer, format string, want func(*qds.Entry) bool) (int, error) {
+	q, err := qds.NewArchiveReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var zw *zip.Writer
+	var gz *gzip.Writer
+	var tw *tar.Writer
+	if format == exportZip {
+		zw = zip.NewWriter(w)
+	} else {
+		gz = gzip.NewWriter(w)
+		tw = tar.NewWriter(gz)
+	}
+
+	n := 0
+	for {
+		e, err := q.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		if want != nil && !want(e) {
+			continue
+		}
+		if !qds.ValidEntryName(e.Name) {
+			return n, fmt.Errorf("%w: %q", qds.ErrUnsafeEntry, e.Name)
+		}
+
+		var dst io.Writer
+		if zw != nil {
+			h := &zip.FileHeader{Name: e.Name, Method: zip.Deflate, Modified: e.MTime}
+			mode := e.Mode.Perm()
+			if e.Dir {
+				h.Name += "/"
+				h.Method = zip.Store
+				mode |= os.ModeDir
+			}
+			h.SetMode(mode)
+			if dst, err = zw.CreateHeader(h); err != nil {
+				return n, err
+			}
+		} else {
+			h := &tar.Header{
+				Name:    e.Name,
+				Mode:    int64(e.Mode.Perm()),
+				Size:    e.Size,
+				ModTime: e.MTime,
+				Format:  tar.FormatPAX,
+			}
+			h.Typeflag = tar.TypeReg
+			if e.Dir {
+				h.Name += "/"
+				h.Typeflag = tar.TypeDir
+			}
+			if err := tw.WriteHeader(h); err != nil {
+				return n, err
+			}
+			dst = tw
+		}
+		if e.Dir {
+			continue
+		}
+
+		// CopyN drops the error of the final Read, so ask verify for it again
+		if _, err := io.CopyN(dst, q, e.Size); err != nil {
+			return n, err
+		}
+		if err := q.Verify(); err != nil {
+			var ce *qds.ChecksumError
+			if errors.As(err, &ce) {
+				return n, fmt.Errorf(tr("qpkg_damaged_files"), e.Name)
+			}
+			return n, err
+		}
+		n++
+	}
+
+	if zw != nil {
+		return n, zw.Close()
+	}
+	if err := tw.Close(); err != nil {
+		return n, err
+	}
+	return n, gz.Close()
+}
+
+func exportFileName(srcPath, format string) string {
+	name := archiveFolderName(srcPath)
+	if format == exportZip {
+		return name + ".zip"
+	}
+	return name + ".tar.gz"
+}
+
+func importedEntryTitle(archivePath string, e qds.Entry) (string, string) {
+	dir := path.Dir(e.Name)
+	if dir == "." {
+		dir = ""
+	}
+	return path.Base(e.Name), baseName(archivePath) + ":/" + dir
+}
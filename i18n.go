@@ -83,7 +83,7 @@ var i18n = map[string]map[string]string{
 		"new_password":           "New password",
 		"confirm_password":       "Confirm password",
 		"password_rules":         "Password must meet all rules below:",
-		"rule_min_length":        "At least 10 characters",
+		"rule_min_length":        "At least %d characters",
 		"rule_upper":             "At least one uppercase letter",
 		"rule_lower":             "At least one lowercase letter",
 		"rule_digit":             "At least one digit",
@@ -105,6 +105,279 @@ var i18n = map[string]map[string]string{
 		"selected":         "Selected",
 		"size":             "Size",
 		"nothing_selected": "Nothing selected",
+		//Multi recipients
+		"several_recipients":       "Several...",
+		"select_recipients":        "Select recipients",
+		"select_all":               "Select all",
+		"select_none":              "Clear selection",
+		"n_recipients":             "%d recipients",
+		"encrypted_for_recipients": "Encrypted for: %s",
+		"not_a_recipient":          "This file was not encrypted for this user",
+		//Compression
+		"options":                 "Options",
+		"compress_before_encrypt": "Compress before encryption",
+		"compression_ratio":       "Compression: %s → %s (%.1f×)",
+		//Armored text
+		"armored_output":        "Text (armored) output",
+		"armor_error":           "Armored text error: %v",
+		"armor_not_found":       "No armored message found in the text",
+		"decrypt_choose_source": "Choose what to decrypt",
+		"from_file":             "From file",
+		"from_text":             "Pasted text",
+		"paste_from_clipboard":  "Paste from clipboard",
+		//Messages
+		"messages":             "Messages",
+		"messages_card_hint":   "Write or read an encrypted text message",
+		"messages_choose_mode": "What would you like to do?",
+		"new_message":          "New message",
+		"read_message":         "Read message",
+		"message_placeholder":  "Type the message text here…",
+		"output_format":        "Output",
+		"format_armored":       "Text to copy",
+		"format_binary":        ".bin file",
+		"message_empty":        "The message is empty",
+		"message_too_long":     "The message is too long",
+		"message_encrypted":    "Message encrypted",
+		"message_decrypted":    "Message decrypted (not saved to disk)",
+		"not_a_message":        "This is not a text message, use Decrypt → From file",
+		//Volumes
+		"split_volumes":        "Volumes:",
+		"volumes_off":          "Do not split",
+		"volumes_written":      "Saved %d volumes: %s … %s",
+		"volumes_joined":       "Volumes joined: %d",
+		"volume_missing":       "Volume %s is missing",
+		"volume_foreign":       "Volume %s belongs to another set",
+		"volume_damaged":       "Volume %s is damaged",
+		"volume_size_mismatch": "Joined volumes size does not match the header",
+		"qpkg_damaged_files":   "Damaged files were not extracted: %s",
+		//Archive browser
+		"archive_contents":   "Archive contents",
+		"reading_archive":    "Reading archive…",
+		"extract_all":        "Extract all…",
+		"extract_selected":   "Extract selected…",
+		"save_entry_as":      "Save as…",
+		"select_entry_first": "Select a file in the list first",
+		//Extraction conflicts
+		"if_file_exists":       "If a file exists:",
+		"conflict_rename":      "Rename",
+		"conflict_overwrite":   "Overwrite",
+		"conflict_skip":        "Skip",
+		"conflict_ask":         "Ask",
+		"extract_to_subfolder": "Into new folder \"%s\"",
+		"file_exists":          "File exists",
+		"file_exists_question": "\"%s\" already exists. What should be done?",
+		"apply_to_all":         "Apply to all remaining conflicts",
+		"extract_summary":      "Extraction summary",
+		"extracted_to":         "Extracted to: %s",
+		"summary_written":      "Written",
+		"summary_overwritten":  "Overwritten",
+		"summary_renamed":      "Renamed",
+		"summary_skipped":      "Skipped",
+		"summary_damaged":      "Damaged, not extracted",
+		"summary_log":          "Extracted: %d written, %d overwritten, %d renamed, %d skipped, %d damaged",
+		//ZIP / TAR
+		"export_archive":        "Export…",
+		"export_format":         "Archive format:",
+		"exported_entries":      "Exported %d files to %s",
+		"import_archive":        "Import ZIP/TAR",
+		"import_unsupported":    "Only .zip, .tar, .tar.gz and .tgz can be imported",
+		"import_error":          "Import error: %v",
+		"import_skipped_unsafe": "Skipped entry with unsafe path: %s",
+		"imported_entries":      "Imported %d files from %s",
+		//Watch folders
+		"watch_folders":         "Watch folders",
+		"watch_outbox":          "Outbox (to encrypt):",
+		"watch_inbox":           "Inbox (to decrypt):",
+		"watch_plain":           "Decrypted files to:",
+		"watch_hint":            "Files put into a recipient subfolder of the outbox (%s) are encrypted with the next session key into its \"encrypted\" folder. Containers (.bin) put into the inbox are decrypted. Originals are moved to \"processed\", failed files to \"quarantine\".",
+		"watch_start":           "Start",
+		"watch_stop":            "Stop",
+		"watch_status_on":       "Watching the folders",
+		"watch_status_off":      "Not watching",
+		"watch_started":         "Watch folders started",
+		"watch_stopped":         "Watch folders stopped",
+		"watch_no_folders":      "Choose an outbox or an inbox folder",
+		"watch_no_plain_folder": "Choose the folder for decrypted files",
+		"watch_same_folders":    "The outbox, inbox and decrypted files folders must be different",
+		"watch_error":           "Watch folders: %v",
+		"watch_failed":          "%s: %v",
+		"watch_quarantined":     "Moved to quarantine: %s",
+		"watch_encrypted":       "%s encrypted for %s: %s",
+		"watch_decrypted":       "%s decrypted: %s",
+		//Local API
+		"local_api":          "Local API",
+		"api_policy":         "Requests:",
+		"api_policy_ask":     "Confirm every request",
+		"api_policy_read":    "Allow inspect and key status, confirm the rest",
+		"api_policy_all":     "Allow all requests",
+		"api_hint":           "Programs on this computer can encrypt, decrypt and inspect files through http://127.0.0.1 while you are signed in. The address and the access token of this session are in %s.",
+		"api_status_on":      "Listening on %s",
+		"api_status_off":     "Stopped",
+		"api_started":        "Local API started on %s",
+		"api_stopped":        "Local API stopped",
+		"api_error":          "Local API: %v",
+		"api_confirm_title":  "Local API request",
+		"api_confirm":        "%s asks to %s. Allow?",
+		"api_allow":          "Allow",
+		"api_deny":           "Deny",
+		"api_denied":         "The request was denied",
+		"api_request_log":    "Local API, %s: %s",
+		"api_request_denied": "Local API, %s: %s — denied",
+		"api_op_encrypt":     "encrypt %s (%s) for %s",
+		"api_op_decrypt":     "decrypt %s (%s, %s)",
+		"api_op_inspect":     "inspect a container",
+		"api_op_keys":        "read the key status",
+		"api_kind_file":      "file",
+		"api_kind_message":   "message",
+		"api_kind_archive":   "archive",
+		//Drag and drop
+		"dropped_items":  "Dropped: %d item(s)",
+		"drop_not_local": "Not a local file, skipped: %s",
+		//Jobs
+		"jobs":             "Jobs",
+		"clear_finished":   "Clear finished",
+		"job_queued":       "Waiting in the queue…",
+		"job_done":         "Done in %s",
+		"job_failed":       "Failed: %v",
+		"job_canceled":     "Canceled",
+		"job_left":         "%s left",
+		"job_encrypt":      "Encrypt %s",
+		"job_decrypt":      "Decrypt %s",
+		"job_save":         "Save %s",
+		"job_read_archive": "Read archive %s",
+		"job_extract":      "Extract %s",
+		"job_export":       "Export %s",
+		"job_pasted":       "pasted text",
+		//Journal
+		"journal":              "History",
+		"journal_error":        "Journal error: %v",
+		"journal_intact":       "Journal intact: %d records",
+		"journal_broken":       "Journal chain is broken at record %d — only the %d records before it can be trusted",
+		"journal_search_hint":  "Search: user number, file, date…",
+		"journal_shown":        "Shown %d of %d",
+		"journal_all":          "All",
+		"journal_out":          "Sent",
+		"journal_in":           "Received",
+		"journal_center":       "Center",
+		"journal_key_session":  "session",
+		"journal_key_circle":   "circle",
+		"journal_key_multi":    "multi",
+		"journal_kind_file":    "file",
+		"journal_kind_archive": "archive",
+		"journal_kind_message": "message",
+		"journal_via_window":   "window",
+		"journal_via_cli":      "command line",
+		"journal_via_watch":    "watch folder",
+		"journal_via_api":      "local API",
+		"journal_export_csv":   "Export CSV",
+		"journal_export_json":  "Export JSON",
+		"journal_exported":     "Exported %d journal records to %s",
+		//Dashboard
+		"dashboard":      "Key inventory",
+		"dash_hint":      "Session keys left per user. The forecast follows the pace of the last 30 days in the history.",
+		"dash_user":      "User",
+		"dash_in":        "IN",
+		"dash_out":       "OUT",
+		"dash_last":      "Last activity",
+		"dash_forecast":  "Runs out in",
+		"dash_days":      "≈ %d days",
+		"dash_depleted":  "run out",
+		"dash_never":     "never",
+		"dash_threshold": "Highlight below:",
+		"dash_low_count": "Low on keys: %d of %d",
+		"dash_refresh":   "Refresh",
+		"dash_export":    "Export CSV",
+		"dash_exported":  "Key inventory exported to %s",
+		//Address book
+		"address_book":             "Address book",
+		"received_from":            "Container from %s",
+		"contacts_search_hint":     "Search: number, name, department…",
+		"contacts_pick_user":       "Choose a user on the left",
+		"contacts_name":            "Name",
+		"contacts_department":      "Department",
+		"contacts_note":            "Notes",
+		"contacts_choose_picture":  "Choose picture",
+		"contacts_remove_picture":  "Remove picture",
+		"contacts_picture_too_big": "The picture is larger than %d KB",
+		"contacts_saved":           "Address book: %s saved",
+		"contacts_load_error":      "Can't read the address book: %v",
+		"contacts_save_error":      "Can't save the address book: %v",
+		"contacts_broken":          "The address book is damaged or was made for other keys",
+		"contacts_import":          "Import",
+		"contacts_export":          "Export",
+		"contacts_import_error":    "Import failed: %v",
+		"contacts_imported":        "Address book: %d contacts imported, %d skipped",
+		"contacts_exported":        "Address book: %d contacts exported to %s",
+		//Lock
+		"lock":              "Lock",
+		"lock_after":        "Lock after %d min",
+		"lock_never":        "Don't auto-lock",
+		"lock_jobs_running": "%d jobs are still running. Cancel them and lock?",
+		"locking":           "Locking…",
+		//Sign-in protection
+		"security":              "Security",
+		"auto_lock":             "Auto-lock",
+		"signin_failed":         "Wrong password or damaged key file (failed attempts: %d). Next try in %s",
+		"signin_lockout":        "Wrong password or damaged key file (failed attempts: %d). Sign-in is locked for %d min",
+		"signin_wait":           "Too many failed attempts. Try again in %s",
+		"signin_locked":         "Sign-in is locked after failed attempts. Try again in %s",
+		"signin_record_broken":  "The record of failed sign-ins has been changed or removed. Sign-in is locked for %d min",
+		"signin_wipe_warning":   "Failed attempts left before the session keys are wiped: %d",
+		"signin_wiped":          "Too many failed attempts: the session keys have been wiped. Ask the center for new keys.",
+		"signin_wipe_error":     "Can't wipe the session keys: %v",
+		"signin_failures_since": "Failed sign-in attempts since the last sign-in: %d",
+		"signin_lockout_after":  "Lock sign-in after",
+		"signin_lockout_for":    "Lock for",
+		"signin_wipe_after":     "Wipe session keys after",
+		"signin_n_failures":     "%d failed attempts",
+		"signin_n_minutes":      "%d min",
+		"signin_no_lockout":     "Never",
+		"signin_never_wipe":     "Never",
+		"signin_policy_hint":    "Every failed sign-in makes the next one wait longer. The policy is kept in the key file and applies to the command line too. Wiping destroys the session keys, as for a lost device; the circle keys open again with the new password or the one before it.",
+		"signin_policy_saved":   "Sign-in protection saved",
+		"signin_policy_error":   "Sign-in protection: %v",
+		//Password age
+		"rule_not_recent":        "Not one of the last %d passwords",
+		"password_reused":        "This password was used recently. Choose one that differs from the last %d.",
+		"password_reused_short":  "the password was used recently",
+		"password_expired":       "The password expired on %s. Please change it now.",
+		"password_expires_soon":  "The password expires on %s. Change it before then.",
+		"password_max_age":       "Password max age",
+		"password_no_max_age":    "No limit",
+		"password_n_days":        "%d days",
+		"password_max_age_saved": "Password max age set: %s",
+		"password_max_age_error": "Can't save the password max age: %v",
+		//Change password
+		"current_password":             "Current password",
+		"enter_current_password":       "Enter the current password.",
+		"current_password_wrong":       "The current password is wrong.",
+		"change_password_current_hint": "Enter the current password, then the new one.",
+		//Password strength
+		"rule_not_common":      "Not a common password",
+		"rule_no_words":        "No dictionary words such as password or love",
+		"rule_no_keyboard":     "No keyboard walks or runs such as qwerty, 1234 or abcd",
+		"rule_no_repeats":      "No repeats such as aaa or abab",
+		"rule_strength":        "Strength: %s (at least %s)",
+		"strength_very_weak":   "very weak",
+		"strength_weak":        "weak",
+		"strength_fair":        "fair",
+		"strength_strong":      "strong",
+		"strength_very_strong": "very strong",
+		"password_min_length":  "Minimum password length",
+		"password_min_score":   "Minimum password strength",
+		"password_n_chars":     "%d characters",
+		//Key file lock
+		"keys_in_use": "The key file is open in another QalqanDS window or command. Close it there first.",
+		//Sign-in record
+		"signin_record_error":        "Can't record the sign-in attempt, so signing in is refused: %v",
+		"signin_record_broken_short": "The record of failed sign-ins has been changed or removed",
+		"signin_keys_wiped":          "The session keys have already been wiped after failed attempts.",
+		"signin_keys_were_wiped":     "The session keys were wiped after failed sign-ins. Ask the center for new keys.",
+		"keys_wiped":                 "The session keys have been wiped and the key file has no earlier password to open it with. Ask the center for a new key file.",
+		//Watch folders working
+		"watch_interrupted": "Handling of the file was interrupted; its output may already be in \"encrypted\" or the plaintext folder. Put it back to handle it again.",
+		//Payload
+		"payload_closed": "The container was closed when the session was locked; open it again.",
 	},
 	"RU": {
 		"lang":            "Язык",
@@ -183,7 +456,7 @@ var i18n = map[string]map[string]string{
 		"new_password":           "Новый пароль",
 		"confirm_password":       "Подтверждение пароля",
 		"password_rules":         "Пароль должен соответствовать всем правилам:",
-		"rule_min_length":        "Не менее 10 символов",
+		"rule_min_length":        "Не менее %d символов",
 		"rule_upper":             "Хотя бы одна заглавная буква",
 		"rule_lower":             "Хотя бы одна строчная буква",
 		"rule_digit":             "Хотя бы одна цифра",
@@ -205,6 +478,279 @@ var i18n = map[string]map[string]string{
 		"selected":         "Выбрано",
 		"size":             "Размер",
 		"nothing_selected": "Ничего не выбрано",
+		//Multi recipients
+		"several_recipients":       "Несколько...",
+		"select_recipients":        "Выберите получателей",
+		"select_all":               "Выбрать всех",
+		"select_none":              "Снять выбор",
+		"n_recipients":             "Получателей: %d",
+		"encrypted_for_recipients": "Зашифровано для: %s",
+		"not_a_recipient":          "Этот файл зашифрован не для этого пользователя",
+		//Compression
+		"options":                 "Параметры",
+		"compress_before_encrypt": "Сжимать перед шифрованием",
+		"compression_ratio":       "Сжатие: %s → %s (%.1f×)",
+		//Armored text
+		"armored_output":        "Текстовый (armored) формат",
+		"armor_error":           "Ошибка текстового формата: %v",
+		"armor_not_found":       "В тексте не найдено зашифрованное сообщение",
+		"decrypt_choose_source": "Выберите, что расшифровать",
+		"from_file":             "Из файла",
+		"from_text":             "Вставленный текст",
+		"paste_from_clipboard":  "Вставить из буфера",
+		//Messages
+		"messages":             "Сообщения",
+		"messages_card_hint":   "Написать или прочитать зашифрованное сообщение",
+		"messages_choose_mode": "Что вы хотите сделать?",
+		"new_message":          "Новое сообщение",
+		"read_message":         "Прочитать сообщение",
+		"message_placeholder":  "Введите текст сообщения…",
+		"output_format":        "Результат",
+		"format_armored":       "Текст для копирования",
+		"format_binary":        "Файл .bin",
+		"message_empty":        "Сообщение пустое",
+		"message_too_long":     "Сообщение слишком длинное",
+		"message_encrypted":    "Сообщение зашифровано",
+		"message_decrypted":    "Сообщение расшифровано (на диск не сохранено)",
+		"not_a_message":        "Это не текстовое сообщение, используйте Расшифровать → Из файла",
+		//Volumes
+		"split_volumes":        "Тома:",
+		"volumes_off":          "Не делить",
+		"volumes_written":      "Сохранено томов: %d (%s … %s)",
+		"volumes_joined":       "Объединено томов: %d",
+		"volume_missing":       "Не найден том %s",
+		"volume_foreign":       "Том %s относится к другому набору",
+		"volume_damaged":       "Том %s повреждён",
+		"volume_size_mismatch": "Размер объединённых томов не совпадает с заголовком",
+		"qpkg_damaged_files":   "Повреждённые файлы не извлечены: %s",
+		//Archive browser
+		"archive_contents":   "Содержимое архива",
+		"reading_archive":    "Чтение архива…",
+		"extract_all":        "Извлечь всё…",
+		"extract_selected":   "Извлечь отмеченные…",
+		"save_entry_as":      "Сохранить как…",
+		"select_entry_first": "Сначала выберите файл в списке",
+		//Extraction conflicts
+		"if_file_exists":       "Если файл существует:",
+		"conflict_rename":      "Переименовать",
+		"conflict_overwrite":   "Перезаписать",
+		"conflict_skip":        "Пропустить",
+		"conflict_ask":         "Спрашивать",
+		"extract_to_subfolder": "В новую папку «%s»",
+		"file_exists":          "Файл существует",
+		"file_exists_question": "«%s» уже существует. Что сделать?",
+		"apply_to_all":         "Применить ко всем оставшимся",
+		"extract_summary":      "Итог извлечения",
+		"extracted_to":         "Извлечено в: %s",
+		"summary_written":      "Записано",
+		"summary_overwritten":  "Перезаписано",
+		"summary_renamed":      "Переименовано",
+		"summary_skipped":      "Пропущено",
+		"summary_damaged":      "Повреждено, не извлечено",
+		"summary_log":          "Извлечено: записано %d, перезаписано %d, переименовано %d, пропущено %d, повреждено %d",
+		//ZIP / TAR
+		"export_archive":        "Экспорт…",
+		"export_format":         "Формат архива:",
+		"exported_entries":      "Экспортировано файлов: %d в %s",
+		"import_archive":        "Импорт ZIP/TAR",
+		"import_unsupported":    "Импортировать можно только .zip, .tar, .tar.gz и .tgz",
+		"import_error":          "Ошибка импорта: %v",
+		"import_skipped_unsafe": "Пропущен элемент с небезопасным путём: %s",
+		"imported_entries":      "Импортировано файлов: %d из %s",
+		//Watch folders
+		"watch_folders":         "Папки наблюдения",
+		"watch_outbox":          "Исходящие (шифровать):",
+		"watch_inbox":           "Входящие (расшифровать):",
+		"watch_plain":           "Расшифрованные в:",
+		"watch_hint":            "Файлы, помещённые в подпапку получателя в исходящих (%s), шифруются следующим сеансовым ключом в её папку \"encrypted\". Контейнеры (.bin) во входящих расшифровываются. Оригиналы перемещаются в \"processed\", файлы с ошибками — в \"quarantine\".",
+		"watch_start":           "Запустить",
+		"watch_stop":            "Остановить",
+		"watch_status_on":       "Наблюдение за папками включено",
+		"watch_status_off":      "Наблюдение выключено",
+		"watch_started":         "Наблюдение за папками запущено",
+		"watch_stopped":         "Наблюдение за папками остановлено",
+		"watch_no_folders":      "Выберите папку исходящих или входящих",
+		"watch_no_plain_folder": "Выберите папку для расшифрованных файлов",
+		"watch_same_folders":    "Папки исходящих, входящих и расшифрованных файлов должны различаться",
+		"watch_error":           "Папки наблюдения: %v",
+		"watch_failed":          "%s: %v",
+		"watch_quarantined":     "Перемещён в карантин: %s",
+		"watch_encrypted":       "%s зашифрован для %s: %s",
+		"watch_decrypted":       "%s расшифрован: %s",
+		//Local API
+		"local_api":          "Локальный API",
+		"api_policy":         "Запросы:",
+		"api_policy_ask":     "Подтверждать каждый запрос",
+		"api_policy_read":    "Разрешать просмотр и состояние ключей, остальное подтверждать",
+		"api_policy_all":     "Разрешать все запросы",
+		"api_hint":           "Программы на этом компьютере могут шифровать, расшифровывать и просматривать файлы через http://127.0.0.1, пока выполнен вход. Адрес и токен доступа этого сеанса находятся в %s.",
+		"api_status_on":      "Ожидает запросы на %s",
+		"api_status_off":     "Остановлен",
+		"api_started":        "Локальный API запущен на %s",
+		"api_stopped":        "Локальный API остановлен",
+		"api_error":          "Локальный API: %v",
+		"api_confirm_title":  "Запрос локального API",
+		"api_confirm":        "%s запрашивает: %s. Разрешить?",
+		"api_allow":          "Разрешить",
+		"api_deny":           "Отклонить",
+		"api_denied":         "Запрос отклонён",
+		"api_request_log":    "Локальный API, %s: %s",
+		"api_request_denied": "Локальный API, %s: %s — отклонено",
+		"api_op_encrypt":     "зашифровать %s (%s) для %s",
+		"api_op_decrypt":     "расшифровать %s (%s, %s)",
+		"api_op_inspect":     "просмотреть контейнер",
+		"api_op_keys":        "узнать состояние ключей",
+		"api_kind_file":      "файл",
+		"api_kind_message":   "сообщение",
+		"api_kind_archive":   "архив",
+		//Drag and drop
+		"dropped_items":  "Перетащено объектов: %d",
+		"drop_not_local": "Не локальный файл, пропущен: %s",
+		//Jobs
+		"jobs":             "Задачи",
+		"clear_finished":   "Убрать завершённые",
+		"job_queued":       "В очереди…",
+		"job_done":         "Готово за %s",
+		"job_failed":       "Ошибка: %v",
+		"job_canceled":     "Отменено",
+		"job_left":         "осталось %s",
+		"job_encrypt":      "Шифрование %s",
+		"job_decrypt":      "Расшифрование %s",
+		"job_save":         "Сохранение %s",
+		"job_read_archive": "Чтение архива %s",
+		"job_extract":      "Извлечение %s",
+		"job_export":       "Экспорт %s",
+		"job_pasted":       "вставленный текст",
+		//Journal
+		"journal":              "История",
+		"journal_error":        "Ошибка журнала: %v",
+		"journal_intact":       "Журнал цел: записей %d",
+		"journal_broken":       "Цепочка журнала нарушена на записи %d — доверять можно только %d записям до неё",
+		"journal_search_hint":  "Поиск: номер пользователя, файл, дата…",
+		"journal_shown":        "Показано %d из %d",
+		"journal_all":          "Все",
+		"journal_out":          "Отправлено",
+		"journal_in":           "Получено",
+		"journal_center":       "Центр",
+		"journal_key_session":  "сеансовый",
+		"journal_key_circle":   "круговой",
+		"journal_key_multi":    "мульти",
+		"journal_kind_file":    "файл",
+		"journal_kind_archive": "архив",
+		"journal_kind_message": "сообщение",
+		"journal_via_window":   "окно",
+		"journal_via_cli":      "командная строка",
+		"journal_via_watch":    "папка наблюдения",
+		"journal_via_api":      "локальный API",
+		"journal_export_csv":   "Экспорт CSV",
+		"journal_export_json":  "Экспорт JSON",
+		"journal_exported":     "Экспортировано записей журнала: %d в %s",
+		//Dashboard
+		"dashboard":      "Учёт ключей",
+		"dash_hint":      "Остаток сеансовых ключей по пользователям. Прогноз строится по темпу за последние 30 дней истории.",
+		"dash_user":      "Пользователь",
+		"dash_in":        "IN",
+		"dash_out":       "OUT",
+		"dash_last":      "Последняя активность",
+		"dash_forecast":  "Закончатся через",
+		"dash_days":      "≈ %d дн.",
+		"dash_depleted":  "закончились",
+		"dash_never":     "не было",
+		"dash_threshold": "Подсвечивать меньше:",
+		"dash_low_count": "Мало ключей: %d из %d",
+		"dash_refresh":   "Обновить",
+		"dash_export":    "Экспорт CSV",
+		"dash_exported":  "Учёт ключей экспортирован в %s",
+		//Address book
+		"address_book":             "Адресная книга",
+		"received_from":            "Контейнер от %s",
+		"contacts_search_hint":     "Поиск: номер, имя, отдел…",
+		"contacts_pick_user":       "Выберите пользователя слева",
+		"contacts_name":            "Имя",
+		"contacts_department":      "Отдел",
+		"contacts_note":            "Заметки",
+		"contacts_choose_picture":  "Выбрать фото",
+		"contacts_remove_picture":  "Убрать фото",
+		"contacts_picture_too_big": "Фото больше %d КБ",
+		"contacts_saved":           "Адресная книга: %s сохранён",
+		"contacts_load_error":      "Не удалось прочитать адресную книгу: %v",
+		"contacts_save_error":      "Не удалось сохранить адресную книгу: %v",
+		"contacts_broken":          "Адресная книга повреждена или создана для других ключей",
+		"contacts_import":          "Импорт",
+		"contacts_export":          "Экспорт",
+		"contacts_import_error":    "Ошибка импорта: %v",
+		"contacts_imported":        "Адресная книга: импортировано %d, пропущено %d",
+		"contacts_exported":        "Адресная книга: %d контактов экспортировано в %s",
+		//Lock
+		"lock":              "Заблокировать",
+		"lock_after":        "Блок. через %d мин",
+		"lock_never":        "Без автоблокировки",
+		"lock_jobs_running": "Ещё выполняется заданий: %d. Отменить их и заблокировать?",
+		"locking":           "Блокировка…",
+		//Sign-in protection
+		"security":              "Безопасность",
+		"auto_lock":             "Автоблокировка",
+		"signin_failed":         "Неверный пароль или повреждённый файл ключей (неудачных попыток: %d). Следующая попытка через %s",
+		"signin_lockout":        "Неверный пароль или повреждённый файл ключей (неудачных попыток: %d). Вход заблокирован на %d мин",
+		"signin_wait":           "Слишком много неудачных попыток. Повторите через %s",
+		"signin_locked":         "Вход заблокирован после неудачных попыток. Повторите через %s",
+		"signin_record_broken":  "Запись о неудачных входах была изменена или удалена. Вход заблокирован на %d мин",
+		"signin_wipe_warning":   "До уничтожения сеансовых ключей осталось попыток: %d",
+		"signin_wiped":          "Слишком много неудачных попыток: сеансовые ключи уничтожены. Запросите новые ключи в центре.",
+		"signin_wipe_error":     "Не удалось уничтожить сеансовые ключи: %v",
+		"signin_failures_since": "Неудачных попыток входа с прошлого входа: %d",
+		"signin_lockout_after":  "Блокировать вход после",
+		"signin_lockout_for":    "Блокировать на",
+		"signin_wipe_after":     "Уничтожать сеансовые ключи после",
+		"signin_n_failures":     "%d неудачных попыток",
+		"signin_n_minutes":      "%d мин",
+		"signin_no_lockout":     "Никогда",
+		"signin_never_wipe":     "Никогда",
+		"signin_policy_hint":    "Каждая неудачная попытка увеличивает ожидание перед следующей. Политика хранится в файле ключей и действует и для командной строки. Уничтожение стирает сеансовые ключи, как для утерянного устройства; ключи круга открываются снова новым или предыдущим паролем.",
+		"signin_policy_saved":   "Защита входа сохранена",
+		"signin_policy_error":   "Защита входа: %v",
+		//Password age
+		"rule_not_recent":        "Не совпадает с последними %d паролями",
+		"password_reused":        "Этот пароль уже использовался недавно. Выберите пароль, отличный от последних %d.",
+		"password_reused_short":  "пароль использовался недавно",
+		"password_expired":       "Срок действия пароля истёк %s. Пожалуйста, смените его.",
+		"password_expires_soon":  "Срок действия пароля истекает %s. Смените его заранее.",
+		"password_max_age":       "Срок действия пароля",
+		"password_no_max_age":    "Без ограничения",
+		"password_n_days":        "%d дн.",
+		"password_max_age_saved": "Срок действия пароля установлен: %s",
+		"password_max_age_error": "Не удалось сохранить срок действия пароля: %v",
+		//Change password
+		"current_password":             "Текущий пароль",
+		"enter_current_password":       "Введите текущий пароль.",
+		"current_password_wrong":       "Текущий пароль введён неверно.",
+		"change_password_current_hint": "Введите текущий пароль, затем новый.",
+		//Password strength
+		"rule_not_common":      "Не из списка распространённых паролей",
+		"rule_no_words":        "Без словарных слов вроде password или love",
+		"rule_no_keyboard":     "Без последовательностей клавиш и символов вроде qwerty, 1234 или abcd",
+		"rule_no_repeats":      "Без повторов вроде aaa или abab",
+		"rule_strength":        "Надёжность: %s (не ниже: %s)",
+		"strength_very_weak":   "очень слабый",
+		"strength_weak":        "слабый",
+		"strength_fair":        "средний",
+		"strength_strong":      "надёжный",
+		"strength_very_strong": "очень надёжный",
+		"password_min_length":  "Минимальная длина пароля",
+		"password_min_score":   "Минимальная надёжность пароля",
+		"password_n_chars":     "%d символов",
+		//Key file lock
+		"keys_in_use": "Файл ключей открыт в другом окне или команде QalqanDS. Сначала закройте его там.",
+		//Sign-in record
+		"signin_record_error":        "Не удалось записать попытку входа, поэтому вход отклонён: %v",
+		"signin_record_broken_short": "Запись о неудачных входах была изменена или удалена",
+		"signin_keys_wiped":          "Сеансовые ключи уже уничтожены после неудачных попыток.",
+		"signin_keys_were_wiped":     "Сеансовые ключи были уничтожены после неудачных входов. Запросите новые ключи в центре.",
+		"keys_wiped":                 "Сеансовые ключи уничтожены, а в файле ключей нет предыдущего пароля, чтобы открыть его. Запросите новый файл ключей в центре.",
+		//Watch folders working
+		"watch_interrupted": "Обработка файла была прервана; результат уже может быть в \"encrypted\" или в папке открытых файлов. Верните файл, чтобы обработать его снова.",
+		//Payload
+		"payload_closed": "Контейнер закрыт при блокировке сеанса; откройте его снова.",
 	},
 	"KZ": {
 		"lang":            "Тіл",
@@ -284,7 +830,7 @@ var i18n = map[string]map[string]string{
 		"new_password":           "Жаңа құпиясөз",
 		"confirm_password":       "Құпиясөзді растау",
 		"password_rules":         "Құпиясөз келесі талаптарға сай болуы керек:",
-		"rule_min_length":        "Кемі 10 таңба",
+		"rule_min_length":        "Кемі %d таңба",
 		"rule_upper":             "Кемі бір бас әріп",
 		"rule_lower":             "Кемі бір кіші әріп",
 		"rule_digit":             "Кемі бір сан",
@@ -306,6 +852,279 @@ var i18n = map[string]map[string]string{
 		"selected":         "Таңдалған",
 		"size":             "Өлшемі",
 		"nothing_selected": "Ештеңе таңдалмады",
+		//Multi recipients
+		"several_recipients":       "Бірнеше...",
+		"select_recipients":        "Алушыларды таңдаңыз",
+		"select_all":               "Барлығын таңдау",
+		"select_none":              "Таңдауды алып тастау",
+		"n_recipients":             "%d алушы",
+		"encrypted_for_recipients": "Шифрланды: %s",
+		"not_a_recipient":          "Бұл файл осы пайдаланушы үшін шифрланбаған",
+		//Compression
+		"options":                 "Параметрлер",
+		"compress_before_encrypt": "Шифрлау алдында сығу",
+		"compression_ratio":       "Сығу: %s → %s (%.1f×)",
+		//Armored text
+		"armored_output":        "Мәтіндік (armored) формат",
+		"armor_error":           "Мәтіндік формат қатесі: %v",
+		"armor_not_found":       "Мәтінде шифрланған хабарлама табылмады",
+		"decrypt_choose_source": "Нені дешифрлаймыз?",
+		"from_file":             "Файлдан",
+		"from_text":             "Қойылған мәтін",
+		"paste_from_clipboard":  "Буферден қою",
+		//Messages
+		"messages":             "Хабарламалар",
+		"messages_card_hint":   "Шифрланған хабарлама жазу немесе оқу",
+		"messages_choose_mode": "Не істегіңіз келеді?",
+		"new_message":          "Жаңа хабарлама",
+		"read_message":         "Хабарламаны оқу",
+		"message_placeholder":  "Хабарлама мәтінін енгізіңіз…",
+		"output_format":        "Нәтиже",
+		"format_armored":       "Көшіруге арналған мәтін",
+		"format_binary":        ".bin файлы",
+		"message_empty":        "Хабарлама бос",
+		"message_too_long":     "Хабарлама тым ұзын",
+		"message_encrypted":    "Хабарлама шифрланды",
+		"message_decrypted":    "Хабарлама дешифрланды (дискіге сақталмады)",
+		"not_a_message":        "Бұл мәтіндік хабарлама емес, Дешифрлау → Файлдан пайдаланыңыз",
+		//Volumes
+		"split_volumes":        "Томдар:",
+		"volumes_off":          "Бөлмеу",
+		"volumes_written":      "Сақталған томдар: %d (%s … %s)",
+		"volumes_joined":       "Біріктірілген томдар: %d",
+		"volume_missing":       "%s томы табылмады",
+		"volume_foreign":       "%s томы басқа жинаққа жатады",
+		"volume_damaged":       "%s томы зақымдалған",
+		"volume_size_mismatch": "Біріктірілген томдар өлшемі тақырыпқа сәйкес келмейді",
+		"qpkg_damaged_files":   "Зақымдалған файлдар шығарылмады: %s",
+		//Archive browser
+		"archive_contents":   "Мұрағат мазмұны",
+		"reading_archive":    "Мұрағат оқылуда…",
+		"extract_all":        "Барлығын шығару…",
+		"extract_selected":   "Белгіленгендерді шығару…",
+		"save_entry_as":      "Басқаша сақтау…",
+		"select_entry_first": "Алдымен тізімнен файлды таңдаңыз",
+		//Extraction conflicts
+		"if_file_exists":       "Файл бар болса:",
+		"conflict_rename":      "Атын өзгерту",
+		"conflict_overwrite":   "Қайта жазу",
+		"conflict_skip":        "Өткізіп жіберу",
+		"conflict_ask":         "Сұрау",
+		"extract_to_subfolder": "Жаңа «%s» қалтасына",
+		"file_exists":          "Файл бар",
+		"file_exists_question": "«%s» бұрыннан бар. Не істеу керек?",
+		"apply_to_all":         "Қалғандарының барлығына қолдану",
+		"extract_summary":      "Шығару қорытындысы",
+		"extracted_to":         "Шығарылған орын: %s",
+		"summary_written":      "Жазылды",
+		"summary_overwritten":  "Қайта жазылды",
+		"summary_renamed":      "Аты өзгертілді",
+		"summary_skipped":      "Өткізіліп жіберілді",
+		"summary_damaged":      "Зақымдалған, шығарылмады",
+		"summary_log":          "Шығарылды: жазылды %d, қайта жазылды %d, аты өзгертілді %d, өткізілді %d, зақымдалған %d",
+		//ZIP / TAR
+		"export_archive":        "Экспорттау…",
+		"export_format":         "Мұрағат пішімі:",
+		"exported_entries":      "%d файл %s ішіне экспортталды",
+		"import_archive":        "ZIP/TAR импорттау",
+		"import_unsupported":    "Тек .zip, .tar, .tar.gz және .tgz импорттауға болады",
+		"import_error":          "Импорттау қатесі: %v",
+		"import_skipped_unsafe": "Қауіпті жолы бар элемент өткізілді: %s",
+		"imported_entries":      "%d файл %s ішінен импортталды",
+		//Watch folders
+		"watch_folders":         "Бақылау қалталары",
+		"watch_outbox":          "Шығыс (шифрлау):",
+		"watch_inbox":           "Кіріс (шифрды ашу):",
+		"watch_plain":           "Ашылған файлдар:",
+		"watch_hint":            "Шығыс қалтасындағы алушы ішкі қалтасына (%s) салынған файлдар келесі сеанстық кілтпен оның \"encrypted\" қалтасына шифрланады. Кіріс қалтасындағы контейнерлер (.bin) ашылады. Түпнұсқалар \"processed\" қалтасына, қатесі бар файлдар \"quarantine\" қалтасына жылжытылады.",
+		"watch_start":           "Іске қосу",
+		"watch_stop":            "Тоқтату",
+		"watch_status_on":       "Қалталар бақылануда",
+		"watch_status_off":      "Бақылау өшірулі",
+		"watch_started":         "Қалталарды бақылау басталды",
+		"watch_stopped":         "Қалталарды бақылау тоқтатылды",
+		"watch_no_folders":      "Шығыс немесе кіріс қалтасын таңдаңыз",
+		"watch_no_plain_folder": "Ашылған файлдар қалтасын таңдаңыз",
+		"watch_same_folders":    "Шығыс, кіріс және ашылған файлдар қалталары әртүрлі болуы керек",
+		"watch_error":           "Бақылау қалталары: %v",
+		"watch_failed":          "%s: %v",
+		"watch_quarantined":     "Карантинге жылжытылды: %s",
+		"watch_encrypted":       "%s %s үшін шифрланды: %s",
+		"watch_decrypted":       "%s ашылды: %s",
+		//Local API
+		"local_api":          "Жергілікті API",
+		"api_policy":         "Сұраулар:",
+		"api_policy_ask":     "Әр сұрауды растау",
+		"api_policy_read":    "Қарау мен кілттер күйіне рұқсат, қалғанын растау",
+		"api_policy_all":     "Барлық сұрауларға рұқсат",
+		"api_hint":           "Жүйеге кірген кезде осы компьютердегі бағдарламалар http://127.0.0.1 арқылы файлдарды шифрлай, аша және қарай алады. Осы сеанстың мекенжайы мен қол жеткізу токені %s ішінде.",
+		"api_status_on":      "%s мекенжайында тыңдауда",
+		"api_status_off":     "Тоқтатылған",
+		"api_started":        "Жергілікті API %s мекенжайында іске қосылды",
+		"api_stopped":        "Жергілікті API тоқтатылды",
+		"api_error":          "Жергілікті API: %v",
+		"api_confirm_title":  "Жергілікті API сұрауы",
+		"api_confirm":        "%s сұрайды: %s. Рұқсат беру керек пе?",
+		"api_allow":          "Рұқсат беру",
+		"api_deny":           "Қабылдамау",
+		"api_denied":         "Сұрау қабылданбады",
+		"api_request_log":    "Жергілікті API, %s: %s",
+		"api_request_denied": "Жергілікті API, %s: %s — қабылданбады",
+		"api_op_encrypt":     "%s (%s) файлын %s үшін шифрлау",
+		"api_op_decrypt":     "%s (%s, %s) шифрын ашу",
+		"api_op_inspect":     "контейнерді қарау",
+		"api_op_keys":        "кілттер күйін білу",
+		"api_kind_file":      "файл",
+		"api_kind_message":   "хабарлама",
+		"api_kind_archive":   "архив",
+		//Drag and drop
+		"dropped_items":  "Сүйреп әкелінген нысандар: %d",
+		"drop_not_local": "Жергілікті файл емес, өткізілді: %s",
+		//Jobs
+		"jobs":             "Тапсырмалар",
+		"clear_finished":   "Аяқталғандарды алып тастау",
+		"job_queued":       "Кезекте…",
+		"job_done":         "%s ішінде дайын",
+		"job_failed":       "Қате: %v",
+		"job_canceled":     "Тоқтатылды",
+		"job_left":         "%s қалды",
+		"job_encrypt":      "Шифрлау %s",
+		"job_decrypt":      "Шифрды ашу %s",
+		"job_save":         "Сақтау %s",
+		"job_read_archive": "Мұрағатты оқу %s",
+		"job_extract":      "Шығарып алу %s",
+		"job_export":       "Экспорттау %s",
+		"job_pasted":       "қойылған мәтін",
+		//Journal
+		"journal":              "Тарих",
+		"journal_error":        "Журнал қатесі: %v",
+		"journal_intact":       "Журнал бүтін: %d жазба",
+		"journal_broken":       "Журнал тізбегі %d-жазбада бұзылған — тек одан бұрынғы %d жазбаға сенуге болады",
+		"journal_search_hint":  "Іздеу: пайдаланушы нөмірі, файл, күн…",
+		"journal_shown":        "%d / %d көрсетілді",
+		"journal_all":          "Барлығы",
+		"journal_out":          "Жіберілді",
+		"journal_in":           "Алынды",
+		"journal_center":       "Орталық",
+		"journal_key_session":  "сеанстық",
+		"journal_key_circle":   "шеңберлік",
+		"journal_key_multi":    "мульти",
+		"journal_kind_file":    "файл",
+		"journal_kind_archive": "мұрағат",
+		"journal_kind_message": "хабарлама",
+		"journal_via_window":   "терезе",
+		"journal_via_cli":      "пәрмен жолы",
+		"journal_via_watch":    "бақылау қалтасы",
+		"journal_via_api":      "жергілікті API",
+		"journal_export_csv":   "CSV экспорты",
+		"journal_export_json":  "JSON экспорты",
+		"journal_exported":     "%d журнал жазбасы %s файлына экспортталды",
+		//Dashboard
+		"dashboard":      "Кілттер есебі",
+		"dash_hint":      "Пайдаланушылар бойынша сеанстық кілттер қалдығы. Болжам тарихтағы соңғы 30 күннің қарқынымен жасалады.",
+		"dash_user":      "Пайдаланушы",
+		"dash_in":        "IN",
+		"dash_out":       "OUT",
+		"dash_last":      "Соңғы белсенділік",
+		"dash_forecast":  "Таусылуына",
+		"dash_days":      "≈ %d күн",
+		"dash_depleted":  "таусылды",
+		"dash_never":     "болмаған",
+		"dash_threshold": "Мынадан аз болса белгілеу:",
+		"dash_low_count": "Кілттері аз: %d / %d",
+		"dash_refresh":   "Жаңарту",
+		"dash_export":    "CSV экспорты",
+		"dash_exported":  "Кілттер есебі %s файлына экспортталды",
+		//Address book
+		"address_book":             "Мекенжай кітабы",
+		"received_from":            "%s жіберген контейнер",
+		"contacts_search_hint":     "Іздеу: нөмір, аты, бөлім…",
+		"contacts_pick_user":       "Сол жақтан пайдаланушыны таңдаңыз",
+		"contacts_name":            "Аты",
+		"contacts_department":      "Бөлім",
+		"contacts_note":            "Жазбалар",
+		"contacts_choose_picture":  "Сурет таңдау",
+		"contacts_remove_picture":  "Суретті алып тастау",
+		"contacts_picture_too_big": "Сурет %d КБ-тан үлкен",
+		"contacts_saved":           "Мекенжай кітабы: %s сақталды",
+		"contacts_load_error":      "Мекенжай кітабын оқу мүмкін болмады: %v",
+		"contacts_save_error":      "Мекенжай кітабын сақтау мүмкін болмады: %v",
+		"contacts_broken":          "Мекенжай кітабы бүлінген немесе басқа кілттерге жасалған",
+		"contacts_import":          "Импорт",
+		"contacts_export":          "Экспорт",
+		"contacts_import_error":    "Импорт қатесі: %v",
+		"contacts_imported":        "Мекенжай кітабы: %d импортталды, %d өткізілді",
+		"contacts_exported":        "Мекенжай кітабы: %d контакт %s файлына экспортталды",
+		//Lock
+		"lock":              "Құлыптау",
+		"lock_after":        "%d мин кейін құлыптау",
+		"lock_never":        "Автоқұлыпсыз",
+		"lock_jobs_running": "Әлі %d тапсырма орындалуда. Оларды тоқтатып, құлыптау керек пе?",
+		"locking":           "Құлыпталуда…",
+		//Sign-in protection
+		"security":              "Қауіпсіздік",
+		"auto_lock":             "Автоқұлып",
+		"signin_failed":         "Құпиясөз қате немесе кілттер файлы бүлінген (сәтсіз әрекеттер: %d). Келесі әрекет %s кейін",
+		"signin_lockout":        "Құпиясөз қате немесе кілттер файлы бүлінген (сәтсіз әрекеттер: %d). Кіру %d минутқа бұғатталды",
+		"signin_wait":           "Сәтсіз әрекеттер тым көп. %s кейін қайталаңыз",
+		"signin_locked":         "Сәтсіз әрекеттерден кейін кіру бұғатталды. %s кейін қайталаңыз",
+		"signin_record_broken":  "Сәтсіз кірулер жазбасы өзгертілген немесе жойылған. Кіру %d минутқа бұғатталды",
+		"signin_wipe_warning":   "Сеанстық кілттер жойылғанға дейін қалған әрекеттер: %d",
+		"signin_wiped":          "Сәтсіз әрекеттер тым көп: сеанстық кілттер жойылды. Орталықтан жаңа кілттер сұраңыз.",
+		"signin_wipe_error":     "Сеанстық кілттерді жою мүмкін болмады: %v",
+		"signin_failures_since": "Соңғы кіруден бергі сәтсіз кіру әрекеттері: %d",
+		"signin_lockout_after":  "Кіруді бұғаттау",
+		"signin_lockout_for":    "Бұғаттау уақыты",
+		"signin_wipe_after":     "Сеанстық кілттерді жою",
+		"signin_n_failures":     "%d сәтсіз әрекеттен кейін",
+		"signin_n_minutes":      "%d мин",
+		"signin_no_lockout":     "Ешқашан",
+		"signin_never_wipe":     "Ешқашан",
+		"signin_policy_hint":    "Әр сәтсіз әрекет келесісін күту уақытын ұзартады. Саясат кілттер файлында сақталады және пәрмен жолына да қолданылады. Жою сеанстық кілттерді өшіреді, жоғалған құрылғыдағыдай; шеңбер кілттері жаңа немесе алдыңғы құпиясөзбен қайта ашылады.",
+		"signin_policy_saved":   "Кіруді қорғау сақталды",
+		"signin_policy_error":   "Кіруді қорғау: %v",
+		//Password age
+		"rule_not_recent":        "Соңғы %d құпиясөздің бірі емес",
+		"password_reused":        "Бұл құпиясөз жақында қолданылған. Соңғы %d құпиясөзден өзгешесін таңдаңыз.",
+		"password_reused_short":  "құпиясөз жақында қолданылған",
+		"password_expired":       "Құпиясөздің мерзімі %s аяқталды. Өтінеміз, оны өзгертіңіз.",
+		"password_expires_soon":  "Құпиясөздің мерзімі %s аяқталады. Оны алдын ала өзгертіңіз.",
+		"password_max_age":       "Құпиясөздің әрекет ету мерзімі",
+		"password_no_max_age":    "Шектеусіз",
+		"password_n_days":        "%d күн",
+		"password_max_age_saved": "Құпиясөздің әрекет ету мерзімі орнатылды: %s",
+		"password_max_age_error": "Құпиясөздің әрекет ету мерзімін сақтау мүмкін емес: %v",
+		//Change password
+		"current_password":             "Ағымдағы құпиясөз",
+		"enter_current_password":       "Ағымдағы құпиясөзді енгізіңіз.",
+		"current_password_wrong":       "Ағымдағы құпиясөз қате.",
+		"change_password_current_hint": "Ағымдағы құпиясөзді, содан кейін жаңасын енгізіңіз.",
+		//Password strength
+		"rule_not_common":      "Кең таралған құпиясөз емес",
+		"rule_no_words":        "password немесе love сияқты сөздіктегі сөздерсіз",
+		"rule_no_keyboard":     "qwerty, 1234 немесе abcd сияқты пернелер мен таңбалар тізбегінсіз",
+		"rule_no_repeats":      "aaa немесе abab сияқты қайталаусыз",
+		"rule_strength":        "Беріктігі: %s (кемінде: %s)",
+		"strength_very_weak":   "өте әлсіз",
+		"strength_weak":        "әлсіз",
+		"strength_fair":        "орташа",
+		"strength_strong":      "берік",
+		"strength_very_strong": "өте берік",
+		"password_min_length":  "Құпиясөздің ең аз ұзындығы",
+		"password_min_score":   "Құпиясөздің ең төменгі беріктігі",
+		"password_n_chars":     "%d таңба",
+		//Key file lock
+		"keys_in_use": "Кілттер файлы QalqanDS-тің басқа терезесінде немесе пәрменінде ашық. Алдымен оны сол жерде жабыңыз.",
+		//Sign-in record
+		"signin_record_error":        "Кіру әрекетін жазу мүмкін болмады, сондықтан кіру қабылданбайды: %v",
+		"signin_record_broken_short": "Сәтсіз кірулер жазбасы өзгертілген немесе жойылған",
+		"signin_keys_wiped":          "Сеанстық кілттер сәтсіз әрекеттерден кейін жойылған.",
+		"signin_keys_were_wiped":     "Сеанстық кілттер сәтсіз кірулерден кейін жойылды. Орталықтан жаңа кілттерді сұраңыз.",
+		"keys_wiped":                 "Сеанстық кілттер жойылған, ал кілттер файлында оны ашатын алдыңғы құпиясөз жоқ. Орталықтан жаңа кілттер файлын сұраңыз.",
+		//Watch folders working
+		"watch_interrupted": "Файлды өңдеу үзілді; нәтиже \"encrypted\" немесе ашық файлдар қалтасында болуы мүмкін. Қайта өңдеу үшін файлды қайтарыңыз.",
+		//Payload
+		"payload_closed": "Контейнер сеанс бұғатталғанда жабылды; оны қайта ашыңыз.",
 	},
 }
 
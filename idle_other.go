@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+import "time"
+
+// systemIdle is not known here; only the input the window sees counts.
+func systemIdle() (time.Duration, bool) { return 0, false }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procGetLastInputInfo = windows.NewLazySystemDLL("user32.dll").NewProc("GetLastInputInfo")
+	procGetTickCount     = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetTickCount")
+)
+
+// systemIdle is the time since the last keyboard or mouse input anywhere in the session.
+func systemIdle() (time.Duration, bool) {
+	var info struct {
+		size uint32
+		time uint32
+	}
+	info.size = uint32(unsafe.Sizeof(info))
+	if r, _, _ := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info))); r == 0 {
+		return 0, false
+	}
+	now, _, _ := procGetTickCount.Call()
+	return time.Duration(uint32(now)-info.time) * time.Millisecond, true
+}
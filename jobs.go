@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Jobs run in the background, at most maxParallelJobs at a time; the rest wait in the order
+// they were queued. Each one has a row in the jobs card with its progress, speed, time left,
+// a cancel button and, at the end, its status.
+//
+// Keys are taken through the keyring, which hands each one out once under its lock and saves
+// the key file before letting go, so parallel jobs never share a key. What a job encrypts for
+// is fixed when it is queued, not when it starts.
+const maxParallelJobs = 2
+
+type jobState int
+
+const (
+	jobQueued jobState = iota
+	jobRunning
+	jobDone
+	jobFailed
+	jobCanceled
+)
+
+type job struct {
+	title  string
+	size   int64 // bytes the job goes through, for the speed and time left; 0 if not known
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	state   jobState
+	asking  bool // waiting for the user to answer a question
+	frac    float64
+	started time.Time
+	elapsed time.Duration
+	err     error
+	drawn   time.Time
+
+	bar       *widget.ProgressBar
+	statusLbl *widget.Label
+	cancelBtn *widget.Button
+	row       fyne.CanvasObject
+}
+
+var (
+	jobSlots = make(chan struct{}, maxParallelJobs)
+
+	jobsMu      sync.Mutex
+	jobs        []*job
+	jobsRunning sync.WaitGroup
+
+	jobsBox      *fyne.Container
+	jobsCard     *widget.Card
+	clearJobsBtn *widget.Button
+)
+
+// runJob queues fn as a job. fn reports progress through j.progress, reads through j.reader
+// and passes j.ctx on, so it stops soon after the job is canceled. A job canceled while queued
+// still calls fn, with j.ctx done, so that it releases what it holds.
+func runJob(title string, size int64, fn func(j *job) error) *job {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{title: title, size: size, ctx: ctx, cancel: cancel}
+	jobsMu.Lock()
+	jobs = append(jobs, j)
+	jobsMu.Unlock()
+	runOnMain(j.show)
+	noteActivity()
+	jobsRunning.Add(1)
+	go j.run(fn)
+	return j
+}
+
+func (j *job) run(fn func(j *job) error) {
+	defer jobsRunning.Done()
+	select {
+	case jobSlots <- struct{}{}:
+	case <-j.ctx.Done():
+		j.finish(fn(j))
+		return
+	}
+	defer func() { <-jobSlots }()
+
+	j.mu.Lock()
+	j.state, j.started = jobRunning, time.Now()
+	j.mu.Unlock()
+	j.redraw()
+	j.finish(fn(j))
+}
+
+func (j *job) finish(err error) {
+	j.mu.Lock()
+	switch {
+	case err == nil:
+		j.state, j.frac = jobDone, 1
+	case j.ctx.Err() != nil:
+		j.state = jobCanceled
+	default:
+		j.state, j.err = jobFailed, err
+	}
+	if !j.started.IsZero() {
+		j.elapsed = time.Since(j.started)
+	}
+	j.mu.Unlock()
+	j.cancel()
+	j.redraw()
+}
+
+// progress takes the share done so far; the row is redrawn a few times a second at most.
+func (j *job) progress(f float64) {
+	j.mu.Lock()
+	j.frac = f
+	due := time.Since(j.drawn) > 200*time.Millisecond
+	if due {
+		j.drawn = time.Now()
+	}
+	j.mu.Unlock()
+	if due {
+		j.redraw()
+	}
+}
+
+// reader stops reading from r once the job is canceled.
+func (j *job) reader(r io.Reader) io.Reader { return jobReader{j.ctx, r} }
+
+type jobReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r jobReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
+
+func (j *job) statusText() string {
+	switch j.state {
+	case jobQueued:
+		return tr("job_queued")
+	case jobDone:
+		return fmt.Sprintf(tr("job_done"), formatJobDuration(j.elapsed))
+	case jobFailed:
+		return fmt.Sprintf(tr("job_failed"), j.err)
+	case jobCanceled:
+		return tr("job_canceled")
+	}
+
+	s := fmt.Sprintf("%d%%", int(j.frac*100))
+	took := time.Since(j.started)
+	if j.size > 0 && took > time.Second/2 {
+		speed := j.frac * float64(j.size) / took.Seconds()
+		s += "  •  " + humanSize(int64(speed)) + "/s"
+	}
+	if j.frac > 0.01 && took > time.Second {
+		left := time.Duration(float64(took) * (1 - j.frac) / j.frac)
+		s += "  •  " + fmt.Sprintf(tr("job_left"), formatJobDuration(left))
+	}
+	return s
+}
+
+func formatJobDuration(d time.Duration) string {
+	s := int(d.Round(time.Second).Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+func (j *job) show() {
+	j.bar = widget.NewProgressBar()
+	j.statusLbl = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Italic: true})
+	j.cancelBtn = widget.NewButtonWithIcon("", theme.CancelIcon(), j.cancel)
+	title := widget.NewLabelWithStyle(j.title, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	title.Truncation = fyne.TextTruncateEllipsis
+	j.row = container.NewBorder(nil, nil, nil, container.NewCenter(j.cancelBtn),
+		container.NewVBox(title, j.bar, j.statusLbl))
+	j.draw()
+	if jobsBox != nil {
+		jobsBox.Add(j.row)
+		jobsCard.Show()
+	}
+}
+
+func (j *job) redraw() { runOnMain(j.draw) }
+
+func (j *job) draw() {
+	if j.bar == nil {
+		return
+	}
+	j.mu.Lock()
+	frac, text, finished := j.frac, j.statusText(), j.state >= jobDone
+	j.mu.Unlock()
+	j.bar.SetValue(frac)
+	j.statusLbl.SetText(text)
+	if finished {
+		j.cancelBtn.Hide()
+	}
+}
+
+func (j *job) finished() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state >= jobDone
+}
+
+func (j *job) setAsking(on bool) {
+	j.mu.Lock()
+	j.asking = on
+	j.mu.Unlock()
+}
+
+// unfinishedJobs counts the jobs that are queued or running.
+func unfinishedJobs() int {
+	return countJobs(func(j *job) bool { return j.state < jobDone })
+}
+
+// busyJobs counts the jobs that are queued or running and not waiting for the user.
+func busyJobs() int {
+	return countJobs(func(j *job) bool { return j.state < jobDone && !j.asking })
+}
+
+func countJobs(match func(*job) bool) int {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	n := 0
+	for _, j := range jobs {
+		j.mu.Lock()
+		if match(j) {
+			n++
+		}
+		j.mu.Unlock()
+	}
+	return n
+}
+
+// cancelJobs cancels every job and waits until all of them have stopped, for timeout at most;
+// it tells whether they did.
+func cancelJobs(timeout time.Duration) bool {
+	jobsMu.Lock()
+	for _, j := range jobs {
+		j.cancel()
+	}
+	jobsMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		jobsRunning.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// refreshJobs redraws the rows after a language change.
+func refreshJobs() {
+	if jobsCard == nil {
+		return
+	}
+	jobsCard.SetSubTitle(tr("jobs"))
+	clearJobsBtn.SetText(tr("clear_finished"))
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for _, j := range jobs {
+		j.draw()
+	}
+}
+
+func clearFinishedJobs() {
+	jobsMu.Lock()
+	kept := jobs[:0]
+	for _, j := range jobs {
+		if j.finished() {
+			jobsBox.Remove(j.row)
+		} else {
+			kept = append(kept, j)
+		}
+	}
+	jobs = kept
+	empty := len(jobs) == 0
+	jobsMu.Unlock()
+	if empty {
+		jobsCard.Hide()
+	}
+}
+
+// makeJobsCard builds the card of the main window that lists the jobs; it is hidden while there are none.
+func makeJobsCard() fyne.CanvasObject {
+	jobsBox = container.NewVBox()
+	jobsMu.Lock()
+	for _, j := range jobs {
+		if j.row != nil {
+			jobsBox.Add(j.row)
+		}
+	}
+	empty := len(jobs) == 0
+	jobsMu.Unlock()
+
+	clearJobsBtn = widget.NewButtonWithIcon(tr("clear_finished"), theme.DeleteIcon(), clearFinishedJobs)
+	scroll := container.NewVScroll(jobsBox)
+	scroll.SetMinSize(fyne.NewSize(0, 150))
+	jobsCard = widget.NewCard("", tr("jobs"), container.NewBorder(nil,
+		container.NewHBox(layout.NewSpacer(), clearJobsBtn), nil, nil, scroll))
+	if empty {
+		jobsCard.Hide()
+	}
+	return jobsCard
+}
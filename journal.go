@@ -0,0 +1,230 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Where an operation in the journal came from.
+const (
+	viaWindow = "window"
+	viaCLI    = "cli"
+	viaWatch  = "watch"
+	viaAPI    = "api"
+)
+
+// journalSealed records a container made with res. A journal that cannot be written does not
+// undo the operation; the error is logged and returned for the CLI to print.
+func journalSealed(logs *widget.RichText, res *qds.EncryptResult, kind, file, via string) error {
+	entries := keyring.SealedEntries(res, kind, journalFileName(file))
+	for i := range entries {
+		entries[i].Via = via
+	}
+	return appendJournal(logs, entries...)
+}
+
+// journalOpened records a container unlocked with the key file.
+func journalOpened(logs *widget.RichText, c *qds.Container, file, via string) error {
+	e := keyring.OpenedEntry(c, journalFileName(file))
+	e.Via = via
+	return appendJournal(logs, e)
+}
+
+func appendJournal(logs *widget.RichText, entries ...qds.JournalEntry) error {
+	err := keyring.AppendJournal(entries...)
+	if err != nil {
+		uiLog(logs, fmt.Sprintf(tr("journal_error"), err))
+	}
+	return err
+}
+
+func journalFileName(p string) string {
+	if p == "" {
+		return ""
+	}
+	return filepath.Base(p)
+}
+
+func journalPeerLabel(e qds.JournalEntry) string {
+	if e.Peer == 0 {
+		return tr("journal_center")
+	}
+	return userLabel(e.Peer - 1)
+}
+
+func journalRowText(e qds.JournalEntry) string {
+	dir := "↑ " + tr("journal_out")
+	if e.Direction == qds.DirectionIn {
+		dir = "↓ " + tr("journal_in")
+	}
+	fields := []string{
+		e.Time.Local().Format("2006-01-02 15:04:05"),
+		dir,
+		journalPeerLabel(e),
+		fmt.Sprintf("%s #%d", tr("journal_key_"+e.KeyType), e.KeyIndex),
+		tr("journal_kind_" + e.Kind),
+		humanSize(e.Size),
+	}
+	if e.File != "" {
+		fields = append(fields, e.File)
+	}
+	if e.Via != "" {
+		fields = append(fields, "("+tr("journal_via_"+e.Via)+")")
+	}
+	return strings.Join(fields, "   ")
+}
+
+// journalMatch tells whether e fits the search: a number is a user, anything else is
+// looked for in the row as shown.
+func journalMatch(e qds.JournalEntry, query string) bool {
+	query = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(query), "№"))
+	if query == "" {
+		return true
+	}
+	if n, err := strconv.Atoi(query); err == nil {
+		return e.Peer == n
+	}
+	return strings.Contains(strings.ToLower(journalRowText(e)), strings.ToLower(query))
+}
+
+func writeJournalCSV(w io.Writer, entries []qds.JournalEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "direction", "peer", "key_type", "key_index", "kind", "file", "size", "via"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Time.Format("2006-01-02T15:04:05Z07:00"),
+			e.Direction,
+			strconv.Itoa(e.Peer),
+			e.KeyType,
+			strconv.Itoa(e.KeyIndex),
+			e.Kind,
+			e.File,
+			strconv.FormatInt(e.Size, 10),
+			e.Via,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeJournalJSON(w io.Writer, entries []qds.JournalEntry) error {
+	if entries == nil {
+		entries = []qds.JournalEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// ShowJournalWindow lists the journal of the key file, newest first, with a search and
+// export of what is shown.
+func ShowJournalWindow(win fyne.Window, logs *widget.RichText) {
+	all, err := keyring.ReadJournal()
+	statusLbl := widget.NewLabelWithStyle(fmt.Sprintf(tr("journal_intact"), len(all)), fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+	var je *qds.JournalError
+	switch {
+	case errors.As(err, &je) && errors.Is(err, qds.ErrJournalBroken):
+		statusLbl.SetText(fmt.Sprintf(tr("journal_broken"), je.Record, len(all)))
+		statusLbl.Importance = widget.DangerImportance
+	case err != nil:
+		statusLbl.SetText(fmt.Sprintf(tr("journal_error"), err))
+		statusLbl.Importance = widget.DangerImportance
+	}
+	for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+		all[i], all[j] = all[j], all[i]
+	}
+
+	shown := all
+	list := widget.NewList(
+		func() int { return len(shown) },
+		func() fyne.CanvasObject {
+			l := widget.NewLabel("")
+			l.TextStyle.Monospace = true
+			l.Truncation = fyne.TextTruncateEllipsis
+			return l
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(journalRowText(shown[id]))
+		},
+	)
+
+	countLbl := widget.NewLabel("")
+	dirOptions := []string{tr("journal_all"), tr("journal_out"), tr("journal_in")}
+	dirSelect := widget.NewSelect(dirOptions, nil)
+	search := widget.NewEntry()
+	search.SetPlaceHolder(tr("journal_search_hint"))
+
+	filter := func() {
+		dir := ""
+		switch dirSelect.Selected {
+		case dirOptions[1]:
+			dir = qds.DirectionOut
+		case dirOptions[2]:
+			dir = qds.DirectionIn
+		}
+		shown = nil
+		for _, e := range all {
+			if (dir == "" || e.Direction == dir) && journalMatch(e, search.Text) {
+				shown = append(shown, e)
+			}
+		}
+		countLbl.SetText(fmt.Sprintf(tr("journal_shown"), len(shown), len(all)))
+		list.UnselectAll()
+		list.Refresh()
+	}
+	search.OnChanged = func(string) { filter() }
+	dirSelect.OnChanged = func(string) { filter() }
+	dirSelect.SetSelected(dirOptions[0])
+
+	export := func(name string, write func(io.Writer, []qds.JournalEntry) error) func() {
+		return func() {
+			entries := shown
+			d := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil {
+					addLog(logs, fmt.Sprintf(tr("save_error"), err))
+					return
+				}
+				if writer == nil {
+					return
+				}
+				defer writer.Close()
+				if err := write(writer, entries); err != nil {
+					dialog.ShowError(fmt.Errorf(tr("save_error"), err), win)
+					return
+				}
+				addLog(logs, fmt.Sprintf(tr("journal_exported"), len(entries), writer.URI().Name()))
+			}, win)
+			d.SetFileName(name)
+			d.Show()
+		}
+	}
+	csvBtn := widget.NewButtonWithIcon(tr("journal_export_csv"), theme.DocumentSaveIcon(), export("journal.csv", writeJournalCSV))
+	jsonBtn := widget.NewButtonWithIcon(tr("journal_export_json"), theme.DocumentSaveIcon(), export("journal.json", writeJournalJSON))
+
+	top := container.NewVBox(
+		statusLbl,
+		container.NewBorder(nil, nil, nil, container.NewGridWrap(fyne.NewSize(140, 36), dirSelect), search),
+	)
+	bottom := container.NewHBox(countLbl, layout.NewSpacer(), csvBtn, jsonBtn)
+
+	bg := canvas.NewImageFromFile("assets/background.png")
+	bg.FillMode = canvas.ImageFillStretch
+	d := dialog.NewCustom(tr("journal"), tr("close"), container.NewStack(bg, container.NewPadded(container.NewBorder(top, bottom, nil, nil, list))), win)
+	d.Resize(fyne.NewSize(980, 600))
+	d.Show()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const keysExpiryWarnDays = 14
+
+// locateKeysFile finds center.bin or abc.bin next to the executable; exactly one of them must exist.
+func locateKeysFile() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("can't locate executable: %w", err)
+	}
+	exeDir := filepath.Dir(exePath)
+
+	centerPath := filepath.Join(exeDir, "center.bin")
+	abcPath := filepath.Join(exeDir, "abc.bin")
+
+	centerExists := fileExists(centerPath)
+	abcExists := fileExists(abcPath)
+
+	switch {
+	case centerExists && abcExists:
+		return "", errors.New(tr("both_keyfiles_found"))
+	case centerExists:
+		return centerPath, nil
+	case abcExists:
+		return abcPath, nil
+	}
+	return "", errors.New(tr("no_keyfiles_found"))
+}
+
+// checkKeysExpiry reads the expiry dates of the key file. It fails once the keys
+// have expired and otherwise returns the days left when they expire within two weeks, -1 if not.
+func checkKeysExpiry(keysPath string) (int, error) {
+	isCenterMode = qds.IsCenterFile(keysPath)
+	updateKeysDates(keysPath)
+
+	if keysExpiryCache.IsZero() {
+		return -1, nil
+	}
+	now := time.Now()
+	if !now.Before(keysExpiryCache) {
+		return 0, fmt.Errorf(tr("keys_expired_error"), keysExpiryCache.Format("02.01.2006"))
+	}
+	if keysExpiryCache.Sub(now) > keysExpiryWarnDays*24*time.Hour {
+		return -1, nil
+	}
+	leftDays := int(keysExpiryCache.Sub(now).Hours() / 24)
+	if leftDays < 0 {
+		leftDays = 0
+	}
+	return leftDays, nil
+}
+
+// loadKeysFile decrypts the key file with password and makes it the current keyring.
+// Wrong passwords are counted and throttled, see signInFailed.
+func loadKeysFile(keysPath, password string) error {
+	if err := checkSignIn(keysPath); err != nil {
+		return err
+	}
+	k, err := qds.Open(keysPath, password)
+	if errors.Is(err, qds.ErrWrongPassword) {
+		return signInFailed(keysPath, nil)
+	}
+	if err != nil {
+		return localizeError(err)
+	}
+	if err := signInSucceeded(k); err != nil {
+		k.Close()
+		return err
+	}
+	if keyring != nil {
+		keyring.Close()
+	}
+	keyring = k
+	isCenterMode = k.IsCenter()
+	localUserIndex = 0
+	lastKeyHashHex = k.KeyHash()
+	loadAddressBook()
+	return nil
+}
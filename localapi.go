@@ -0,0 +1,623 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// The local API lets other programs on this workstation use the signed-in keys.
+// It listens on 127.0.0.1 only. Its address and a token made for this session are
+// written to the token file, readable by the current user only, and removed when
+// the API stops. Every request carries "Authorization: Bearer <token>".
+//
+//	POST /v1/encrypt?to=2,3&key=session|circle&compress=1&armor=1&name=report.pdf
+//	     body: the file; answer: the container
+//	POST /v1/decrypt?format=zip|tar.gz&name=report.pdf.bin
+//	     body: a container; answer: the file, the message text or the archive as zip or tar.gz,
+//	     X-Qalqan-Content tells which: file, message or archive
+//	POST /v1/inspect?verify=1
+//	     body: a container; answer: JSON as from "qalqands inspect --json"
+//	GET  /v1/keys
+//	     answer: JSON as from "qalqands keys status --json"
+//
+// Errors are JSON {"ok": false, "error": "..."}. Each request waits for confirmation in
+// the window unless the chosen policy approves it beforehand.
+
+type apiPolicy int
+
+const (
+	apiAskAlways apiPolicy = iota
+	apiAllowRead           // inspect and key status run without asking
+	apiAllowAll
+)
+
+const apiConfirmTimeout = 2 * time.Minute
+
+var activeAPI *localAPI
+
+type localAPI struct {
+	srv       *http.Server
+	addr      string
+	token     string
+	tokenPath string
+	win       fyne.Window
+	logs      *widget.RichText
+	confirmMu sync.Mutex
+	busy      sync.WaitGroup
+	stopped   chan struct{}
+}
+
+type apiTokenFile struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+	PID   int    `json:"pid"`
+}
+
+func apiTokenPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "Qalqan-DS", "api-token.json"), nil
+}
+
+func currentAPIPolicy() apiPolicy {
+	p := apiPolicy(fyne.CurrentApp().Preferences().IntWithFallback("api_policy", int(apiAskAlways)))
+	if p < apiAskAlways || p > apiAllowAll {
+		return apiAskAlways
+	}
+	return p
+}
+
+func apiPolicyOptions() []string {
+	return []string{tr("api_policy_ask"), tr("api_policy_read"), tr("api_policy_all")}
+}
+
+func startLocalAPI(win fyne.Window, logs *widget.RichText) (*localAPI, error) {
+	tokenPath, err := apiTokenPath()
+	if err != nil {
+		return nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	a := &localAPI{
+		addr:      ln.Addr().String(),
+		token:     hex.EncodeToString(secret),
+		tokenPath: tokenPath,
+		win:       win,
+		logs:      logs,
+		stopped:   make(chan struct{}),
+	}
+
+	info, _ := json.MarshalIndent(apiTokenFile{URL: "http://" + a.addr, Token: a.token, PID: os.Getpid()}, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(tokenPath), 0o700); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	os.Remove(tokenPath) // so the mode of a new file applies
+	if err := os.WriteFile(tokenPath, info, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/encrypt", a.encrypt)
+	mux.HandleFunc("POST /v1/decrypt", a.decrypt)
+	mux.HandleFunc("POST /v1/inspect", a.inspect)
+	mux.HandleFunc("GET /v1/keys", a.keys)
+	a.srv = &http.Server{Handler: a.guard(mux), ReadHeaderTimeout: 10 * time.Second}
+	go a.srv.Serve(ln)
+	return a, nil
+}
+
+// Stop closes the server and waits for the requests in progress; those waiting for
+// confirmation are denied.
+func (a *localAPI) Stop() {
+	close(a.stopped)
+	a.srv.Close()
+	os.Remove(a.tokenPath)
+	a.busy.Wait()
+}
+
+// guard lets through only requests with the session token that come from this machine,
+// and none from web pages, which always send Origin.
+func (a *localAPI) guard(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if host != "127.0.0.1" && host != "localhost" || r.Header.Get("Origin") != "" {
+			apiError(w, http.StatusForbidden, errors.New("forbidden"))
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			apiError(w, http.StatusUnauthorized, errors.New("bad or missing token"))
+			return
+		}
+		a.busy.Add(1)
+		defer a.busy.Done()
+		select {
+		case <-a.stopped:
+			apiError(w, http.StatusServiceUnavailable, errors.New(tr("need_keys_first")))
+			return
+		default:
+		}
+		if keyring == nil {
+			apiError(w, http.StatusServiceUnavailable, errors.New(tr("need_keys_first")))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// onMain runs f on the main goroutine and waits for it, unless the server stops first;
+// Stop may be called from the main goroutine, which then never gets to f.
+func (a *localAPI) onMain(f func()) bool {
+	done := make(chan struct{})
+	runOnMain(func() {
+		f()
+		close(done)
+	})
+	select {
+	case <-done:
+		return true
+	case <-a.stopped:
+		return false
+	}
+}
+
+func apiError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		cliStatus
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
+
+func apiJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiClient names the caller for the confirmation and the log.
+func apiClient(r *http.Request) string {
+	if s := strings.TrimSpace(r.Header.Get("X-Client-Name")); s != "" {
+		return s
+	}
+	if s := r.UserAgent(); s != "" {
+		return s
+	}
+	return r.RemoteAddr
+}
+
+func readAPIBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var me *http.MaxBytesError
+		if errors.As(err, &me) {
+			apiError(w, http.StatusRequestEntityTooLarge, errors.New(tr("file_too_big")))
+		} else {
+			apiError(w, http.StatusBadRequest, err)
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+// approve asks in the window whether the request may run, unless the policy allows it.
+func (a *localAPI) approve(r *http.Request, read bool, what string) bool {
+	client := apiClient(r)
+	switch p := currentAPIPolicy(); {
+	case p == apiAllowAll, p == apiAllowRead && read:
+		uiLog(a.logs, fmt.Sprintf(tr("api_request_log"), client, what))
+		return true
+	}
+
+	a.confirmMu.Lock()
+	defer a.confirmMu.Unlock()
+
+	answer := make(chan bool, 1)
+	reply := func(ok bool) {
+		select {
+		case answer <- ok:
+		default:
+		}
+	}
+	var d *dialog.ConfirmDialog
+	runOnMain(func() {
+		d = dialog.NewConfirm(tr("api_confirm_title"), fmt.Sprintf(tr("api_confirm"), client, what), reply, a.win)
+		d.SetConfirmText(tr("api_allow"))
+		d.SetDismissText(tr("api_deny"))
+		d.Show()
+		a.win.RequestFocus()
+	})
+
+	ok := false
+	select {
+	case ok = <-answer:
+	case <-time.After(apiConfirmTimeout):
+	case <-r.Context().Done():
+	case <-a.stopped:
+	}
+	runOnMain(func() {
+		if d != nil {
+			d.Hide()
+		}
+	})
+	if ok {
+		uiLog(a.logs, fmt.Sprintf(tr("api_request_log"), client, what))
+	} else {
+		uiLog(a.logs, fmt.Sprintf(tr("api_request_denied"), client, what))
+	}
+	return ok
+}
+
+func queryBool(r *http.Request, name string, fallback bool) (bool, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return fallback, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("bad value of %s: %q", name, s)
+	}
+	return v, nil
+}
+
+func (a *localAPI) encrypt(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var to userList
+	if s := q.Get("to"); s != "" {
+		if err := to.Set(s); err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	useSession := true
+	switch q.Get("key") {
+	case "", "session":
+	case "circle":
+		useSession = false
+	default:
+		apiError(w, http.StatusBadRequest, errors.New("key must be session or circle"))
+		return
+	}
+	name := qds.SanitizeFileName(filepath.Base(q.Get("name")))
+	if name == "" || name == "." {
+		name = "data"
+	}
+
+	// the mode, the recipients and the options belong to the window; they are read once, there
+	var (
+		opts      qds.EncryptOptions
+		targets   []int
+		center    bool
+		rcptLabel string
+		terr      error
+	)
+	if !a.onMain(func() {
+		center = isCenterMode
+		if targets, terr = cliTargets(to, useSession); terr == nil {
+			opts = encryptOptions(fileTypeFromPath(name), useSession, targets, nil)
+			rcptLabel = recipientsLabel(targets)
+		}
+	}) {
+		apiError(w, http.StatusServiceUnavailable, errors.New(tr("need_keys_first")))
+		return
+	}
+	if terr != nil {
+		apiError(w, http.StatusBadRequest, terr)
+		return
+	}
+	compress, err := queryBool(r, "compress", opts.Compress)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	armor, err := queryBool(r, "armor", false)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	data, ok := readAPIBody(w, r, qds.MaxPlainSize)
+	if !ok {
+		return
+	}
+	what := fmt.Sprintf(tr("api_op_encrypt"), name, humanSize(int64(len(data))), rcptLabel)
+	if !a.approve(r, false, what) {
+		apiError(w, http.StatusForbidden, errors.New(tr("api_denied")))
+		return
+	}
+
+	opts.Compress = compress
+	opts.Armor = armor
+	var out bytes.Buffer
+	res, err := keyring.EncryptFile(&out, bytes.NewReader(data), opts)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, qds.ErrNoKeys) {
+			code = http.StatusConflict
+		}
+		apiError(w, code, localizeError(err))
+		return
+	}
+	journalSealed(a.logs, res, qds.JournalFile, name, viaAPI)
+	if res.Session {
+		refreshKeysLeft()
+	}
+
+	outName := suggestEncryptedNameFromPath(name)
+	if armor {
+		outName = strings.TrimSuffix(outName, ".bin") + qds.ArmorExt
+	}
+	var rcpt []string
+	for _, t := range res.Recipients {
+		rcpt = append(rcpt, strconv.Itoa(t+1))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Qalqan-Filename", outName)
+	if res.Session {
+		w.Header().Set("X-Qalqan-Key", "session")
+	} else {
+		w.Header().Set("X-Qalqan-Key", "circle")
+	}
+	if center {
+		w.Header().Set("X-Qalqan-Recipients", strings.Join(rcpt, ","))
+	}
+	w.Write(out.Bytes())
+}
+
+func (a *localAPI) decrypt(w http.ResponseWriter, r *http.Request) {
+	format := exportZip
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "", "zip":
+	case "tar.gz", "tgz":
+		format = exportTarGz
+	default:
+		apiError(w, http.StatusBadRequest, errors.New("format must be zip or tar.gz"))
+		return
+	}
+	name := qds.SanitizeFileName(filepath.Base(r.URL.Query().Get("name")))
+	if name == "" || name == "." {
+		name = "data.bin"
+	}
+
+	data, ok := readAPIBody(w, r, qds.MaxArmoredSize)
+	if !ok {
+		return
+	}
+	c, err := keyring.OpenContainer(data)
+	if err != nil {
+		apiError(w, http.StatusUnprocessableEntity, localizeError(err))
+		return
+	}
+	kind := "file"
+	switch {
+	case c.Message():
+		kind = "message"
+	case c.Archive():
+		kind = "archive"
+	}
+	if !a.approve(r, false, fmt.Sprintf(tr("api_op_decrypt"), name, humanSize(int64(len(data))), tr("api_kind_"+kind))) {
+		apiError(w, http.StatusForbidden, errors.New(tr("api_denied")))
+		return
+	}
+
+	p, err := keyring.Unlock(c)
+	if err != nil {
+		code := http.StatusConflict
+		if errors.Is(err, qds.ErrSaveKeys) {
+			code = http.StatusInternalServerError
+		}
+		apiError(w, code, localizeError(err))
+		return
+	}
+	defer p.Close()
+	journalOpened(a.logs, c, name, viaAPI)
+	if c.KeyType != qds.KeyTypeCircle {
+		refreshKeysLeft()
+	}
+
+	// the whole answer is made first, so a damaged payload still gets an error status
+	var out bytes.Buffer
+	outName := qds.SanitizeFileName(suggestDecryptedNameFromPath(name, c.FileType))
+	contentType := "application/octet-stream"
+	switch kind {
+	case "message":
+		text, err := readMessagePayload(p)
+		if err != nil {
+			apiError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		out.WriteString(text)
+		outName = archiveFolderName(name) + ".txt"
+		contentType = "text/plain; charset=utf-8"
+	case "archive":
+		src := p.Open(nil)
+		_, err = exportQpkg(src, &out, format, nil)
+		src.Close()
+		if err != nil {
+			apiError(w, http.StatusUnprocessableEntity, localizeError(err))
+			return
+		}
+		outName = exportFileName(name, format)
+	default:
+		src := p.Open(nil)
+		_, err = io.Copy(&out, src)
+		src.Close()
+		if err != nil {
+			apiError(w, http.StatusUnprocessableEntity, fmt.Errorf(tr("decrypt_error"), localizeError(err)))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Qalqan-Content", kind)
+	w.Header().Set("X-Qalqan-Filename", outName)
+	w.Write(out.Bytes())
+}
+
+func (a *localAPI) inspect(w http.ResponseWriter, r *http.Request) {
+	verify, err := queryBool(r, "verify", false)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	data, ok := readAPIBody(w, r, qds.MaxArmoredSize)
+	if !ok {
+		return
+	}
+	c, err := qds.Inspect(data)
+	if err != nil {
+		apiError(w, http.StatusUnprocessableEntity, localizeError(err))
+		return
+	}
+	if !a.approve(r, true, tr("api_op_inspect")) {
+		apiError(w, http.StatusForbidden, errors.New(tr("api_denied")))
+		return
+	}
+	res := describeContainer(c)
+	res.Size = len(data)
+	res.Armored = qds.IsArmored(data)
+	if verify {
+		if _, err := keyring.OpenContainer(data); err != nil {
+			apiError(w, http.StatusUnprocessableEntity, localizeError(err))
+			return
+		}
+		res.Verified = &verify
+	}
+	apiJSON(w, res)
+}
+
+func (a *localAPI) keys(w http.ResponseWriter, r *http.Request) {
+	if !a.approve(r, true, tr("api_op_keys")) {
+		apiError(w, http.StatusForbidden, errors.New(tr("api_denied")))
+		return
+	}
+	apiJSON(w, keysStatus())
+}
+
+func stopLocalAPI() {
+	if activeAPI != nil {
+		activeAPI.Stop()
+		activeAPI = nil
+	}
+}
+
+// restoreLocalAPI starts the local API after sign-in if it was on. A server left from the last
+// time the main window was built is stopped first.
+func restoreLocalAPI(win fyne.Window, logs *widget.RichText) {
+	stopLocalAPI()
+	if !fyne.CurrentApp().Preferences().BoolWithFallback("api_enabled", false) {
+		return
+	}
+	a, err := startLocalAPI(win, logs)
+	if err != nil {
+		addLog(logs, fmt.Sprintf(tr("api_error"), err))
+		return
+	}
+	activeAPI = a
+	addLog(logs, fmt.Sprintf(tr("api_started"), a.addr))
+}
+
+func ShowLocalAPIWindow(win fyne.Window, logs *widget.RichText) {
+	prefs := fyne.CurrentApp().Preferences()
+
+	policySelect := widget.NewSelect(apiPolicyOptions(), func(s string) {
+		for i, o := range apiPolicyOptions() {
+			if o == s {
+				prefs.SetInt("api_policy", i)
+			}
+		}
+	})
+	policySelect.SetSelected(apiPolicyOptions()[currentAPIPolicy()])
+
+	tokenPath, _ := apiTokenPath()
+	hint := widget.NewLabel(fmt.Sprintf(tr("api_hint"), tokenPath))
+	hint.Wrapping = fyne.TextWrapWord
+	hint.TextStyle.Italic = true
+
+	statusLbl := widget.NewLabelWithStyle("", fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+	var startBtn, stopBtn *widget.Button
+	update := func() {
+		if activeAPI != nil {
+			statusLbl.SetText(fmt.Sprintf(tr("api_status_on"), activeAPI.addr))
+			startBtn.Disable()
+			stopBtn.Enable()
+		} else {
+			statusLbl.SetText(tr("api_status_off"))
+			startBtn.Enable()
+			stopBtn.Disable()
+		}
+	}
+
+	startBtn = widget.NewButtonWithIcon(tr("watch_start"), theme.MediaPlayIcon(), func() {
+		a, err := startLocalAPI(win, logs)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf(tr("api_error"), err), win)
+			return
+		}
+		activeAPI = a
+		prefs.SetBool("api_enabled", true)
+		addLog(logs, fmt.Sprintf(tr("api_started"), a.addr))
+		update()
+	})
+	stopBtn = widget.NewButtonWithIcon(tr("watch_stop"), theme.MediaStopIcon(), func() {
+		stopLocalAPI()
+		prefs.SetBool("api_enabled", false)
+		addLog(logs, tr("api_stopped"))
+		update()
+	})
+	update()
+
+	form := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel(tr("api_policy")), nil, policySelect),
+		hint,
+		widget.NewSeparator(),
+		statusLbl,
+		container.NewHBox(layout.NewSpacer(),
+			container.NewGridWrap(fyne.NewSize(160, 40), startBtn),
+			container.NewGridWrap(fyne.NewSize(160, 40), stopBtn),
+			layout.NewSpacer()),
+	)
+
+	bg := canvas.NewImageFromFile("assets/background.png")
+	bg.FillMode = canvas.ImageFillStretch
+	d := dialog.NewCustom(tr("local_api"), tr("close"), container.NewStack(bg, container.NewPadded(form)), win)
+	d.Resize(fyne.NewSize(700, 360))
+	d.Show()
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image/color"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+)
+
+// The session locks itself after lockMinutes without input: the keys are wiped and the window
+// goes back to the login screen. Running jobs count as activity, so an idle lock never cuts
+// one short, unless they wait for an answer; the Lock button asks before it cancels them.
+// Jobs that don't stop within jobStopTimeout of a lock are left behind with the keys closed.
+const (
+	defaultLockMinutes = 10
+	jobStopTimeout     = 10 * time.Second
+)
+
+var lockMinuteChoices = []int{5, 10, 15, 30, 60, 0}
+
+var (
+	lastActivity atomic.Int64 // unix nanoseconds
+	idleStop     chan struct{}
+	locking      bool
+
+	changePasswordWin fyne.Window // open from the main window, closed on lock
+)
+
+func noteActivity() { lastActivity.Store(time.Now().UnixNano()) }
+
+func lockMinutes() int {
+	return fyne.CurrentApp().Preferences().IntWithFallback("lock_minutes", defaultLockMinutes)
+}
+
+func lockMinutesLabel(m int) string {
+	if m <= 0 {
+		return tr("lock_never")
+	}
+	return fmt.Sprintf(tr("lock_after"), m)
+}
+
+// activitySurface lies under the widgets of the main window and takes the mouse moving
+// over it as activity; keys are seen through the canvas.
+type activitySurface struct {
+	widget.BaseWidget
+}
+
+func newActivitySurface() *activitySurface {
+	s := &activitySurface{}
+	s.ExtendBaseWidget(s)
+	return s
+}
+
+func (s *activitySurface) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(canvas.NewRectangle(color.Transparent))
+}
+
+func (s *activitySurface) MouseIn(*desktop.MouseEvent)    { noteActivity() }
+func (s *activitySurface) MouseMoved(*desktop.MouseEvent) { noteActivity() }
+func (s *activitySurface) MouseOut()                      {}
+
+// inputState sums up what input changes in the windows of app: the focused widget, the text
+// and cursor of a focused entry and the dialog on top. The canvas sees keys only while nothing
+// has focus and the surface sees the mouse only outside dialogs, so typing into an entry or
+// working in a dialog shows up here instead. Must be called on the main goroutine.
+func inputState(app fyne.App) uint64 {
+	h := fnv.New64a()
+	for _, w := range app.Driver().AllWindows() {
+		c := w.Canvas()
+		fmt.Fprintf(h, "%p %p|", c.Overlays().Top(), c.Focused())
+		if e, ok := c.Focused().(*widget.Entry); ok {
+			// the length only, the text may be a password
+			fmt.Fprintf(h, "%d %d %d|", len(e.Text), e.CursorRow, e.CursorColumn)
+		}
+	}
+	return h.Sum64()
+}
+
+// startIdleLock watches for inactivity in the windows of the app. Where the system tells the
+// time since the last input anywhere, that is used as well.
+func startIdleLock(app fyne.App, win fyne.Window) {
+	stopIdleLock()
+	noteActivity()
+	stop := make(chan struct{})
+	idleStop = stop
+	state := inputState(app)
+	go func() {
+		t := time.NewTicker(15 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+			var now uint64
+			fyne.DoAndWait(func() { now = inputState(app) })
+			if now != state {
+				state = now
+				noteActivity()
+			}
+			limit := time.Duration(lockMinutes()) * time.Minute
+			if limit <= 0 {
+				continue
+			}
+			if busyJobs() > 0 {
+				noteActivity()
+				continue
+			}
+			idle := time.Since(time.Unix(0, lastActivity.Load()))
+			if sys, ok := systemIdle(); ok && sys < idle {
+				idle = sys
+			}
+			if idle >= limit {
+				runOnMain(func() { lockSession(app, win) })
+				return
+			}
+		}
+	}()
+}
+
+func stopIdleLock() {
+	if idleStop != nil {
+		close(idleStop)
+		idleStop = nil
+	}
+}
+
+// confirmLock locks at once when no job is running, otherwise after asking to cancel them.
+func confirmLock(app fyne.App, win fyne.Window) {
+	n := unfinishedJobs()
+	if n == 0 {
+		lockSession(app, win)
+		return
+	}
+	dialog.ShowConfirm(tr("lock"), fmt.Sprintf(tr("lock_jobs_running"), n), func(ok bool) {
+		if ok {
+			lockSession(app, win)
+		}
+	}, win)
+}
+
+// lockSession stops the watch folders, the local API and the jobs, then wipes the keys and
+// shows the login screen.
+func lockSession(app fyne.App, win fyne.Window) {
+	if keyring == nil || locking {
+		return
+	}
+	locking = true
+	stopIdleLock()
+	win.SetOnDropped(nil)
+
+	wait := dialog.NewCustomWithoutButtons(tr("locking"), widget.NewProgressBarInfinite(), win)
+	wait.Show()
+	fw, api := activeWatcher, activeAPI
+	activeWatcher, activeAPI = nil, nil
+	go func() {
+		if fw != nil {
+			fw.Stop()
+		}
+		if api != nil {
+			api.Stop()
+		}
+		cancelJobs(jobStopTimeout)
+		runOnMain(func() {
+			wait.Hide()
+			finishLock(app, win)
+		})
+	}()
+}
+
+func finishLock(app fyne.App, win fyne.Window) {
+	if changePasswordWin != nil {
+		changePasswordWin.Close()
+		changePasswordWin = nil
+	}
+	for o := win.Canvas().Overlays().Top(); o != nil; o = win.Canvas().Overlays().Top() {
+		win.Canvas().Overlays().Remove(o)
+	}
+	win.Canvas().SetOnTypedKey(nil)
+
+	closePayloads()
+	keyring.Close()
+	keyring = nil
+	isCenterMode = false
+	localUserIndex = 0
+	lastKeyHashHex = ""
+	selectedUserIdx = 0
+	selectedRecipients = nil
+	loadAddressBook()
+
+	keysLeftLabel = nil
+	recipientSelect = nil
+	multiRecipientsBtn = nil
+	jobsMu.Lock()
+	jobs = nil
+	jobsMu.Unlock()
+	jobsBox, jobsCard = nil, nil
+	locking = false
+
+	win.SetFullScreen(false)
+	ShowLogin(app, win)
+	win.Resize(fyne.NewSize(350, 250))
+	win.CenterOnScreen()
+	win.Show()
+}
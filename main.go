@@ -2,6 +2,7 @@ package main
 
 import (
 	"image/color"
+	"os"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -40,6 +41,10 @@ func (blackTextTheme) Size(name fyne.ThemeSizeName) float32 {
 }
 
 func main() {
+	if isCLIInvocation(os.Args[1:]) {
+		os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	myApp := app.NewWithID("Qalqan-DS")
 	myApp.Settings().SetTheme(&blackTextTheme{})
 	win := myApp.NewWindow("Qalqan-DS")
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const MaxMessageSize = 1 << 20 // 1 Mb of text
+
+func makeMessagesButton(win fyne.Window, logs *widget.RichText) *widget.Button {
+	btn := widget.NewButtonWithIcon(tr("messages"), iconFrom("assets/messaging.png", theme.MailComposeIcon()), func() {
+		if keyring == nil {
+			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+			return
+		}
+
+		var chooser *dialog.CustomDialog
+		sub := widget.NewLabelWithStyle(tr("messages_choose_mode"), fyne.TextAlignCenter, fyne.TextStyle{})
+
+		newBtn := widget.NewButtonWithIcon(tr("new_message"), iconFrom("assets/encryptMessage.png", theme.MailComposeIcon()), func() {
+			chooser.Hide()
+			ShowMessageComposer(win, logs)
+		})
+		readBtn := widget.NewButtonWithIcon(tr("read_message"), theme.MailReplyIcon(), func() {
+			chooser.Hide()
+			ShowMessageReader(win, logs)
+		})
+
+		buttonsRow := container.NewHBox(
+			layout.NewSpacer(),
+			container.NewGridWrap(fyne.NewSize(220, 40), newBtn),
+			widget.NewLabel(" "),
+			container.NewGridWrap(fyne.NewSize(220, 40), readBtn),
+			layout.NewSpacer(),
+		)
+
+		bg := canvas.NewImageFromFile("assets/background.png")
+		bg.FillMode = canvas.ImageFillStretch
+
+		inner := container.NewVBox(
+			widget.NewLabel(" "),
+			sub,
+			widget.NewLabel(" "),
+			buttonsRow,
+			widget.NewLabel(" "),
+		)
+
+		chooser = dialog.NewCustom(tr("messages"), tr("close"), container.NewStack(bg, container.NewPadded(inner)), win)
+		chooser.Resize(fyne.NewSize(520, 240))
+		chooser.Show()
+	})
+	return btn
+}
+
+func ShowMessageComposer(win fyne.Window, logs *widget.RichText) {
+	text := widget.NewMultiLineEntry()
+	text.Wrapping = fyne.TextWrapWord
+	text.SetPlaceHolder(tr("message_placeholder"))
+
+	keyTypePick := widget.NewSelect(keyPrefOptions(), nil)
+	keyTypePick.SetSelected(keyPrefToLabel(keyPref))
+
+	var recipientPick *widget.Select
+	form := widget.NewForm(widget.NewFormItem(tr("select_key_type"), keyTypePick))
+	if isCenterMode && keyring.Users() > 0 {
+		recipientPick = widget.NewSelect(userOptions(), nil)
+		recipientPick.SetSelected(userOption(selectedUserIdx))
+		form.Append(tr("encrypt_to"), recipientPick)
+		keyTypePick.OnChanged = func(s string) {
+			if labelToKeyPref(s) == KeyPrefSession {
+				recipientPick.Enable()
+			} else {
+				recipientPick.Disable()
+			}
+		}
+		keyTypePick.OnChanged(keyTypePick.Selected)
+	}
+
+	formatPick := widget.NewRadioGroup([]string{tr("format_armored"), tr("format_binary")}, nil)
+	formatPick.Horizontal = true
+	formatPick.SetSelected(tr("format_armored"))
+	form.Append(tr("output_format"), formatPick)
+
+	result := widget.NewMultiLineEntry()
+	result.Wrapping = fyne.TextWrapBreak
+	resultScroll := container.NewVScroll(result)
+	resultScroll.SetMinSize(fyne.NewSize(620, 140))
+	copyBtn := widget.NewButtonWithIcon(tr("copy"), theme.ContentCopyIcon(), func() {
+		win.Clipboard().SetContent(result.Text)
+		addLog(logs, tr("copied_to_clipboard"))
+	})
+	resultBox := container.NewBorder(nil, container.NewHBox(layout.NewSpacer(), copyBtn), nil, nil, resultScroll)
+	resultBox.Hide()
+
+	var dlg *dialog.CustomDialog
+	encryptBtn := widget.NewButtonWithIcon(tr("encrypt"), iconFrom("assets/encrypt.png", theme.ConfirmIcon()), func() {
+		msg := text.Text
+		if strings.TrimSpace(msg) == "" {
+			dialog.ShowInformation(tr("warning"), tr("message_empty"), win)
+			return
+		}
+		if len(msg) > MaxMessageSize {
+			dialog.ShowError(fmt.Errorf(tr("message_too_long")), win)
+			return
+		}
+
+		useSession := labelToKeyPref(keyTypePick.Selected) == KeyPrefSession
+		targets := []int{localUserIndex}
+		if recipientPick != nil {
+			if u, ok := parseUserOption(recipientPick.Selected); ok {
+				targets = []int{u}
+			}
+		}
+
+		out, res, err := buildContainer(logs, []byte(msg), qds.FileTypeText, true, useSession, targets, nil)
+		if err != nil {
+			addLog(logs, err.Error())
+			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+			return
+		}
+		journalSealed(logs, res, qds.JournalMessage, "", viaWindow)
+		if res.Session && keysLeftLabel != nil {
+			keysLeftLabel.SetText(formatKeysLeft(res.Recipients[0]))
+		}
+
+		if formatPick.Selected == tr("format_binary") {
+			name := "message_" + time.Now().Format("2006-01-02_15-04") + ".bin"
+			saveEncryptedOutput(win, logs, out.Bytes(), name, false)
+			dlg.Hide()
+			return
+		}
+		result.SetText(string(qds.Armor(out.Bytes())))
+		resultBox.Show()
+		addLog(logs, tr("message_encrypted"))
+	})
+
+	textScroll := container.NewVScroll(text)
+	textScroll.SetMinSize(fyne.NewSize(620, 180))
+
+	content := container.NewVBox(
+		textScroll,
+		form,
+		container.NewHBox(layout.NewSpacer(), container.NewGridWrap(fyne.NewSize(160, 40), encryptBtn)),
+		resultBox,
+	)
+
+	dlg = dialog.NewCustom(tr("new_message"), tr("close"), container.NewPadded(content), win)
+	dlg.SetOnClosed(func() {
+		text.SetText("")
+		result.SetText("")
+	})
+	dlg.Resize(fyne.NewSize(700, 620))
+	dlg.Show()
+}
+
+func ShowMessageReader(win fyne.Window, logs *widget.RichText) {
+	input := widget.NewMultiLineEntry()
+	input.Wrapping = fyne.TextWrapBreak
+	input.SetPlaceHolder(qds.ArmorHeader + "\n…\n" + qds.ArmorFooter)
+	if clip := win.Clipboard().Content(); qds.IsArmored([]byte(clip)) {
+		input.SetText(clip)
+	}
+
+	plain := widget.NewLabel("")
+	plain.Wrapping = fyne.TextWrapWord
+	plainScroll := container.NewVScroll(plain)
+	plainScroll.SetMinSize(fyne.NewSize(620, 200))
+
+	copyBtn := widget.NewButtonWithIcon(tr("copy"), theme.ContentCopyIcon(), func() {
+		win.Clipboard().SetContent(plain.Text)
+		addLog(logs, tr("copied_to_clipboard"))
+	})
+	copyBtn.Disable()
+
+	pasteBtn := widget.NewButtonWithIcon(tr("paste_from_clipboard"), theme.ContentPasteIcon(), func() {
+		input.SetText(win.Clipboard().Content())
+	})
+
+	decryptBtn := widget.NewButtonWithIcon(tr("decrypt"), iconFrom("assets/decrypt.png", theme.CancelIcon()), func() {
+		text, err := decryptMessageText(logs, []byte(input.Text))
+		if err != nil {
+			addLog(logs, err.Error())
+			dialog.ShowError(err, win)
+			return
+		}
+		plain.SetText(text)
+		copyBtn.Enable()
+		input.SetText("")
+		addLog(logs, tr("message_decrypted"))
+	})
+
+	inputScroll := container.NewVScroll(input)
+	inputScroll.SetMinSize(fyne.NewSize(620, 160))
+
+	content := container.NewVBox(
+		container.NewHBox(layout.NewSpacer(), pasteBtn),
+		inputScroll,
+		container.NewHBox(layout.NewSpacer(), container.NewGridWrap(fyne.NewSize(160, 40), decryptBtn)),
+		widget.NewSeparator(),
+		plainScroll,
+		container.NewHBox(layout.NewSpacer(), copyBtn),
+	)
+
+	dlg := dialog.NewCustom(tr("read_message"), tr("close"), container.NewPadded(content), win)
+	dlg.SetOnClosed(func() {
+		input.SetText("")
+		plain.SetText("")
+	})
+	dlg.Resize(fyne.NewSize(700, 640))
+	dlg.Show()
+}
+
+// decryptMessageText decrypts a message container into memory only.
+// Containers that are not messages are rejected before any key is consumed.
+func decryptMessageText(logs *widget.RichText, data []byte) (string, error) {
+	c, err := keyring.OpenContainer(data)
+	if err != nil {
+		return "", localizeError(err)
+	}
+	if !c.Message() {
+		return "", fmt.Errorf(tr("not_a_message"))
+	}
+	p, err := keyring.Unlock(c)
+	if err != nil {
+		return "", localizeError(err)
+	}
+	defer p.Close()
+	journalOpened(logs, c, "", viaWindow)
+	if c.KeyType != qds.KeyTypeCircle {
+		noteSessionKeyUsed(c.User)
+	}
+	return readMessagePayload(p)
+}
+
+func readMessagePayload(p *qds.Payload) (string, error) {
+	src := p.Open(nil)
+	defer src.Close()
+	buf, err := io.ReadAll(io.LimitReader(src, MaxMessageSize+1))
+	if err != nil {
+		return "", fmt.Errorf(tr("decrypt_error"), err)
+	}
+	if len(buf) > MaxMessageSize {
+		return "", fmt.Errorf(tr("message_too_long"))
+	}
+	return string(buf), nil
+}
+
+func showMessageText(win fyne.Window, logs *widget.RichText, text string) {
+	plain := widget.NewLabel(text)
+	plain.Wrapping = fyne.TextWrapWord
+	scroll := container.NewVScroll(plain)
+	scroll.SetMinSize(fyne.NewSize(620, 320))
+
+	copyBtn := widget.NewButtonWithIcon(tr("copy"), theme.ContentCopyIcon(), func() {
+		win.Clipboard().SetContent(plain.Text)
+		addLog(logs, tr("copied_to_clipboard"))
+	})
+
+	dlg := dialog.NewCustom(tr("read_message"), tr("close"),
+		container.NewBorder(nil, container.NewHBox(layout.NewSpacer(), copyBtn), nil, nil, scroll), win)
+	dlg.SetOnClosed(func() { plain.SetText("") })
+	dlg.Resize(fyne.NewSize(680, 440))
+	dlg.Show()
+}
@@ -1,12 +1,9 @@
 package main
 
 import (
-	"QalqanDS/qalqan"
-	"bytes"
-	crand "crypto/rand"
-	"encoding/binary"
+	"QalqanDS/qds"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,29 +14,10 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
-	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
-func sanitizeFileName(s string) string {
-	forbidden := `<>:"/\|?*`
-	s = strings.Map(func(r rune) rune {
-		if r < 32 {
-			return -1
-		}
-		if strings.ContainsRune(forbidden, r) {
-			return '_'
-		}
-		return r
-	}, s)
-	s = strings.Trim(s, " .")
-	if s == "" {
-		s = "archive"
-	}
-	return s
-}
-
 func baseNoExt(p string) string {
 	b := filepath.Base(p)
 	return strings.TrimSuffix(b, filepath.Ext(b))
@@ -71,7 +49,7 @@ func suggestArchiveName(files []string) string {
 		return "archive_" + ts + ".bin"
 	}
 	if len(files) == 1 {
-		name := sanitizeFileName(baseNoExt(files[0])) + "_" + ts + ".bin"
+		name := qds.SanitizeFileName(baseNoExt(files[0])) + "_" + ts + ".bin"
 		return name
 	}
 	dir := filepath.Dir(files[0])
@@ -83,7 +61,7 @@ func suggestArchiveName(files []string) string {
 		}
 	}
 	if same {
-		name := sanitizeFileName(filepath.Base(dir)) + "_" + ts + ".bin"
+		name := qds.SanitizeFileName(filepath.Base(dir)) + "_" + ts + ".bin"
 		return name
 	}
 	bases := make([]string, len(files))
@@ -91,11 +69,27 @@ func suggestArchiveName(files []string) string {
 		bases[i] = baseNoExt(f)
 	}
 	if pref := commonPrefix(bases); len(pref) >= 3 {
-		return sanitizeFileName(pref) + "_" + ts + ".bin"
+		return qds.SanitizeFileName(pref) + "_" + ts + ".bin"
 	}
 	return fmt.Sprintf("archive_%d_%s.bin", len(files), ts)
 }
 
+func humanSize(n int64) string {
+	const kb = 1024
+	const mb = 1024 * kb
+	const gb = 1024 * mb
+	switch {
+	case n >= gb:
+		return fmt.Sprintf("%.2f Gb", float64(n)/float64(gb))
+	case n >= mb:
+		return fmt.Sprintf("%.2f Mb", float64(n)/float64(mb))
+	case n >= kb:
+		return fmt.Sprintf("%.2f Kb", float64(n)/float64(kb))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
 func iconFrom(path string, fallback fyne.Resource) fyne.Resource {
 	if res, err := fyne.LoadResourceFromPath(path); err == nil && res != nil {
 		return res
@@ -103,198 +97,34 @@ func iconFrom(path string, fallback fyne.Resource) fyne.Resource {
 	return fallback
 }
 
-const svcMultiFlag byte = 0x88
-
-func setMultiFlag(s *[qalqan.BLOCKLEN]byte) {
-	s[9] = svcMultiFlag
-}
-
-func isMultiArchiveFlag(si []byte) bool {
-	return len(si) >= 10 && si[9] == svcMultiFlag
-}
-
-const (
-	qpkgMagic        = "QPKG"
-	qpkgVersion uint = 1
-)
-
-func qpkgPlainLen(files []string) (int64, error) {
-	var total int64 = 4 + 4 + 4 // magic(4) + version(u32) + count(u32)
-	for _, p := range files {
-		info, err := os.Stat(p)
-		if err != nil {
-			return 0, err
-		}
-		if info.IsDir() {
-			return 0, fmt.Errorf("directory not supported: %s", p)
-		}
-		name := filepath.Base(p)
-		if name == "" {
-			return 0, fmt.Errorf("bad filename: %s", p)
-		}
-		if len(name) > 65535 {
-			return 0, fmt.Errorf("filename too long: %s", name)
-		}
-		total += 2 + int64(len(name)) + 8 + info.Size() // per-file: nameLen(u16) + name + size(u64) + data
-	}
-	return total, nil
-}
-
-func writeQpkg(w io.Writer, files []string) error {
-	if _, err := w.Write([]byte(qpkgMagic)); err != nil {
-		return err
-	}
-	var b8 [8]byte
-	binary.BigEndian.PutUint32(b8[:4], uint32(qpkgVersion))
-	if _, err := w.Write(b8[:4]); err != nil {
-		return err
-	}
-	binary.BigEndian.PutUint32(b8[:4], uint32(len(files)))
-	if _, err := w.Write(b8[:4]); err != nil {
-		return err
-	}
-
-	buf := make([]byte, 1<<20) // 1 Mb
-	for _, p := range files {
-		name := filepath.Base(p)
-		f, err := os.Open(p)
-		if err != nil {
-			return err
-		}
-
-		if len(name) > 65535 {
-			f.Close()
-			return fmt.Errorf("filename too long: %s", name)
-		}
-		binary.BigEndian.PutUint16(b8[:2], uint16(len(name)))
-		if _, err := w.Write(b8[:2]); err != nil {
-			f.Close()
-			return err
-		}
-		if _, err := w.Write([]byte(name)); err != nil {
-			f.Close()
-			return err
-		}
-
-		info, _ := f.Stat()
-		binary.BigEndian.PutUint64(b8[:8], uint64(info.Size()))
-		if _, err := w.Write(b8[:8]); err != nil {
-			f.Close()
-			return err
-		}
-
-		if _, err := io.CopyBuffer(w, f, buf); err != nil {
-			f.Close()
-			return err
-		}
-		f.Close()
-	}
-	return nil
-}
-
-func uniquePath(p string) string {
-	if _, err := os.Stat(p); os.IsNotExist(err) {
-		return p
-	}
-	dir := filepath.Dir(p)
-	base := filepath.Base(p)
-	ext := filepath.Ext(base)
-	name := strings.TrimSuffix(base, ext)
-	for i := 1; ; i++ {
-		cand := filepath.Join(dir, fmt.Sprintf("%s_%d%s", name, i, ext))
-		if _, err := os.Stat(cand); os.IsNotExist(err) {
-			return cand
-		}
-	}
-}
-
-func unpackQpkg(r io.Reader, dest string) error {
-	var b8 [8]byte
-	magic := make([]byte, 4)
-	if _, err := io.ReadFull(r, magic); err != nil {
-		return err
-	}
-	if string(magic) != qpkgMagic {
-		return fmt.Errorf("bad qpkg magic")
-	}
-	if _, err := io.ReadFull(r, b8[:4]); err != nil {
-		return err
-	}
-	ver := binary.BigEndian.Uint32(b8[:4])
-	if ver != uint32(qpkgVersion) {
-		return fmt.Errorf("unsupported qpkg version %d", ver)
-	}
-	if _, err := io.ReadFull(r, b8[:4]); err != nil {
-		return err
-	}
-	n := int(binary.BigEndian.Uint32(b8[:4]))
-
-	for i := 0; i < n; i++ {
-		if _, err := io.ReadFull(r, b8[:2]); err != nil {
-			return err
-		}
-		nl := int(binary.BigEndian.Uint16(b8[:2]))
-		if nl <= 0 || nl > 65535 {
-			return fmt.Errorf("bad name length")
-		}
-		name := make([]byte, nl)
-		if _, err := io.ReadFull(r, name); err != nil {
-			return err
-		}
-		clean := filepath.Base(string(name))
-		if clean == "" || clean == "." {
-			clean = fmt.Sprintf("file_%d", i+1)
-		}
-		clean = sanitizeFileName(clean)
-
-		if _, err := io.ReadFull(r, b8[:8]); err != nil {
-			return err
-		}
-		sz := int64(binary.BigEndian.Uint64(b8[:8]))
-
-		outPath := uniquePath(filepath.Join(dest, clean))
-		out, err := os.Create(outPath)
-		if err != nil {
-			return err
-		}
-		if _, err := io.CopyN(out, r, sz); err != nil {
-			out.Close()
-			return err
-		}
-		if err := out.Close(); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *widget.Label) {
+// ShowMultiEncryptWindow opens the list of files for one archive, starting with the paths in prefill.
+func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *widget.Label, prefill []string) {
 	files := []string{}
+	sizes := map[string]int64{}
+	imported := map[string]qds.Entry{} // row key -> entry of an imported zip/tar
+	importedFrom := map[string]string{}
+	var sources []*foreignArchive
 	selected := -1
 	var totalSize int64
 	var dlg *dialog.CustomDialog
 
-	human := func(n int64) string {
-		const kb = 1024
-		const mb = 1024 * kb
-		const gb = 1024 * mb
-		switch {
-		case n >= gb:
-			return fmt.Sprintf("%.2f Gb", float64(n)/float64(gb))
-		case n >= mb:
-			return fmt.Sprintf("%.2f Mb", float64(n)/float64(mb))
-		case n >= kb:
-			return fmt.Sprintf("%.2f Kb", float64(n)/float64(kb))
-		default:
-			return fmt.Sprintf("%d B", n)
+	forget := func(key string) {
+		delete(sizes, key)
+		delete(imported, key)
+		delete(importedFrom, key)
+	}
+	closeSources := func() {
+		for _, s := range sources {
+			s.Close()
 		}
+		sources = nil
 	}
+
+	human := humanSize
 	recalc := func() {
 		var sum int64
 		for _, p := range files {
-			if st, err := os.Stat(p); err == nil && !st.IsDir() {
-				sum += st.Size()
-			}
+			sum += sizes[p]
 		}
 		totalSize = sum
 	}
@@ -318,14 +148,16 @@ func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *wi
 			return
 		}
 		p := files[i]
-		title := filepath.Base(p)
-		sizeStr := "—"
-		if st, err := os.Stat(p); err == nil && !st.IsDir() {
-			sizeStr = human(st.Size())
+		title, where := filepath.Base(p), filepath.Dir(p)
+		if e, ok := imported[p]; ok {
+			title, where = importedEntryTitle(importedFrom[p], e)
+		} else if st, err := os.Stat(p); err == nil && st.IsDir() {
+			title += string(filepath.Separator)
 		}
+		sizeStr := human(sizes[p])
 		v := o.(*fyne.Container)
 		v.Objects[0].(*widget.Label).SetText(title)
-		v.Objects[1].(*widget.Label).SetText(filepath.Dir(p) + "  •  " + sizeStr)
+		v.Objects[1].(*widget.Label).SetText(where + "  •  " + sizeStr)
 	}
 
 	list := widget.NewList(
@@ -344,12 +176,21 @@ func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *wi
 			if p == "" {
 				continue
 			}
-			if st, err := os.Stat(p); err == nil && !st.IsDir() {
-				if !exists[p] {
-					files = append(files, p)
-					exists[p] = true
-				}
+			if exists[p] {
+				continue
+			}
+			entries, err := qds.CollectEntries([]string{p})
+			if err != nil {
+				uiLog(logs, fmt.Sprintf(tr("open_error"), err))
+				continue
 			}
+			var sz int64
+			for _, e := range entries {
+				sz += e.Size
+			}
+			files = append(files, p)
+			sizes[p] = sz
+			exists[p] = true
 		}
 	}
 
@@ -380,23 +221,55 @@ func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *wi
 				if err != nil || listURI == nil {
 					return
 				}
-				entries, _ := listURI.List()
-				toAdd := []string{}
-				for _, u := range entries {
-					if u == nil {
+				addUnique(listURI.Path())
+				list.Refresh()
+				updateInfo()
+			}, win)
+			fdlg.Resize(fyne.NewSize(800, 650))
+			fdlg.Show()
+		},
+	)
+
+	importBtn := widget.NewButtonWithIcon(
+		tr("import_archive"),
+		iconFrom("assets/addfolder.png", theme.UploadIcon()),
+		func() {
+			fd := dialog.NewFileOpen(func(rc fyne.URIReadCloser, err error) {
+				if err != nil || rc == nil {
+					return
+				}
+				p := rc.URI().Path()
+				rc.Close()
+				if !isForeignArchive(p) {
+					dialog.ShowError(fmt.Errorf(tr("import_unsupported")), win)
+					return
+				}
+				src, entries, skipped, err := importForeignArchive(p)
+				if err != nil {
+					dialog.ShowError(fmt.Errorf(tr("import_error"), err), win)
+					return
+				}
+				for _, name := range skipped {
+					uiLog(logs, fmt.Sprintf(tr("import_skipped_unsafe"), name))
+				}
+				sources = append(sources, src)
+				for _, e := range entries {
+					key := p + "\x00" + e.Name
+					if _, dup := imported[key]; dup {
 						continue
 					}
-					p := u.Path()
-					if st, err := os.Stat(p); err == nil && !st.IsDir() {
-						toAdd = append(toAdd, p)
-					}
+					imported[key] = e
+					importedFrom[key] = p
+					sizes[key] = e.Size
+					files = append(files, key)
 				}
-				addUnique(toAdd...)
+				uiLog(logs, fmt.Sprintf(tr("imported_entries"), len(entries), filepath.Base(p)))
 				list.Refresh()
 				updateInfo()
 			}, win)
-			fdlg.Resize(fyne.NewSize(800, 650))
-			fdlg.Show()
+			fd.SetFilter(foreignArchiveFilter{})
+			fd.Resize(fyne.NewSize(800, 650))
+			fd.Show()
 		},
 	)
 
@@ -405,6 +278,7 @@ func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *wi
 		iconFrom("assets/remove.png", theme.DeleteIcon()),
 		func() {
 			if selected >= 0 && selected < len(files) {
+				forget(files[selected])
 				files = append(files[:selected], files[selected+1:]...)
 				selected = -1
 				list.Refresh()
@@ -417,7 +291,11 @@ func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *wi
 		tr("clear"),
 		iconFrom("assets/clear.png", theme.ViewRefreshIcon()),
 		func() {
+			for _, p := range files {
+				forget(p)
+			}
 			files = files[:0]
+			closeSources()
 			selected = -1
 			list.Refresh()
 			updateInfo()
@@ -432,16 +310,37 @@ func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *wi
 				dialog.ShowInformation(tr("warning"), tr("nothing_selected"), win)
 				return
 			}
-			if totalSize > MaxPlainSize {
+			if totalSize > qds.MaxPlainSize {
 				dialog.ShowError(fmt.Errorf(tr("file_too_big")), win)
 				return
 			}
-			targetIdx := selectedUserIdx
-			if !isCenterMode {
-				targetIdx = localUserIndex
+			var entries []qds.Entry
+			used := map[string]bool{}
+			names := make([]string, 0, len(files))
+			for _, p := range files {
+				if e, ok := imported[p]; ok {
+					e.Name = qds.UniqueEntryName(used, e.Name)
+					entries = append(entries, e)
+					names = append(names, importedFrom[p])
+					continue
+				}
+				es, err := qds.CollectEntriesInto(used, []string{p})
+				if err != nil {
+					dialog.ShowError(err, win)
+					return
+				}
+				entries = append(entries, es...)
+				names = append(names, p)
 			}
+			// packing closes the imported archives once it is done with them
+			srcs := sources
+			sources = nil
 			dlg.Hide()
-			encryptFilesAsQpkg(win, logs, keysLeft, files, targetIdx)
+			encryptFilesAsQpkg(win, logs, keysLeft, entries, suggestArchiveName(names), func() {
+				for _, s := range srcs {
+					s.Close()
+				}
+			})
 		},
 	)
 
@@ -456,9 +355,10 @@ func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *wi
 	}
 
 	actionsGrid := container.New(
-		layout.NewGridLayoutWithColumns(5),
+		layout.NewGridLayoutWithColumns(6),
 		wrap(160, addFilesBtn),
 		wrap(160, addFolderBtn),
+		wrap(160, importBtn),
 		wrap(160, removeBtn),
 		wrap(160, clearBtn),
 		wrap(160, encryptBtn),
@@ -479,129 +379,60 @@ func ShowMultiEncryptWindow(win fyne.Window, logs *widget.RichText, keysLeft *wi
 	)
 
 	dlg = dialog.NewCustom(tr("multiple_files"), tr("close"), content, win)
-	dlg.Resize(fyne.NewSize(860, 560))
+	dlg.Resize(fyne.NewSize(1040, 560))
+	dlg.SetOnClosed(closeSources)
 
+	addUnique(prefill...)
+	list.Refresh()
 	updateInfo()
 	dlg.Show()
 }
 
-func encryptFilesAsQpkg(win fyne.Window, logs *widget.RichText, keysLeft *widget.Label, files []string, targetIdx int) {
-	useSession := keyPrefIsSession()
-	rKey, keyTypeByte, circleNo, usedIdx, err := chooseKeyForEncryption(targetIdx, useSession)
-	if err != nil || rKey == nil {
-		dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
-		return
+// encryptFilesAsQpkg packs entries into one container; done runs once packing has finished reading
+// the sources, or at once when it doesn't start.
+func encryptFilesAsQpkg(win fyne.Window, logs *widget.RichText, keysLeft *widget.Label, entries []qds.Entry, suggested string, done func()) {
+	totalLen, err := qds.ArchiveSize(entries)
+	if err == nil && totalLen > qds.MaxPlainSize {
+		err = fmt.Errorf(tr("file_too_big"))
 	}
-
-	totalLen, err := qpkgPlainLen(files)
 	if err != nil {
+		if done != nil {
+			done()
+		}
 		dialog.ShowError(err, win)
 		return
 	}
-	if totalLen > MaxPlainSize {
-		dialog.ShowError(fmt.Errorf(tr("file_too_big")), win)
-		return
-	}
 
-	iv := make([]byte, qalqan.BLOCKLEN)
-	if _, err := crand.Read(iv); err != nil {
-		uiLog(logs, fmt.Sprintf(tr("iv_generation_error"), err))
-		return
-	}
-
-	svc := buildServiceInfo(FileTypeGeneric, keyTypeByte, circleNo, usedIdx+1)
-	setMultiFlag(&svc)
-
-	pr, pw := io.Pipe()
-	go func() { _ = pw.CloseWithError(writeQpkg(pw, files)) }()
-
-	uiProgressStart(tr("encrypting"))
-
-	go func() {
-		defer pr.Close()
-
-		ctBuf := &bytes.Buffer{}
-		src := &progressReader{
-			r:     pr,
-			total: totalLen,
-			emit:  func(f float64) { runOnMain(func() { uiProgressSet(f) }) },
+	useSession, targets := keyPrefIsSession(), encryptionTargets()
+	runJob(fmt.Sprintf(tr("job_encrypt"), suggested), totalLen, func(j *job) error {
+		out, res, err := buildQpkgContainer(logs, entries, useSession, targets, j)
+		if done != nil {
+			done()
 		}
-
-		var encErr error
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					encErr = fmt.Errorf("encrypt failed: %v", r)
-				}
-			}()
-			qalqan.EncryptOFB_File(int(totalLen), rKey, iv, src, ctBuf)
-		}()
-		if encErr != nil {
+		if err != nil {
+			if j.ctx.Err() != nil {
+				return err
+			}
 			runOnMain(func() {
-				uiProgressDone()
-				dialog.ShowError(encErr, win)
+				shown := err
+				if errors.Is(err, qds.ErrNoKeys) {
+					addLog(logs, err.Error())
+					shown = fmt.Errorf(tr("need_keys_first"))
+				}
+				dialog.ShowError(shown, win)
 			})
-			return
+			return err
 		}
+		journalSealed(logs, res, qds.JournalArchive, suggested, viaWindow)
 
-		out := &bytes.Buffer{}
-		out.Write(svc[:])
-
-		meta := make([]byte, qalqan.BLOCKLEN)
-		qalqan.Qalqan_Imit(uint64(qalqan.BLOCKLEN), rimitkey, bytes.NewReader(svc[:]), meta)
-		out.Write(meta)
-
-		out.Write(iv)
-		out.Write(ctBuf.Bytes())
-
-		fileImit := make([]byte, qalqan.BLOCKLEN)
-		qalqan.Qalqan_Imit(uint64(out.Len()), rimitkey, bytes.NewReader(out.Bytes()), fileImit)
-		out.Write(fileImit)
-
-		if useSession && usedIdx >= 0 {
-			runOnMain(func() { keysLeft.SetText(formatKeysLeft(targetIdx)) })
-			persistKeysToDiskAsync(logs)
+		if res.Session {
+			runOnMain(func() { keysLeft.SetText(formatKeysLeft(res.Recipients[0])) })
+		}
+		if len(res.Recipients) > 1 {
+			uiLog(logs, fmt.Sprintf(tr("encrypted_for_recipients"), recipientsLabel(res.Recipients)))
 		}
 
-		runOnMain(func() {
-			saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
-				if err != nil {
-					addLog(logs, fmt.Sprintf(tr("save_error"), err))
-					return
-				}
-				if writer == nil {
-					uiProgressDone()
-					return
-				}
-				go func() {
-					defer writer.Close()
-					data := out.Bytes()
-					const chunk = 8 << 20 // 8MB
-					for off := 0; off < len(data); off += chunk {
-						end := off + chunk
-						if end > len(data) {
-							end = len(data)
-						}
-						if _, werr := writer.Write(data[off:end]); werr != nil {
-							runOnMain(func() {
-								addLog(logs, fmt.Sprintf(tr("write_error"), werr))
-								uiProgressDone()
-							})
-							return
-						}
-						runOnMain(func() { uiProgressSet(float64(end) / float64(len(data))) })
-					}
-					runOnMain(func() {
-						uiProgressDone()
-						addLog(logs, tr("encrypt_saved_ok"))
-					})
-				}()
-			}, win)
-
-			saveDialog.Resize(fyne.NewSize(700, 700))
-			saveDialog.SetFileName(suggestArchiveName(files))
-			saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".bin"}))
-			saveDialog.Show()
-		})
-	}()
+		saveEncryptedOutput(win, logs, out.Bytes(), suggested, armorOutput)
+		return nil
+	})
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+var selectedRecipients []int
+
+func encryptionTargets() []int {
+	if !isCenterMode {
+		return []int{localUserIndex}
+	}
+	if len(selectedRecipients) > 0 {
+		return append([]int(nil), selectedRecipients...)
+	}
+	return []int{selectedUserIdx}
+}
+
+func recipientsLabel(targets []int) string {
+	if len(targets) == 1 {
+		return userOption(targets[0])
+	}
+	return fmt.Sprintf(tr("n_recipients"), len(targets))
+}
+
+func ShowRecipientsPicker(win fyne.Window, onDone func()) {
+	opts := userOptions()
+	group := widget.NewCheckGroup(opts, nil)
+	sel := make([]string, 0, len(selectedRecipients))
+	for _, u := range encryptionTargets() {
+		sel = append(sel, userOption(u))
+	}
+	group.SetSelected(sel)
+
+	selectAll := widget.NewButton(tr("select_all"), func() { group.SetSelected(opts) })
+	selectNone := widget.NewButton(tr("select_none"), func() { group.SetSelected(nil) })
+
+	scroll := container.NewVScroll(group)
+	scroll.SetMinSize(fyne.NewSize(260, 320))
+
+	content := container.NewBorder(
+		container.NewGridWithColumns(2, selectAll, selectNone), nil, nil, nil,
+		scroll,
+	)
+
+	d := dialog.NewCustomConfirm(tr("select_recipients"), tr("save"), tr("cancel"), content, func(ok bool) {
+		if !ok {
+			return
+		}
+		picked := make([]int, 0, len(group.Selected))
+		for _, s := range group.Selected {
+			if u, ok := parseUserOption(s); ok {
+				picked = append(picked, u)
+			}
+		}
+		if len(picked) == 0 {
+			return
+		}
+		sort.Ints(picked)
+		selectedRecipients = picked
+		selectedUserIdx = picked[0]
+		if onDone != nil {
+			onDone()
+		}
+	}, win)
+	d.Resize(fyne.NewSize(340, 460))
+	d.Show()
+}
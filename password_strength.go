@@ -0,0 +1,262 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+)
+
+// A password is scored from 0 to 4 by an estimate of its entropy in bits. Characters that are
+// part of a common password, a dictionary word, a keyboard walk or a repeat add only the few
+// bits it takes to guess the pattern, not the bits of every character in it.
+const (
+	defaultPasswordMinScore  = 3
+	defaultPasswordMinLength = 10
+)
+
+var (
+	passwordMinScoreChoices  = []int{1, 2, 3, 4}
+	passwordMinLengthChoices = []int{8, 10, 12, 14, 16, 20}
+
+	passwordScoreBits = []float64{30, 45, 60, 75} // bits needed for the scores 1 to 4
+)
+
+func passwordMinScore() int {
+	return fyne.CurrentApp().Preferences().IntWithFallback("password_min_score", defaultPasswordMinScore)
+}
+
+func passwordMinLength() int {
+	return fyne.CurrentApp().Preferences().IntWithFallback("password_min_length", defaultPasswordMinLength)
+}
+
+func passwordScoreLabel(score int) string {
+	return tr([]string{"strength_very_weak", "strength_weak", "strength_fair", "strength_strong", "strength_very_strong"}[min(max(score, 0), 4)])
+}
+
+var commonPasswords = toSet(`
+123456 1234567 12345678 123456789 1234567890 111111 000000 121212 123123 654321 666666 696969
+112233 159753 147258 123321 987654321 7777777 555555 qwerty qwerty123 qwertyuiop 1q2w3e4r
+1q2w3e4r5t 1qaz2wsx zaq12wsx qazwsx asdfgh asdfghjkl zxcvbnm password password1 password123
+passw0rd p@ssw0rd letmein welcome welcome1 admin admin123 administrator root toor login
+master hello iloveyou princess sunshine monkey dragon football baseball superman batman
+trustno1 shadow michael jennifer charlie jordan freedom whatever starwars computer internet
+secret abc123 abcdef abcd1234 changeme default guest test test123 temp temp123 user user123
+qwe123 zxc123 aa123456 111222 qwer1234 access flower hottie lovely ninja mustang pokemon
+killer soccer hockey ranger buster thomas tigger robert daniel andrew joshua pepper ginger
+parol parol123 privet qalqan qalqan123 ytrewq йцукен пароль привет любовь
+`)
+
+var dictionaryWords = toSet(`
+password passwd pass word admin user login welcome hello love lover secret master super
+system server office work home family friend money dragon monkey tiger eagle shadow sunshine
+summer winter spring autumn flower garden house phone mobile computer internet google apple
+windows linux micro soft orange banana cherry lemon chocolate coffee football soccer hockey
+baseball basket game games player star stars moon light dark black white green blue yellow
+purple silver gold golden diamond angel devil heaven happy lucky magic power king queen
+prince princess lady baby girl boy mother father sister brother daddy mommy december january
+february march april june july august september october november monday friday sunday
+letmein trust change default guest access enter open private public key keys data file
+files secure security qalqan kazakhstan astana almaty moscow russia london paris america
+parol privet lyubov drug kuat bala aruzhan nurlan
+пароль привет любовь друг солнце мама папа семья работа москва россия казахстан астана
+алматы сәлем құпия кілт
+`)
+
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+	"1qaz", "2wsx", "3edc", "4rfv", "5tgb", "6yhn", "7ujm", "8ik,", "9ol.", "0p;/",
+	"ё1234567890-=", "йцукенгшщзхъ\\", "фывапролджэ", "ячсмитьбю.",
+	"abcdefghijklmnopqrstuvwxyz", "абвгдеёжзийклмнопрстуфхцчшщъыьэюя", "789456123",
+}
+
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "@", "a", "$", "s", "!", "i", "|", "l", "+", "t")
+
+func toSet(list string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(list) {
+		set[w] = true
+	}
+	return set
+}
+
+// passwordCheck holds what is known of a password: the rules it meets, the patterns found in it
+// and its score.
+type passwordCheck struct {
+	Len, Upper, Lower, Digit, Special bool
+
+	Common, Word, Keyboard, Repeat bool
+
+	Bits  float64
+	Score int
+}
+
+func (c passwordCheck) ok() bool {
+	return c.Len && c.Upper && c.Lower && c.Digit && c.Special &&
+		!c.Common && !c.Word && !c.Keyboard && !c.Repeat && c.Score >= passwordMinScore()
+}
+
+func checkPassword(p string) passwordCheck {
+	var c passwordCheck
+	runes := []rune(p)
+	c.Len = len(runes) >= passwordMinLength()
+
+	pool := 0
+	var latinLower, latinUpper, otherLower, otherUpper, space bool
+	for _, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			c.Upper = true
+			latinUpper = latinUpper || r < unicode.MaxASCII
+			otherUpper = otherUpper || r >= unicode.MaxASCII
+		case unicode.IsLower(r):
+			c.Lower = true
+			latinLower = latinLower || r < unicode.MaxASCII
+			otherLower = otherLower || r >= unicode.MaxASCII
+		case unicode.IsDigit(r):
+			c.Digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			c.Special = true
+		default:
+			space = true // spaces and the like
+		}
+	}
+	for _, class := range []struct {
+		has  bool
+		size int
+	}{{latinLower, 26}, {latinUpper, 26}, {otherLower, 42}, {otherUpper, 42}, {c.Digit, 10}, {c.Special, 33}, {space, 10}} {
+		if class.has {
+			pool += class.size
+		}
+	}
+	if len(runes) == 0 {
+		return c
+	}
+
+	lower := []rune(strings.ToLower(p))
+	plain := []rune(leet.Replace(string(lower)))
+	if len(plain) != len(lower) {
+		plain = lower
+	}
+	covered := make([]bool, len(lower))
+	bits := 0.0
+	cover := func(i, n int, patternBits float64) {
+		for j := i; j < i+n; j++ {
+			covered[j] = true
+		}
+		bits += patternBits
+	}
+
+	notLetter := func(r rune) bool { return !unicode.IsLetter(r) }
+	if commonPasswords[string(lower)] || commonPasswords[string(plain)] ||
+		commonPasswords[strings.TrimFunc(string(lower), notLetter)] {
+		c.Common = true
+		c.Bits = math.Log2(float64(len(commonPasswords)))
+		return c
+	}
+
+	wordBits := math.Log2(float64(len(dictionaryWords))) + 1
+	for _, s := range [][]rune{lower, plain} {
+		for i := 0; i < len(s); i++ {
+			for n := len(s) - i; n >= 4; n-- {
+				w := string(s[i : i+n])
+				if dictionaryWords[w] || dictionaryWords[reverse(w)] {
+					c.Word = true
+					if !covered[i] {
+						cover(i, n, wordBits)
+					}
+					break
+				}
+			}
+		}
+	}
+
+	walkBits := math.Log2(float64(len(keyboardRows) * 20 * 2))
+	for i := 0; i < len(lower); i++ {
+		if n := walkAt(lower, i); n >= 4 {
+			c.Keyboard = true
+			if !covered[i] {
+				cover(i, n, walkBits)
+			}
+			i += n - 1
+		}
+	}
+
+	for i := 0; i < len(lower); i++ {
+		if n, block := repeatAt(lower, i); n > 0 {
+			c.Repeat = true
+			if !covered[i+block] {
+				// the first block is guessed as it is, the rest is the number of repeats
+				cover(i+block, n-block, math.Log2(float64(n/block))+1)
+			}
+			i += n - 1
+		}
+	}
+
+	perChar := math.Log2(float64(max(pool, 1)))
+	for i := range lower {
+		if !covered[i] {
+			bits += perChar
+		}
+	}
+	c.Bits = bits
+	for _, need := range passwordScoreBits {
+		if bits >= need {
+			c.Score++
+		}
+	}
+	return c
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// walkAt is the length of the run of neighbouring keys, or letters or digits in order, that
+// starts at s[i], in either direction.
+func walkAt(s []rune, i int) int {
+	best := 1
+	for _, row := range keyboardRows {
+		r := []rune(row)
+		for at := range r {
+			if r[at] != s[i] {
+				continue
+			}
+			for _, dir := range []int{1, -1} {
+				n := 1
+				for k := at + dir; k >= 0 && k < len(r) && i+n < len(s) && s[i+n] == r[k]; k += dir {
+					n++
+				}
+				best = max(best, n)
+			}
+		}
+	}
+	return best
+}
+
+// repeatAt finds a character repeated three times or more, or a block of two or more repeated,
+// starting at s[i]: n is the length of the whole repeat and block the length of what repeats.
+func repeatAt(s []rune, i int) (n, block int) {
+	run := 1
+	for i+run < len(s) && s[i+run] == s[i] {
+		run++
+	}
+	if run >= 3 {
+		return run, 1
+	}
+	for l := 2; i+2*l <= len(s); l++ {
+		k := 1
+		for i+(k+1)*l <= len(s) && string(s[i+k*l:i+(k+1)*l]) == string(s[i:i+l]) {
+			k++
+		}
+		if k >= 2 {
+			return k * l, l
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+)
+
+func TestCheckPassword(t *testing.T) {
+	test.NewTempApp(t)
+	for _, tc := range []struct {
+		password string
+		ok       bool
+		score    int
+		check    func(passwordCheck) bool
+	}{
+		{"", false, 0, func(c passwordCheck) bool { return !c.Len }},
+		{"Password123!", false, 0, func(c passwordCheck) bool { return c.Common }},
+		{"Qwertyuiop1!", false, -1, func(c passwordCheck) bool { return c.Keyboard || c.Common }},
+		{"Sunshine#2024x", false, -1, func(c passwordCheck) bool { return c.Word }},
+		{"Zz7!Zz7!Zz7!Zz7!", false, -1, func(c passwordCheck) bool { return c.Repeat }},
+		{"short1A!", false, -1, func(c passwordCheck) bool { return !c.Len }},
+		{"xR7#kQ2m!vL9@pZw", true, 4, nil},
+		{"Gh4$ Tn8& Wq2*", true, -1, nil},
+	} {
+		c := checkPassword(tc.password)
+		if c.ok() != tc.ok || tc.score >= 0 && c.Score != tc.score || tc.check != nil && !tc.check(c) {
+			t.Errorf("%q: %+v", tc.password, c)
+		}
+	}
+
+	// spaces widen the pool once, however many there are
+	one, many := checkPassword("Gh4$ Tn8&Wq2*Lm"), checkPassword("Gh4$ Tn8& Wq2*Lm")
+	if math.Abs(one.Bits/15-many.Bits/16) > 1e-9 {
+		t.Errorf("bits per character: %v with one space, %v with two", one.Bits/15, many.Bits/16)
+	}
+}
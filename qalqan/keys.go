@@ -45,10 +45,13 @@ ________________________________________________________________________________
 [5] - key type circle or session key:
 	  0x00 = circle
       0x01 = session out keys for encrypt, session in key for decrypt
+      0x02 = multi-recipient: data key wrapped with session out key of every recipient
 [6]   = circle_index (0..99)
 [7]   = session_index low8 (lower 8 bits of index 0..999)
 [8]   = session_index_hi2 (2 most significant bits of the index: bits 0..1)
-[9..[15] = reserved/trash
+[9]   = 0x88 - multi-file archive (QPKG)
+[10]  = flags: bit0 - payload compressed (DEFLATE) before encryption
+[11..15] = reserved/trash
 _________________________________________________________________________________________________
 */
 
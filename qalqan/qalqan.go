@@ -330,6 +330,42 @@ func EncryptOFB_File(dataLen int, rKey []byte, iv []byte, ostream io.Reader, sst
 	}
 }
 
+// EncryptOFB_Stream encrypts istream up to EOF, for data whose length is not known in advance,
+// and returns the number of plaintext bytes read. Unlike EncryptOFB_File the last block is always
+// padded, a full one with a block of its own, so DecryptOFB_File restores any data exactly.
+func EncryptOFB_Stream(rKey []byte, iv []byte, istream io.Reader, ostream io.Writer) (int64, error) {
+	tmpBuf := make([]byte, BLOCKLEN)
+	streamBlock := make([]byte, BLOCKLEN)
+	plainBlock := make([]byte, BLOCKLEN)
+
+	copy(tmpBuf, iv)
+	var total int64
+	for {
+		n, err := io.ReadFull(istream, plainBlock)
+		last := false
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			myappend(plainBlock, n)
+			last = true
+		} else if err != nil {
+			return total, fmt.Errorf("read failed: %w", err)
+		}
+		total += int64(n)
+
+		Encrypt(tmpBuf, rKey, DEFAULT_KEY_LEN, BLOCKLEN, streamBlock)
+		copy(tmpBuf, streamBlock)
+
+		for i := 0; i < BLOCKLEN; i++ {
+			streamBlock[i] ^= plainBlock[i]
+		}
+		if _, err := ostream.Write(streamBlock); err != nil {
+			return total, fmt.Errorf("write failed: %w", err)
+		}
+		if last {
+			return total, nil
+		}
+	}
+}
+
 func DecryptOFB_File(dataLen int, rKey []byte, iv []byte, istream io.Reader, ostream io.Writer) error {
 	if dataLen%BLOCKLEN != 0 {
 		return fmt.Errorf("ciphertext length %d is not multiple of block size", dataLen)
@@ -474,6 +510,54 @@ func Qalqan_ImitData(dataLen uint64, rKey []byte, indata []uint8, imit []uint8)
 	copy(imit[:BLOCKLEN], acc[:BLOCKLEN])
 }
 
+// Imit computes the same imit as Qalqan_Imit over data written to it in any pieces,
+// so the length need not be known in advance.
+type Imit struct {
+	rKey  []byte
+	acc   [BLOCKLEN]uint8
+	buf   [BLOCKLEN]uint8
+	n     int
+	total uint64
+}
+
+func NewImit(rKey []byte) *Imit {
+	return &Imit{rKey: rKey}
+}
+
+func (m *Imit) Write(p []byte) (int, error) {
+	written := len(p)
+	m.total += uint64(written)
+	for len(p) > 0 {
+		c := copy(m.buf[m.n:], p)
+		m.n += c
+		p = p[c:]
+		if m.n == BLOCKLEN {
+			for j := 0; j < BLOCKLEN; j++ {
+				m.acc[j] ^= m.buf[j]
+			}
+			Encrypt(m.acc[:], m.rKey, DEFAULT_KEY_LEN, BLOCKLEN, m.acc[:])
+			m.n = 0
+		}
+	}
+	return written, nil
+}
+
+// Sum writes the imit of the data so far; more data can be written afterwards.
+func (m *Imit) Sum(imit []uint8) {
+	acc := m.acc
+	if m.total == 0 {
+		Encrypt(acc[:], m.rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
+	} else if m.n > 0 {
+		buf := m.buf
+		myappend(buf[:], m.n)
+		for j := 0; j < BLOCKLEN; j++ {
+			acc[j] ^= buf[j]
+		}
+		Encrypt(acc[:], m.rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
+	}
+	copy(imit[:BLOCKLEN], acc[:])
+}
+
 func Myremove(buf *uint8) int {
 	b := (*[BLOCKLEN]uint8)(unsafe.Pointer(buf))[:]
 	last := b[BLOCKLEN-1]
@@ -0,0 +1,346 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	"bytes"
+	"compress/flate"
+	"context"
+	crand "crypto/rand"
+	"fmt"
+	"io"
+)
+
+type EncryptOptions struct {
+	// Recipients are the users a center key file encrypts for; several need session keys.
+	// A user key file always encrypts for the center and ignores them.
+	Recipients []int
+	// Circle uses a circle key instead of a session key.
+	Circle   bool
+	FileType byte
+	// Compress deflates the payload first, except photos and videos.
+	// A single file is stored compressed only when that makes it smaller.
+	Compress bool
+	// Message marks a text typed by hand; readers show it instead of saving a file.
+	Message bool
+	Armor   bool
+	// Progress, if not nil, gets the share of the input encrypted so far.
+	Progress func(float64)
+	// Context, if not nil, stops the work with its error once it is done.
+	// Keys taken before that stay used.
+	Context context.Context
+}
+
+type EncryptResult struct {
+	// Recipients are the session key sets used: users of center.bin, 0 for a user key file.
+	Recipients []int
+	// KeyIndexes are the keys used for each of Recipients, or the circle key.
+	KeyIndexes []int
+	Session    bool
+	Compressed bool
+	PlainSize  int64
+	StoredSize int64 // the payload as encrypted, after compression
+}
+
+// EncryptFile reads r, up to MaxPlainSize, and writes it to w as one container.
+// Session keys are used up and the key file saved before anything is written.
+func (k *Keyring) EncryptFile(w io.Writer, r io.Reader, opts EncryptOptions) (*EncryptResult, error) {
+	lr := &io.LimitedReader{R: withContext(opts.Context, r), N: MaxPlainSize + 1}
+	data, err := io.ReadAll(lr)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxPlainSize {
+		return nil, ErrTooBig
+	}
+
+	res := &EncryptResult{PlainSize: int64(len(data)), StoredSize: int64(len(data))}
+	var flags byte
+	if opts.Message {
+		flags |= flagMessage
+	}
+	if opts.Compress && compressible(opts.FileType) {
+		packed, err := compressStream(bytes.NewReader(data))
+		if err == nil && packed.Len() < len(data) {
+			data = packed.Bytes()
+			flags |= flagCompressed
+			res.Compressed, res.StoredSize = true, int64(len(data))
+		}
+	}
+
+	iv := make([]byte, qalqan.BLOCKLEN)
+	if _, err := crand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	if err := contextErr(opts.Context, nil); err != nil {
+		return nil, err
+	}
+	plan, err := k.plan(&opts)
+	if err != nil {
+		return nil, err
+	}
+	plan.svc[svcFlagsIdx] |= flags
+	res.Recipients, res.KeyIndexes, res.Session = plan.recipients, plan.keyIndexes, plan.session
+
+	var src io.Reader = withContext(opts.Context, bytes.NewReader(data))
+	if opts.Progress != nil {
+		src = &progressReader{r: src, total: int64(len(data)), emit: opts.Progress}
+	}
+	ct, err := encryptOFB(len(data), plan.rKey, iv, src)
+	if err != nil {
+		return nil, contextErr(opts.Context, err)
+	}
+	return res, k.write(w, plan, iv, ct, opts.Armor)
+}
+
+// EncryptArchive packs entries into a QPKG archive and writes it to w as one container.
+// Every source has been read and closed when it returns.
+func (k *Keyring) EncryptArchive(w io.Writer, entries []Entry, opts EncryptOptions) (*EncryptResult, error) {
+	totalLen, err := ArchiveSize(entries)
+	if err != nil {
+		return nil, err
+	}
+	if totalLen > MaxPlainSize {
+		return nil, ErrTooBig
+	}
+
+	iv := make([]byte, qalqan.BLOCKLEN)
+	if _, err := crand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	opts.FileType = FileTypeGeneric
+	if err := contextErr(opts.Context, nil); err != nil {
+		return nil, err
+	}
+	plan, err := k.plan(&opts)
+	if err != nil {
+		return nil, err
+	}
+	plan.svc[svcArchiveIdx] = svcArchive
+	compress := opts.Compress
+	if compress {
+		plan.svc[svcFlagsIdx] |= flagCompressed
+	}
+	res := &EncryptResult{Recipients: plan.recipients, KeyIndexes: plan.keyIndexes, Session: plan.session, Compressed: compress, PlainSize: totalLen, StoredSize: totalLen}
+
+	pr, pw := io.Pipe()
+	packed := make(chan struct{})
+	go func() {
+		defer close(packed)
+		_ = pw.CloseWithError(WriteArchive(pw, entries))
+	}()
+	defer func() {
+		pr.Close()
+		<-packed
+	}()
+
+	var src io.Reader = withContext(opts.Context, pr)
+	if opts.Progress != nil {
+		src = &progressReader{r: src, total: totalLen, emit: opts.Progress}
+	}
+
+	if compress {
+		buf, err := compressStream(src)
+		if err != nil {
+			return nil, contextErr(opts.Context, err)
+		}
+		src = buf
+		res.StoredSize = int64(buf.Len())
+	}
+
+	ct, err := encryptOFB(int(res.StoredSize), plan.rKey, iv, src)
+	if err != nil {
+		return nil, contextErr(opts.Context, err)
+	}
+	return res, k.write(w, plan, iv, ct, opts.Armor)
+}
+
+// EncryptStream encrypts r up to EOF, whatever its length, and writes the container to w as it goes.
+// With Compress the payload is always stored deflated. Progress is not reported.
+func (k *Keyring) EncryptStream(w io.Writer, r io.Reader, opts EncryptOptions) (*EncryptResult, error) {
+	iv := make([]byte, qalqan.BLOCKLEN)
+	if _, err := crand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	if err := contextErr(opts.Context, nil); err != nil {
+		return nil, err
+	}
+	plan, err := k.plan(&opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Message {
+		plan.svc[svcFlagsIdx] |= flagMessage
+	}
+	res := &EncryptResult{Recipients: plan.recipients, KeyIndexes: plan.keyIndexes, Session: plan.session}
+
+	counted := &countingReader{r: withContext(opts.Context, r)}
+	var src io.Reader = counted
+	if opts.Compress && compressible(opts.FileType) {
+		plan.svc[svcFlagsIdx] |= flagCompressed
+		res.Compressed = true
+		pr, pw := io.Pipe()
+		go func() {
+			fw, _ := flate.NewWriter(pw, flate.DefaultCompression)
+			_, err := io.Copy(fw, counted)
+			if err == nil {
+				err = fw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		src = pr
+	}
+
+	out := w
+	var aw io.WriteCloser
+	if opts.Armor {
+		aw = NewArmorWriter(w)
+		out = aw
+	}
+	m := qalqan.NewImit(k.imitKey)
+	mw := io.MultiWriter(out, m)
+
+	head := append(plan.svc[:], imit(k.imitKey, plan.svc[:])...)
+	head = append(head, plan.header...)
+	head = append(head, iv...)
+	if _, err := mw.Write(head); err != nil {
+		return nil, err
+	}
+	if res.StoredSize, err = qalqan.EncryptOFB_Stream(plan.rKey, iv, src, mw); err != nil {
+		return nil, err
+	}
+	res.PlainSize = counted.n
+
+	sum := make([]byte, qalqan.BLOCKLEN)
+	m.Sum(sum)
+	if _, err := out.Write(sum); err != nil {
+		return nil, err
+	}
+	if aw != nil {
+		if err := aw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(b []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+func withContext(ctx context.Context, r io.Reader) io.Reader {
+	if ctx == nil {
+		return r
+	}
+	return contextReader{ctx, r}
+}
+
+// contextErr reports the end of the context rather than the failed read it caused.
+func contextErr(ctx context.Context, err error) error {
+	if ctx != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// encryptOFB turns the panics of qalqan.EncryptOFB_File into errors.
+func encryptOFB(n int, rKey, iv []byte, src io.Reader) (ct []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("encrypt failed: %v", r)
+		}
+	}()
+	buf := &bytes.Buffer{}
+	qalqan.EncryptOFB_File(n, rKey, iv, src, buf)
+	return buf.Bytes(), nil
+}
+
+// plan uses up the keys for one container and saves the key file if a session key was used.
+func (k *Keyring) plan(opts *EncryptOptions) (*encryptPlan, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return nil, ErrKeyringClosed
+	}
+	plan, err := k.planEncryption(opts)
+	if err != nil {
+		return nil, err
+	}
+	if plan.session {
+		if err := k.save(); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+func (k *Keyring) write(w io.Writer, plan *encryptPlan, iv, ct []byte, armor bool) error {
+	out := k.seal(plan.svc, plan.header, iv, ct)
+	if armor {
+		out = Armor(out)
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// Decrypt reads a container, armored or not, from r and writes the payload to w.
+// An archive is written as its QPKG stream; see NewArchiveReader and Unpack.
+func (k *Keyring) Decrypt(w io.Writer, r io.Reader) (*Container, error) {
+	lr := &io.LimitedReader{R: r, N: MaxArmoredSize + 1}
+	data, err := io.ReadAll(lr)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxArmoredSize {
+		return nil, ErrTooBig
+	}
+
+	c, err := k.OpenContainer(data)
+	if err != nil {
+		return nil, err
+	}
+	return c, k.decryptTo(w, c)
+}
+
+// DecryptStream is Decrypt for a container of any length; see OpenContainerStream.
+func (k *Keyring) DecryptStream(w io.Writer, r io.Reader) (*Container, error) {
+	c, err := k.OpenContainerStream(r)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c, k.decryptTo(w, c)
+}
+
+func (k *Keyring) decryptTo(w io.Writer, c *Container) error {
+	p, err := k.Unlock(c)
+	if err != nil {
+		return err
+	}
+	src := p.Open(nil)
+	defer src.Close()
+	_, err = io.Copy(w, src)
+	return err
+}
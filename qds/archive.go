@@ -0,0 +1,855 @@
+package qds
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+	QPKG (plain multi-file payload):
+
+magic "QPKG" | version (u32) | count (u32) | entries | [v3: index]
+
+v1 entry: nameLen (u16) | base name | size (u64) | data
+
+v2 had entries of its own without checksums or index; it is not read.
+
+v3 entry: header | data | SHA-256 of data [32]
+
+	header = type (u8) | nameLen (u16) | relative path, '/'-separated | mode (u32) | mtime (i64, unix ns) | size (u64)
+	type: 0 = file, 1 = directory (size 0, no data, zero checksum)
+
+v3 index, after the last entry:
+
+	"QIDX" | count (u32) | count × (header | offset of the entry from the start of QPKG (u64) | SHA-256 [32])
+	index offset (u64) | "QEND"
+*/
+const (
+	qpkgMagic        = "QPKG"
+	qpkgVersion uint = 3
+
+	qpkgTypeFile byte = 0
+	qpkgTypeDir  byte = 1
+
+	qpkgIndexMagic   = "QIDX"
+	qpkgTrailerMagic = "QEND"
+	qpkgTrailerLen   = 8 + 4
+)
+
+// Entry is a file or a folder of a QPKG archive.
+type Entry struct {
+	Name   string // '/'-separated path inside the archive
+	Dir    bool
+	Size   int64
+	Mode   fs.FileMode
+	MTime  time.Time
+	Sum    [sha256.Size]byte
+	Offset int64
+
+	// Source supplies the data when packing an entry that is not a file on disk, e.g. an imported zip entry.
+	Source func() (io.ReadCloser, error)
+
+	src string // file on disk, only when packing
+}
+
+// CollectEntries expands the selected files and folders into archive entries.
+// Folders are walked recursively; symlinks and other special files are skipped.
+func CollectEntries(roots []string) ([]Entry, error) {
+	return CollectEntriesInto(map[string]bool{}, roots)
+}
+
+// CollectEntriesInto is CollectEntries with top-level names kept unique across calls via used.
+func CollectEntriesInto(used map[string]bool, roots []string) ([]Entry, error) {
+	var entries []Entry
+	for _, root := range roots {
+		info, err := os.Lstat(root)
+		if err != nil {
+			return nil, err
+		}
+		top := UniqueEntryName(used, filepath.Base(root))
+
+		if !info.IsDir() {
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			entries = append(entries, Entry{Name: top, Size: info.Size(), Mode: info.Mode().Perm(), MTime: info.ModTime(), src: root})
+			continue
+		}
+
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			name := top
+			if rel != "." {
+				name = top + "/" + filepath.ToSlash(rel)
+			}
+			if !d.IsDir() && !d.Type().IsRegular() {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				entries = append(entries, Entry{Name: name, Dir: true, Mode: fi.Mode().Perm(), MTime: fi.ModTime()})
+				return nil
+			}
+			entries = append(entries, Entry{Name: name, Size: fi.Size(), Mode: fi.Mode().Perm(), MTime: fi.ModTime(), src: p})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// UniqueEntryName returns name, or name with a number added if used already has it, and marks the result used.
+func UniqueEntryName(used map[string]bool, name string) string {
+	cand := name
+	ext := filepath.Ext(name)
+	for i := 1; used[cand]; i++ {
+		cand = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[cand] = true
+	return cand
+}
+
+func qpkgHeaderLen(e *Entry) int64 {
+	return 1 + 2 + int64(len(e.Name)) + 4 + 8 + 8 // type + nameLen + name + mode + mtime + size
+}
+
+// ArchiveSize is the length of the QPKG stream WriteArchive produces for entries.
+func ArchiveSize(entries []Entry) (int64, error) {
+	var total int64 = 4 + 4 + 4 // magic(4) + version(u32) + count(u32)
+	var index int64 = 4 + 4     // "QIDX" + count(u32)
+	for i := range entries {
+		e := &entries[i]
+		if e.Name == "" {
+			return 0, fmt.Errorf("bad filename: %s", e.src)
+		}
+		if len(e.Name) > 65535 {
+			return 0, fmt.Errorf("filename too long: %s", e.Name)
+		}
+		total += qpkgHeaderLen(e) + e.Size + sha256.Size
+		index += qpkgHeaderLen(e) + 8 + sha256.Size
+	}
+	return total + index + qpkgTrailerLen, nil
+}
+
+func encodeQpkgHeader(e *Entry) []byte {
+	b := make([]byte, 0, qpkgHeaderLen(e))
+	typ := qpkgTypeFile
+	if e.Dir {
+		typ = qpkgTypeDir
+	}
+	b = append(b, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(e.Name)))
+	b = append(b, e.Name...)
+	b = binary.BigEndian.AppendUint32(b, uint32(e.Mode.Perm()))
+	b = binary.BigEndian.AppendUint64(b, uint64(e.MTime.UnixNano()))
+	b = binary.BigEndian.AppendUint64(b, uint64(e.Size))
+	return b
+}
+
+func readQpkgHeader(r io.Reader) (*Entry, error) {
+	var b8 [8]byte
+	if _, err := io.ReadFull(r, b8[:3]); err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	switch b8[0] {
+	case qpkgTypeFile:
+	case qpkgTypeDir:
+		e.Dir = true
+	default:
+		return nil, fmt.Errorf("bad entry type %d", b8[0])
+	}
+	nl := int(binary.BigEndian.Uint16(b8[1:3]))
+	if nl <= 0 {
+		return nil, fmt.Errorf("bad name length")
+	}
+	name := make([]byte, nl)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+	e.Name = string(name)
+
+	if _, err := io.ReadFull(r, b8[:4]); err != nil {
+		return nil, err
+	}
+	e.Mode = fs.FileMode(binary.BigEndian.Uint32(b8[:4])).Perm()
+	if _, err := io.ReadFull(r, b8[:8]); err != nil {
+		return nil, err
+	}
+	e.MTime = time.Unix(0, int64(binary.BigEndian.Uint64(b8[:8])))
+	if _, err := io.ReadFull(r, b8[:8]); err != nil {
+		return nil, err
+	}
+	e.Size = int64(binary.BigEndian.Uint64(b8[:8]))
+	if e.Size < 0 || (e.Dir && e.Size != 0) {
+		return nil, fmt.Errorf("bad entry size")
+	}
+	return e, nil
+}
+
+type offsetWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+	o.n += int64(n)
+	return n, err
+}
+
+// WriteArchive packs entries into a QPKG v3 stream, reading each file or Source once.
+func WriteArchive(dst io.Writer, entries []Entry) error {
+	w := &offsetWriter{w: dst}
+	if _, err := w.Write([]byte(qpkgMagic)); err != nil {
+		return err
+	}
+	var b8 [8]byte
+	binary.BigEndian.PutUint32(b8[:4], uint32(qpkgVersion))
+	if _, err := w.Write(b8[:4]); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(b8[:4], uint32(len(entries)))
+	if _, err := w.Write(b8[:4]); err != nil {
+		return err
+	}
+
+	index := make([]Entry, len(entries))
+	buf := make([]byte, 1<<20) // 1 Mb
+	for i := range entries {
+		e := entries[i]
+		if len(e.Name) > 65535 {
+			return fmt.Errorf("filename too long: %s", e.Name)
+		}
+		e.Offset = w.n
+		if _, err := w.Write(encodeQpkgHeader(&e)); err != nil {
+			return err
+		}
+
+		if !e.Dir {
+			var f io.ReadCloser
+			var err error
+			if e.Source != nil {
+				f, err = e.Source()
+			} else {
+				f, err = os.Open(e.src)
+			}
+			if err != nil {
+				return err
+			}
+			h := sha256.New()
+			// the size is already in the header, so a file that changed meanwhile must fail here
+			n, err := io.CopyBuffer(io.MultiWriter(w, h), io.LimitReader(f, e.Size), buf)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			if n != e.Size {
+				return fmt.Errorf("%w: %s", ErrArchiveChanged, e.Name)
+			}
+			copy(e.Sum[:], h.Sum(nil))
+		}
+		if _, err := w.Write(e.Sum[:]); err != nil {
+			return err
+		}
+		index[i] = e
+	}
+
+	indexOff := w.n
+	if _, err := w.Write([]byte(qpkgIndexMagic)); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(b8[:4], uint32(len(index)))
+	if _, err := w.Write(b8[:4]); err != nil {
+		return err
+	}
+	for i := range index {
+		e := &index[i]
+		rec := encodeQpkgHeader(e)
+		rec = binary.BigEndian.AppendUint64(rec, uint64(e.Offset))
+		rec = append(rec, e.Sum[:]...)
+		if _, err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint64(b8[:8], uint64(indexOff))
+	if _, err := w.Write(b8[:8]); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte(qpkgTrailerMagic))
+	return err
+}
+
+func readQpkgIndexEntries(r io.Reader) ([]Entry, error) {
+	var b8 [8]byte
+	if _, err := io.ReadFull(r, b8[:8]); err != nil {
+		return nil, err
+	}
+	if string(b8[:4]) != qpkgIndexMagic {
+		return nil, fmt.Errorf("bad qpkg index")
+	}
+	// n isn't trusted: entries grow as they are read, not to what the index claims
+	n := int(binary.BigEndian.Uint32(b8[4:8]))
+	var entries []Entry
+	for i := 0; i < n; i++ {
+		e, err := readQpkgHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, b8[:8]); err != nil {
+			return nil, err
+		}
+		e.Offset = int64(binary.BigEndian.Uint64(b8[:8]))
+		if _, err := io.ReadFull(r, e.Sum[:]); err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, nil
+}
+
+// readQpkgIndex lists a v3 package from its trailing index without reading the entries.
+func readQpkgIndex(ra io.ReaderAt, size int64) ([]Entry, error) {
+	if size < 12+qpkgTrailerLen {
+		return nil, fmt.Errorf("qpkg too short")
+	}
+	head := make([]byte, 8)
+	if _, err := ra.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	if string(head[:4]) != qpkgMagic || binary.BigEndian.Uint32(head[4:8]) < 3 {
+		return nil, fmt.Errorf("qpkg has no index")
+	}
+	tail := make([]byte, qpkgTrailerLen)
+	if _, err := ra.ReadAt(tail, size-qpkgTrailerLen); err != nil {
+		return nil, err
+	}
+	if string(tail[8:]) != qpkgTrailerMagic {
+		return nil, fmt.Errorf("bad qpkg trailer")
+	}
+	off := int64(binary.BigEndian.Uint64(tail[:8]))
+	if off < 12 || off >= size-qpkgTrailerLen {
+		return nil, fmt.Errorf("bad qpkg index offset")
+	}
+	return readQpkgIndexEntries(io.NewSectionReader(ra, off, size-qpkgTrailerLen-off))
+}
+
+// ArchiveReader reads entries one by one, like archive/tar: Next, then Read the entry data.
+// For v3 the last Read of an entry fails with *ChecksumError if its data is damaged.
+type ArchiveReader struct {
+	r       io.Reader
+	version uint32
+	count   int
+	index   int
+	offset  int64
+
+	cur      *Entry
+	data     *io.LimitedReader
+	hash     hash.Hash
+	verified bool
+	sumErr   error
+	seen     []Entry
+}
+
+// NewArchiveReader reads the QPKG header of r; v1 and v3 are accepted.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	var b8 [8]byte
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != qpkgMagic {
+		return nil, fmt.Errorf("bad qpkg magic")
+	}
+	if _, err := io.ReadFull(r, b8[:4]); err != nil {
+		return nil, err
+	}
+	ver := binary.BigEndian.Uint32(b8[:4])
+	if ver != 1 && ver != uint32(qpkgVersion) {
+		return nil, fmt.Errorf("unsupported qpkg version %d", ver)
+	}
+	if _, err := io.ReadFull(r, b8[:4]); err != nil {
+		return nil, err
+	}
+	return &ArchiveReader{r: r, version: ver, count: int(binary.BigEndian.Uint32(b8[:4])), offset: 12}, nil
+}
+
+// Next skips what is left of the current entry and returns the next header, or io.EOF.
+// Skipped entries are not reported as damaged.
+func (q *ArchiveReader) Next() (*Entry, error) {
+	if q.cur != nil {
+		if _, err := io.Copy(io.Discard, q); err != nil {
+			var ce *ChecksumError
+			if !errors.As(err, &ce) {
+				return nil, err
+			}
+		}
+		if err := q.Verify(); err != nil {
+			var ce *ChecksumError
+			if !errors.As(err, &ce) {
+				return nil, err
+			}
+		}
+	}
+	if q.index >= q.count {
+		q.cur = nil
+		if q.version >= 3 {
+			if err := q.checkIndex(); err != nil {
+				return nil, err
+			}
+		}
+		return nil, io.EOF
+	}
+	q.index++
+
+	var e *Entry
+	if q.version >= 3 {
+		var err error
+		if e, err = readQpkgHeader(q.r); err != nil {
+			return nil, err
+		}
+		e.Offset = q.offset
+		q.offset += qpkgHeaderLen(e)
+	} else {
+		var err error
+		if e, err = q.readV1Header(); err != nil {
+			return nil, err
+		}
+	}
+
+	q.cur = e
+	q.hash = sha256.New()
+	q.verified = false
+	q.sumErr = nil
+	q.data = &io.LimitedReader{R: io.TeeReader(q.r, q.hash), N: e.Size}
+	return e, nil
+}
+
+func (q *ArchiveReader) readV1Header() (*Entry, error) {
+	var b8 [8]byte
+	if _, err := io.ReadFull(q.r, b8[:2]); err != nil {
+		return nil, err
+	}
+	nl := int(binary.BigEndian.Uint16(b8[:2]))
+	if nl <= 0 {
+		return nil, fmt.Errorf("bad name length")
+	}
+	name := make([]byte, nl)
+	if _, err := io.ReadFull(q.r, name); err != nil {
+		return nil, err
+	}
+	// v1 stored base names only
+	clean := filepath.Base(string(name))
+	if clean == "" || clean == "." {
+		clean = fmt.Sprintf("file_%d", q.index)
+	}
+	if _, err := io.ReadFull(q.r, b8[:8]); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint64(b8[:8]))
+	if size < 0 {
+		return nil, fmt.Errorf("bad entry size")
+	}
+	return &Entry{Name: SanitizeFileName(clean), Size: size, Mode: 0o644}, nil
+}
+
+func (q *ArchiveReader) Read(p []byte) (int, error) {
+	if q.cur == nil || q.data == nil {
+		return 0, io.EOF
+	}
+	if q.data.N == 0 {
+		if err := q.Verify(); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	n, err := q.data.Read(p)
+	q.offset += int64(n)
+	if err == io.EOF && q.data.N > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && q.data.N == 0 {
+		err = q.Verify()
+	}
+	return n, err
+}
+
+// Verify reads the stored checksum once the entry data is fully read;
+// later calls return the same result.
+func (q *ArchiveReader) Verify() error {
+	if q.verified || q.version < 3 {
+		return q.sumErr
+	}
+	q.verified = true
+	var sum [sha256.Size]byte
+	if _, err := io.ReadFull(q.r, sum[:]); err != nil {
+		q.sumErr = err
+		return err
+	}
+	q.offset += sha256.Size
+	q.seen = append(q.seen, *q.cur)
+	q.seen[len(q.seen)-1].Sum = sum
+
+	if q.cur.Dir {
+		return nil
+	}
+	var got [sha256.Size]byte
+	copy(got[:], q.hash.Sum(nil))
+	if got != sum {
+		q.sumErr = &ChecksumError{Name: q.cur.Name}
+	}
+	return q.sumErr
+}
+
+// checkIndex makes sure the trailing index describes exactly the entries that were read.
+func (q *ArchiveReader) checkIndex() error {
+	idx, err := readQpkgIndexEntries(q.r)
+	if err != nil {
+		return err
+	}
+	if len(idx) != len(q.seen) {
+		return fmt.Errorf("qpkg index does not match entries")
+	}
+	for i := range idx {
+		a, b := &idx[i], &q.seen[i]
+		if a.Name != b.Name || a.Dir != b.Dir || a.Size != b.Size || a.Offset != b.Offset || !bytes.Equal(a.Sum[:], b.Sum[:]) {
+			return fmt.Errorf("qpkg index does not match entry %s", b.Name)
+		}
+	}
+	var tail [qpkgTrailerLen]byte
+	if _, err := io.ReadFull(q.r, tail[:]); err != nil {
+		return err
+	}
+	if string(tail[8:]) != qpkgTrailerMagic {
+		return fmt.Errorf("bad qpkg trailer")
+	}
+	return nil
+}
+
+// SanitizeFileName makes s a valid file name on every platform.
+func SanitizeFileName(s string) string {
+	forbidden := `<>:"/\|?*`
+	s = strings.Map(func(r rune) rune {
+		if r < 32 {
+			return -1
+		}
+		if strings.ContainsRune(forbidden, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.Trim(s, " .")
+	if s == "" {
+		s = "archive"
+	}
+	return s
+}
+
+// ValidEntryName reports whether name is a relative, '/'-separated path without "." or ".." components.
+func ValidEntryName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsAny(name, "\\:\x00") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// safeEntryPath maps an archive name to a path under dest. Absolute names,
+// drive letters, ".." and empty components are rejected; every component is
+// made a valid file name.
+func safeEntryPath(dest, name string) (string, error) {
+	if !ValidEntryName(name) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafeEntry, name)
+	}
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = SanitizeFileName(part)
+	}
+	p := filepath.Join(append([]string{dest}, parts...)...)
+	rel, err := filepath.Rel(dest, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafeEntry, name)
+	}
+	return p, nil
+}
+
+// mkdirNoSymlinks creates dir and its parents below dest, refusing to pass
+// through an existing symlink or non-directory.
+func mkdirNoSymlinks(dest, dir string) error {
+	rel, err := filepath.Rel(dest, dir)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+	cur := dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		info, err := os.Lstat(cur)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(cur, 0o755); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			return fmt.Errorf("symlink in extraction path: %s", cur)
+		case !info.IsDir():
+			return fmt.Errorf("not a directory: %s", cur)
+		}
+	}
+	return nil
+}
+
+// UniquePath returns p, or p with a number added before the extension if p exists.
+func UniquePath(p string) string {
+	if _, err := os.Lstat(p); os.IsNotExist(err) {
+		return p
+	}
+	dir := filepath.Dir(p)
+	base := filepath.Base(p)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	for i := 1; ; i++ {
+		cand := filepath.Join(dir, fmt.Sprintf("%s_%d%s", name, i, ext))
+		if _, err := os.Lstat(cand); os.IsNotExist(err) {
+			return cand
+		}
+	}
+}
+
+// ExtractEntry writes the data of the named file entry to w and verifies it.
+func ExtractEntry(r io.Reader, name string, w io.Writer) error {
+	q, err := NewArchiveReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := q.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+		}
+		if err != nil {
+			return err
+		}
+		if e.Dir || e.Name != name {
+			continue
+		}
+		if _, err := io.CopyN(w, q, e.Size); err != nil {
+			return err
+		}
+		return q.Verify()
+	}
+}
+
+// ListArchive reads every record of the package and returns the entries in order.
+func ListArchive(r io.Reader) ([]Entry, error) {
+	q, err := NewArchiveReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for {
+		e, err := q.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+}
+
+func applyEntryMeta(p string, e *Entry) {
+	if e.Mode != 0 {
+		_ = os.Chmod(p, e.Mode.Perm())
+	}
+	if !e.MTime.IsZero() {
+		_ = os.Chtimes(p, e.MTime, e.MTime)
+	}
+}
+
+type ConflictPolicy int
+
+const (
+	ConflictRename ConflictPolicy = iota
+	ConflictOverwrite
+	ConflictSkip
+	ConflictAsk
+)
+
+type UnpackOptions struct {
+	Policy ConflictPolicy
+	Want   func(*Entry) bool
+	// Ask is called for ConflictAsk from the unpacking goroutine and may block;
+	// all = true applies the answer to the remaining conflicts. An error stops Unpack.
+	Ask func(name string) (action ConflictPolicy, all bool, err error)
+}
+
+type UnpackSummary struct {
+	Written     []string `json:"written"`
+	Renamed     []string `json:"renamed,omitempty"`
+	Overwritten []string `json:"overwritten,omitempty"`
+	Skipped     []string `json:"skipped,omitempty"`
+	Damaged     []string `json:"damaged,omitempty"`
+}
+
+// Unpack extracts the entries opts.Want accepts (all when nil), resolving
+// existing files by opts.Policy. Parent folders of the chosen files are created as needed.
+// Damaged files are removed and listed in the summary; extraction goes on.
+func Unpack(r io.Reader, dest string, opts UnpackOptions) (*UnpackSummary, error) {
+	if real, err := filepath.EvalSymlinks(dest); err == nil {
+		dest = real
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := NewArchiveReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := &UnpackSummary{}
+	policy := opts.Policy
+	var dirs []string
+	var dirEntries []*Entry
+	for {
+		e, err := q.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return sum, err
+		}
+		if opts.Want != nil && !opts.Want(e) {
+			continue
+		}
+
+		p, err := safeEntryPath(dest, e.Name)
+		if err != nil {
+			return sum, err
+		}
+		if e.Dir {
+			if err := mkdirNoSymlinks(dest, p); err != nil {
+				return sum, err
+			}
+			dirs = append(dirs, p)
+			dirEntries = append(dirEntries, e)
+			continue
+		}
+		if err := mkdirNoSymlinks(dest, filepath.Dir(p)); err != nil {
+			return sum, err
+		}
+
+		action := ConflictRename
+		if _, err := os.Lstat(p); err == nil {
+			action = policy
+			if action == ConflictAsk {
+				var all bool
+				if opts.Ask == nil {
+					action = ConflictRename
+				} else if action, all, err = opts.Ask(e.Name); err != nil {
+					return sum, err
+				} else if all {
+					policy = action
+				}
+			}
+			if action == ConflictSkip {
+				sum.Skipped = append(sum.Skipped, e.Name)
+				continue
+			}
+		}
+
+		outPath := p
+		switch action {
+		case ConflictOverwrite:
+			// written aside and renamed over the old file, so a damaged entry leaves it intact
+			// and a symlink at the target is replaced, not followed
+			outPath = UniquePath(p + ".part")
+		default:
+			outPath = UniquePath(p)
+		}
+
+		// O_EXCL also refuses to follow a dangling symlink planted at the target
+		out, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return sum, err
+		}
+		// CopyN drops the error of the final Read, so ask verify for it again
+		_, err = io.CopyN(out, q, e.Size)
+		if err == nil {
+			err = q.Verify()
+		}
+		cerr := out.Close()
+
+		var ce *ChecksumError
+		if errors.As(err, &ce) {
+			os.Remove(outPath)
+			sum.Damaged = append(sum.Damaged, e.Name)
+			continue
+		}
+		if err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(outPath)
+			return sum, err
+		}
+
+		switch {
+		case outPath == p:
+			sum.Written = append(sum.Written, e.Name)
+		case action == ConflictOverwrite:
+			if info, err := os.Lstat(p); err == nil && info.IsDir() {
+				os.Remove(outPath)
+				return sum, fmt.Errorf("not a file: %s", p)
+			}
+			if err := os.Rename(outPath, p); err != nil {
+				os.Remove(outPath)
+				return sum, err
+			}
+			outPath = p
+			sum.Overwritten = append(sum.Overwritten, e.Name)
+		default:
+			rel, _ := filepath.Rel(dest, outPath)
+			sum.Renamed = append(sum.Renamed, e.Name+" → "+filepath.ToSlash(rel))
+		}
+		applyEntryMeta(outPath, e)
+	}
+
+	// directory times last: writing files into a directory changes its mtime
+	for i := len(dirs) - 1; i >= 0; i-- {
+		applyEntryMeta(dirs[i], dirEntries[i])
+	}
+	return sum, nil
+}
@@ -0,0 +1,161 @@
+package qds
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func memEntry(name string, data []byte) Entry {
+	return Entry{
+		Name: name,
+		Size: int64(len(data)),
+		Mode: 0o644,
+		Source: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+	}
+}
+
+func TestEncryptArchive(t *testing.T) {
+	centerPath, userPath := writeTestKeys(t)
+	center := openTest(t, centerPath)
+	user := openTest(t, userPath)
+
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "docs", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "docs", "sub", "a.txt"), []byte("first"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := CollectEntries([]string{filepath.Join(src, "docs")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = append(entries, memEntry("b.txt", bytes.Repeat([]byte("second "), 50)))
+
+	var enc bytes.Buffer
+	res, err := center.EncryptArchive(&enc, entries, EncryptOptions{Recipients: []int{1, 2}, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Session || !res.Compressed || res.StoredSize >= res.PlainSize {
+		t.Fatalf("result: %+v", res)
+	}
+
+	var qpkg bytes.Buffer
+	c, err := user.Decrypt(&qpkg, bytes.NewReader(enc.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Archive() {
+		t.Fatal("archive flag not set")
+	}
+
+	list, err := ListArchive(bytes.NewReader(qpkg.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range list {
+		names = append(names, e.Name)
+	}
+	if len(names) != 4 || names[0] != "docs" || names[2] != "docs/sub/a.txt" || names[3] != "b.txt" {
+		t.Fatalf("entries: %v", names)
+	}
+
+	var one bytes.Buffer
+	if err := ExtractEntry(bytes.NewReader(qpkg.Bytes()), "docs/sub/a.txt", &one); err != nil || one.String() != "first" {
+		t.Fatalf("ExtractEntry: %q %v", one.String(), err)
+	}
+	if err := ExtractEntry(bytes.NewReader(qpkg.Bytes()), "missing", io.Discard); !errors.Is(err, ErrEntryNotFound) {
+		t.Fatalf("missing entry: got %v", err)
+	}
+
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "b.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := Unpack(bytes.NewReader(qpkg.Bytes()), dest, UnpackOptions{Policy: ConflictSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sum.Written) != 1 || len(sum.Skipped) != 1 || sum.Skipped[0] != "b.txt" {
+		t.Fatalf("summary: %+v", sum)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dest, "b.txt")); string(b) != "old" {
+		t.Fatalf("skipped file overwritten: %q", b)
+	}
+}
+
+func TestDamagedEntry(t *testing.T) {
+	var qpkg bytes.Buffer
+	if err := WriteArchive(&qpkg, []Entry{memEntry("a.txt", []byte("abcdef"))}); err != nil {
+		t.Fatal(err)
+	}
+	data := qpkg.Bytes()
+	i := bytes.Index(data, []byte("abcdef"))
+	data[i] = 'X'
+
+	var ce *ChecksumError
+	if err := ExtractEntry(bytes.NewReader(data), "a.txt", io.Discard); !errors.As(err, &ce) || ce.Name != "a.txt" {
+		t.Fatalf("got %v", err)
+	}
+	sum, err := Unpack(bytes.NewReader(data), t.TempDir(), UnpackOptions{})
+	if err != nil || len(sum.Damaged) != 1 {
+		t.Fatalf("Unpack: %+v %v", sum, err)
+	}
+}
+
+func TestAskAbort(t *testing.T) {
+	var qpkg bytes.Buffer
+	if err := WriteArchive(&qpkg, []Entry{memEntry("a.txt", []byte("new"))}); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	os.WriteFile(filepath.Join(dest, "a.txt"), []byte("old"), 0o644)
+	stop := errors.New("stop")
+	ask := func(string) (ConflictPolicy, bool, error) { return ConflictSkip, false, stop }
+	if _, err := Unpack(bytes.NewReader(qpkg.Bytes()), dest, UnpackOptions{Policy: ConflictAsk, Ask: ask}); !errors.Is(err, stop) {
+		t.Fatalf("got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "a.txt")); string(data) != "old" {
+		t.Fatalf("a.txt: %q", data)
+	}
+}
+
+func TestArchiveVersion(t *testing.T) {
+	// v2 packages had another entry layout and are refused, not read as damaged
+	v2 := []byte("QPKG\x00\x00\x00\x02\x00\x00\x00\x01")
+	if _, err := NewArchiveReader(bytes.NewReader(v2)); err == nil || err.Error() != "unsupported qpkg version 2" {
+		t.Fatalf("v2: %v", err)
+	}
+}
+
+func TestIndexCount(t *testing.T) {
+	// an index that claims 2^32-1 entries and has none
+	idx := append([]byte(qpkgIndexMagic), 0xff, 0xff, 0xff, 0xff)
+	if _, err := readQpkgIndexEntries(bytes.NewReader(idx)); err == nil {
+		t.Fatal("index with missing entries read")
+	}
+}
+
+func TestUnsafeEntry(t *testing.T) {
+	for _, name := range []string{"../evil", "/abs", "a/../../b", `C:\x`, "a//b"} {
+		var qpkg bytes.Buffer
+		if err := WriteArchive(&qpkg, []Entry{memEntry(name, []byte("x"))}); err != nil {
+			t.Fatal(err)
+		}
+		dest := t.TempDir()
+		if _, err := Unpack(bytes.NewReader(qpkg.Bytes()), dest, UnpackOptions{}); !errors.Is(err, ErrUnsafeEntry) {
+			t.Fatalf("%q: got %v", name, err)
+		}
+	}
+	if got := SanitizeFileName(`a<b>:c?.txt`); got != "a_b__c_.txt" {
+		t.Fatalf("SanitizeFileName: %q", got)
+	}
+}
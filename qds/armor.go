@@ -0,0 +1,226 @@
+package qds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+	armored container:
+
+-----BEGIN QALQAN-DS MESSAGE-----
+<base64 of the binary container, 64 chars per line>
+=<base64 of CRC-24 (OpenPGP polynomial) of the binary container>
+-----END QALQAN-DS MESSAGE-----
+*/
+const (
+	ArmorHeader  = "-----BEGIN QALQAN-DS MESSAGE-----"
+	ArmorFooter  = "-----END QALQAN-DS MESSAGE-----"
+	ArmorExt     = ".asc"
+	armorLineLen = 64
+
+	crc24Init = 0xB704CE
+	crc24Poly = 0x1864CFB
+)
+
+func crc24Update(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc & 0xFFFFFF
+}
+
+// Armor encodes a binary container as text.
+func Armor(data []byte) []byte {
+	var b bytes.Buffer
+	b.Grow(len(data)*4/3 + len(data)/48*2 + 128)
+	aw := NewArmorWriter(&b)
+	aw.Write(data)
+	aw.Close()
+	return b.Bytes()
+}
+
+type armorWriter struct {
+	w   io.Writer
+	enc io.WriteCloser
+	col int
+	crc uint32
+	err error
+}
+
+// NewArmorWriter armors what is written to it as Armor does; Close writes the checksum and the footer.
+func NewArmorWriter(w io.Writer) io.WriteCloser {
+	a := &armorWriter{w: w, crc: crc24Init}
+	a.enc = base64.NewEncoder(base64.StdEncoding, lineWriter{a})
+	_, a.err = io.WriteString(w, ArmorHeader+"\r\n")
+	return a
+}
+
+func (a *armorWriter) Write(p []byte) (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	a.crc = crc24Update(a.crc, p)
+	return a.enc.Write(p)
+}
+
+func (a *armorWriter) Close() error {
+	if a.err != nil {
+		return a.err
+	}
+	if err := a.enc.Close(); err != nil {
+		return err
+	}
+	var tail bytes.Buffer
+	if a.col > 0 {
+		tail.WriteString("\r\n")
+	}
+	tail.WriteByte('=')
+	tail.WriteString(base64.StdEncoding.EncodeToString([]byte{byte(a.crc >> 16), byte(a.crc >> 8), byte(a.crc)}))
+	tail.WriteString("\r\n" + ArmorFooter + "\r\n")
+	_, err := a.w.Write(tail.Bytes())
+	return err
+}
+
+// lineWriter breaks the base64 text of an armorWriter into lines.
+type lineWriter struct{ a *armorWriter }
+
+func (l lineWriter) Write(p []byte) (int, error) {
+	a := l.a
+	n := len(p)
+	for len(p) > 0 && a.err == nil {
+		if a.col == armorLineLen {
+			_, a.err = io.WriteString(a.w, "\r\n")
+			a.col = 0
+			continue
+		}
+		c := min(len(p), armorLineLen-a.col)
+		_, a.err = a.w.Write(p[:c])
+		a.col += c
+		p = p[c:]
+	}
+	if a.err != nil {
+		return 0, a.err
+	}
+	return n, nil
+}
+
+// IsArmored reports whether data starts with an armor header, possibly after some text.
+func IsArmored(data []byte) bool {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	return bytes.Contains(head, []byte(ArmorHeader))
+}
+
+// Dearmor accepts armored text with any surrounding text, indentation or line endings.
+// Errors are *ArmorError.
+func Dearmor(data []byte) ([]byte, error) {
+	return io.ReadAll(newArmorReader(bytes.NewReader(data), len(data)+1))
+}
+
+type armorReader struct {
+	sc      *bufio.Scanner
+	pending []byte // base64 text not decoded yet, less than a quantum
+	out     []byte
+	crc     uint32
+	sum     string // the checksum line without '='
+	inBody  bool
+	padded  bool
+	done    bool
+}
+
+// NewArmorReader reads the binary container from armored text as Dearmor does.
+// The checksum is checked at the footer; errors are *ArmorError.
+func NewArmorReader(r io.Reader) io.Reader {
+	return newArmorReader(r, int(MaxArmoredSize))
+}
+
+func newArmorReader(r io.Reader, maxLine int) *armorReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLine)
+	return &armorReader{sc: sc, crc: crc24Init}
+}
+
+func (a *armorReader) Read(p []byte) (int, error) {
+	for len(a.out) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+		if err := a.next(); err != nil {
+			return 0, &ArmorError{err}
+		}
+	}
+	n := copy(p, a.out)
+	a.out = a.out[n:]
+	return n, nil
+}
+
+// next handles one line of the text.
+func (a *armorReader) next() error {
+	if !a.sc.Scan() {
+		if err := a.sc.Err(); err != nil {
+			return err
+		}
+		return errors.New("header or footer not found")
+	}
+	line := strings.TrimSpace(a.sc.Text())
+	switch {
+	case !a.inBody:
+		a.inBody = line == ArmorHeader
+	case line == ArmorFooter:
+		return a.finish()
+	case line == "":
+	case strings.HasPrefix(line, "=") && len(line) == 5:
+		a.sum = line[1:]
+	default:
+		if a.padded {
+			return errors.New("body: data after padding")
+		}
+		a.pending = append(a.pending, line...)
+		q := len(a.pending) / 4 * 4
+		if q == 0 {
+			return nil
+		}
+		raw := make([]byte, base64.StdEncoding.DecodedLen(q))
+		n, err := base64.StdEncoding.Decode(raw, a.pending[:q])
+		if err != nil {
+			return fmt.Errorf("body: %w", err)
+		}
+		a.padded = a.pending[q-1] == '='
+		a.pending = append(a.pending[:0], a.pending[q:]...)
+		a.crc = crc24Update(a.crc, raw[:n])
+		a.out = raw[:n]
+	}
+	return nil
+}
+
+func (a *armorReader) finish() error {
+	if len(a.pending) > 0 {
+		return errors.New("body: truncated")
+	}
+	if a.sum == "" {
+		return errors.New("checksum missing")
+	}
+	c, err := base64.StdEncoding.DecodeString(a.sum)
+	if err != nil || len(c) != 3 {
+		return errors.New("checksum malformed")
+	}
+	if uint32(c[0])<<16|uint32(c[1])<<8|uint32(c[2]) != a.crc {
+		return errors.New("checksum mismatch")
+	}
+	a.done = true
+	return nil
+}
@@ -0,0 +1,349 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+	failed sign-ins, kept at the end of the key file after its imit:
+
+'Q','A','T','T' | version(2) | failures[2] | last[8] | lockedUntil[8] | flags(1) | 0[8] | imit[16]
+
+times are unix seconds; all numbers are big endian; flags bit0 = the session keys have been
+wiped. The imit of the key file needs the password, so the record can't be under it. Its own
+imit is keyed with a hash of the header and the imit of the key file: it catches edits and
+a record carried over from another state of the file, not someone who can read the key file.
+The policy is kept under the imit of the key file, in the extension of the footer (see
+keyring.go), and once it is there a key file without the record counts as locked out.
+*/
+const (
+	attemptsLen    = 32
+	attemptsRecLen = attemptsLen + qalqan.BLOCKLEN
+
+	attemptsFlagWiped byte = 0x01
+
+	DefaultMaxFailures    = 5
+	DefaultLockoutMinutes = 15
+)
+
+var (
+	attemptsMagic = [4]byte{'Q', 'A', 'T', 'T'}
+
+	ErrAttemptsBroken = errors.New("record of failed sign-ins is damaged")
+	ErrKeysWiped      = errors.New("the session keys were wiped and the key file can't be opened")
+)
+
+// Attempts counts the failed sign-ins with a key file since the last good one and holds
+// the policy for them, which the owner of the keys sets.
+type Attempts struct {
+	Failures    int
+	Last        time.Time
+	LockedUntil time.Time
+	Wiped       bool // the session keys have been wiped
+
+	MaxFailures    int // failures before each lockout, 0 for no lockout
+	LockoutMinutes int
+	WipeAfter      int // failures after which the session keys are wiped, 0 for never
+}
+
+func defaultAttempts() Attempts {
+	return Attempts{MaxFailures: DefaultMaxFailures, LockoutMinutes: DefaultLockoutMinutes}
+}
+
+// splitAttempts cuts the record of failed sign-ins, if any, off the end of the key file.
+func splitAttempts(data []byte) (keys, rec []byte) {
+	n := len(data) - attemptsRecLen
+	if n >= headerLen+qalqan.BLOCKLEN && [4]byte(data[n:n+4]) == attemptsMagic {
+		return data[:n], data[n:]
+	}
+	return data, nil
+}
+
+// attemptsImitKey keys the record that follows keys, the key file up to its imit.
+func attemptsImitKey(keys []byte) []byte {
+	h := qalqan.Hash512("qds attempts\x00" + string(keys[:headerLen]) + string(keys[len(keys)-qalqan.BLOCKLEN:]))
+	return expandKey(h[:])
+}
+
+func decodeAttempts(keys, rec []byte) (Attempts, error) {
+	var a Attempts
+	if len(rec) != attemptsRecLen || [4]byte(rec[:4]) != attemptsMagic ||
+		subtle.ConstantTimeCompare(imit(attemptsImitKey(keys), rec[:attemptsLen]), rec[attemptsLen:]) != 1 {
+		return a, ErrAttemptsBroken
+	}
+	a.Failures = int(binary.BigEndian.Uint16(rec[5:7]))
+	if t := int64(binary.BigEndian.Uint64(rec[7:15])); t > 0 {
+		a.Last = time.Unix(t, 0)
+	}
+	if t := int64(binary.BigEndian.Uint64(rec[15:23])); t > 0 {
+		a.LockedUntil = time.Unix(t, 0)
+	}
+	a.Wiped = rec[23]&attemptsFlagWiped != 0
+	return a, nil
+}
+
+func encodeAttempts(keys []byte, a Attempts) []byte {
+	unix := func(t time.Time) uint64 {
+		if t.IsZero() {
+			return 0
+		}
+		return uint64(t.Unix())
+	}
+	rec := append(attemptsMagic[:], 2)
+	rec = binary.BigEndian.AppendUint16(rec, uint16(min(max(a.Failures, 0), 0xffff)))
+	rec = binary.BigEndian.AppendUint64(rec, unix(a.Last))
+	rec = binary.BigEndian.AppendUint64(rec, unix(a.LockedUntil))
+	var flags byte
+	if a.Wiped {
+		flags |= attemptsFlagWiped
+	}
+	rec = append(rec, flags)
+	rec = append(rec, make([]byte, attemptsLen-len(rec))...)
+	return append(rec, imit(attemptsImitKey(keys), rec)...)
+}
+
+// readAttemptsRecord reads the record at the end of the key file at path without the rest of it.
+func readAttemptsRecord(path string) (Attempts, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Attempts{}, false
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || st.Size() < headerLen+qalqan.BLOCKLEN+attemptsRecLen {
+		return Attempts{}, false
+	}
+	keys := make([]byte, headerLen+qalqan.BLOCKLEN)
+	rec := make([]byte, attemptsRecLen)
+	if _, err := f.ReadAt(keys[:headerLen], 0); err != nil {
+		return Attempts{}, false
+	}
+	if _, err := f.ReadAt(keys[headerLen:], st.Size()-attemptsRecLen-qalqan.BLOCKLEN); err != nil {
+		return Attempts{}, false
+	}
+	if _, err := f.ReadAt(rec, st.Size()-attemptsRecLen); err != nil && err != io.EOF {
+		return Attempts{}, false
+	}
+	a, err := decodeAttempts(keys, rec)
+	return a, err == nil
+}
+
+// policyOf reads the policy from the footer of keys, the key file up to its imit, without
+// checking the imit; a changed policy makes the key file fail to open. recorded is false for
+// a key file that doesn't hold one yet, which gets the default policy.
+func policyOf(keys []byte) (a Attempts, recorded bool) {
+	a = defaultAttempts()
+	body := keys[:len(keys)-qalqan.BLOCKLEN]
+	if trailerLen(body) == 0 || body[len(body)-qalqan.BLOCKLEN+4] < 3 {
+		return a, false
+	}
+	var ext [extLen]byte
+	copy(ext[:], body[len(body)-qalqan.BLOCKLEN-extLen:])
+	return extPolicy(ext)
+}
+
+func extPolicy(ext [extLen]byte) (a Attempts, recorded bool) {
+	a = defaultAttempts()
+	if ext[30]&extFlagPolicy == 0 {
+		return a, false
+	}
+	a.MaxFailures = int(binary.BigEndian.Uint16(ext[24:26]))
+	a.LockoutMinutes = int(binary.BigEndian.Uint16(ext[26:28]))
+	a.WipeAfter = int(binary.BigEndian.Uint16(ext[28:30]))
+	return a, true
+}
+
+// ReadAttempts reads the failed sign-ins with the key file at keysPath and its policy. Without
+// a record there are none, unless the key file holds a policy: then, as with a record that
+// fails its imit, it gives ErrAttemptsBroken along with the policy.
+func ReadAttempts(keysPath string) (Attempts, error) {
+	unlock, err := lockKeys(keysPath)
+	if err != nil {
+		return defaultAttempts(), err
+	}
+	defer unlock()
+	data, err := os.ReadFile(keysPath)
+	if err != nil {
+		return defaultAttempts(), err
+	}
+	if len(data) < headerLen+qalqan.DEFAULT_KEY_LEN+qalqan.BLOCKLEN {
+		return defaultAttempts(), ErrTooShort
+	}
+	keys, rec := splitAttempts(data)
+	a, recorded := policyOf(keys)
+	if rec == nil {
+		if recorded {
+			return a, ErrAttemptsBroken
+		}
+		return a, nil
+	}
+	counts, err := decodeAttempts(keys, rec)
+	if err != nil {
+		return a, err
+	}
+	a.Failures, a.Last, a.LockedUntil, a.Wiped = counts.Failures, counts.Last, counts.LockedUntil, counts.Wiped
+	return a, nil
+}
+
+// WriteAttempts records the failed sign-ins with the key file at keysPath. The policy in a is
+// not written; see Keyring.SetSignInPolicy.
+func WriteAttempts(keysPath string, a Attempts) error {
+	unlock, err := lockKeys(keysPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	data, err := os.ReadFile(keysPath)
+	if err != nil {
+		return err
+	}
+	if len(data) < headerLen+qalqan.DEFAULT_KEY_LEN+qalqan.BLOCKLEN {
+		return ErrTooShort
+	}
+	keys, _ := splitAttempts(data)
+	if err := writeAt(keysPath, int64(len(keys)), encodeAttempts(keys, a)); err != nil {
+		return err
+	}
+	// the record used to be kept in a file of its own
+	os.Remove(strings.TrimSuffix(keysPath, filepath.Ext(keysPath)) + ".attempts")
+	return nil
+}
+
+// WipeSessionKeys overwrites the session keys in the key file at keysPath with random bytes,
+// without the password, and records that in the record of failed sign-ins. The imit of the
+// key file breaks with it; Open checks the password against the password history instead
+// and keeps the circle keys.
+func WipeSessionKeys(keysPath string) error {
+	unlock, err := lockKeys(keysPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	data, err := os.ReadFile(keysPath)
+	if err != nil {
+		return err
+	}
+	if len(data) < headerLen+qalqan.DEFAULT_KEY_LEN+qalqan.BLOCKLEN {
+		return ErrTooShort
+	}
+	keys, rec := splitAttempts(data)
+	a, _ := decodeAttempts(keys, rec)
+	a.Wiped = true
+
+	body := keys[:len(keys)-qalqan.BLOCKLEN]
+	start := headerLen + qalqan.DEFAULT_KEY_LEN + circleCount*qalqan.DEFAULT_KEY_LEN
+	end := len(body) - trailerLen(body)
+	if end <= start {
+		return fmt.Errorf("%w: no session keys", ErrKeyFileLayout)
+	}
+	if _, err := crand.Read(keys[start:end]); err != nil {
+		return err
+	}
+	if err := writeAt(keysPath, int64(start), keys[start:end]); err != nil {
+		return err
+	}
+	return writeAt(keysPath, int64(len(keys)), encodeAttempts(keys, a))
+}
+
+func writeAt(path string, off int64, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, off); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// wipedPassword checks keyHash against the newest password in the history of body, the key
+// file up to its imit, for a key file whose session keys were wiped.
+func wipedPassword(body []byte, keyHash [32]byte) error {
+	n := trailerLen(body)
+	if n == 0 {
+		return ErrKeysWiped
+	}
+	footer := body[len(body)-qalqan.BLOCKLEN:]
+	end := len(body) - qalqan.BLOCKLEN
+	if footer[4] >= 3 {
+		end -= extLen
+	}
+	if footer[4] < 2 || footer[6] == 0 {
+		return ErrKeysWiped
+	}
+	e := body[end-historyEntryLen : end]
+	sum := historySum(e[:qalqan.BLOCKLEN], keyHash)
+	if subtle.ConstantTimeCompare(sum[:], e[qalqan.BLOCKLEN:]) != 1 {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// SignInPolicy is the policy for failed sign-ins kept in the key file; recorded is false while
+// it holds none and the default one applies.
+func (k *Keyring) SignInPolicy() (a Attempts, recorded bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.hasFooter || k.footer[4] < 3 {
+		return defaultAttempts(), false
+	}
+	return extPolicy(k.ext)
+}
+
+// SetSignInPolicy records the policy of a in the key file, under its imit.
+func (k *Keyring) SetSignInPolicy(a Attempts) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return ErrKeyringClosed
+	}
+	u16 := func(n int) uint16 { return uint16(min(max(n, 0), 0xffff)) }
+	old, oldExt, hadFooter := k.footer, k.ext, k.hasFooter
+	k.upgradeFooter()
+	binary.BigEndian.PutUint16(k.ext[24:26], u16(a.MaxFailures))
+	binary.BigEndian.PutUint16(k.ext[26:28], u16(a.LockoutMinutes))
+	binary.BigEndian.PutUint16(k.ext[28:30], u16(a.WipeAfter))
+	k.ext[30] |= extFlagPolicy
+	if err := k.save(); err != nil {
+		k.footer, k.ext, k.hasFooter = old, oldExt, hadFooter
+		return err
+	}
+	return nil
+}
+
+func (k *Keyring) clearSessions() {
+	for _, s := range k.sessions {
+		clear(s.In)
+		clear(s.Out)
+	}
+}
+
+// DropSessionKeys deletes every session key and saves the key file: the wipe of
+// WipeSessionKeys for a key file that is open.
+func (k *Keyring) DropSessionKeys() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return ErrKeyringClosed
+	}
+	k.clearSessions()
+	return k.save()
+}
+
+// Wiped reports whether the session keys had been wiped when the key file was opened.
+func (k *Keyring) Wiped() bool { return k.wiped }
@@ -0,0 +1,99 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	"bytes"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+	address book:
+
+IV[16] | ct | imit[16]
+
+ct is the list of contacts as JSON, encrypted in OFB mode under a key derived from the kikey;
+the imit covers IV and ct.
+*/
+const contactsExt = ".contacts"
+
+var ErrContactsBroken = errors.New("address book is damaged or made for other keys")
+
+// Contact names a user of center.bin.
+type Contact struct {
+	User       int    `json:"user"` // counted from 1
+	Name       string `json:"name"`
+	Department string `json:"department,omitempty"`
+	Note       string `json:"note,omitempty"`
+	Avatar     []byte `json:"avatar,omitempty"` // PNG or JPEG
+}
+
+// ContactsPath is the address book kept next to the key file at keysPath.
+func ContactsPath(keysPath string) string {
+	return strings.TrimSuffix(keysPath, filepath.Ext(keysPath)) + contactsExt
+}
+
+// LoadContacts reads the address book; there is none until it is first saved.
+func (k *Keyring) LoadContacts() ([]Contact, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return nil, ErrKeyringClosed
+	}
+
+	data, err := os.ReadFile(ContactsPath(k.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := len(data) - 2*qalqan.BLOCKLEN
+	if n < 0 || n%qalqan.BLOCKLEN != 0 {
+		return nil, ErrContactsBroken
+	}
+
+	rKey, imitKey := k.deriveKeys("qds contacts")
+	body, sum := data[:len(data)-qalqan.BLOCKLEN], data[len(data)-qalqan.BLOCKLEN:]
+	if subtle.ConstantTimeCompare(imit(imitKey, body), sum) != 1 {
+		return nil, ErrContactsBroken
+	}
+	var plain bytes.Buffer
+	if err := qalqan.DecryptOFB_File(n, rKey, body[:qalqan.BLOCKLEN], bytes.NewReader(body[qalqan.BLOCKLEN:]), &plain); err != nil {
+		return nil, err
+	}
+	var contacts []Contact
+	if err := json.Unmarshal(plain.Bytes(), &contacts); err != nil {
+		return nil, ErrContactsBroken
+	}
+	return contacts, nil
+}
+
+// SaveContacts replaces the address book with contacts.
+func (k *Keyring) SaveContacts(contacts []Contact) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return ErrKeyringClosed
+	}
+
+	data, err := json.Marshal(contacts)
+	if err != nil {
+		return err
+	}
+	iv := make([]byte, qalqan.BLOCKLEN)
+	if _, err := crand.Read(iv); err != nil {
+		return err
+	}
+	rKey, imitKey := k.deriveKeys("qds contacts")
+	out := bytes.NewBuffer(append([]byte(nil), iv...))
+	if _, err := qalqan.EncryptOFB_Stream(rKey, iv, bytes.NewReader(data), out); err != nil {
+		return err
+	}
+	return os.WriteFile(ContactsPath(k.path), append(out.Bytes(), imit(imitKey, out.Bytes())...), 0o600)
+}
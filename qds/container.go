@@ -0,0 +1,496 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+	container:
+
+svc[16] | metaImit[16] | [recipient table] | IV[16] | ct | fileImit[16]
+
+both imits are keyed with the kikey, so only key files of the same set open it.
+svc is described in qalqan/keys.go; [10] holds the flags:
+
+bit0 = payload is DEFLATE-compressed before encryption
+bit1 = payload is a text message typed in the app
+*/
+const (
+	KeyTypeCircle  byte = 0x00
+	KeyTypeSession byte = 0x01
+	KeyTypeMulti   byte = 0x02
+
+	ownerCenter byte = 0x33
+
+	svcArchiveIdx       = 9
+	svcArchive     byte = 0x88
+	svcFlagsIdx         = 10
+	flagCompressed byte = 0x01
+	flagMessage    byte = 0x02
+
+	// service info, its imit, the largest recipient table and the IV
+	maxHeadLen = 2*qalqan.BLOCKLEN + recipientHeaderLen + maxRecipients*recipientEntryLen + qalqan.BLOCKLEN
+)
+
+// Container is a parsed container. The fields describe its service info and are not verified
+// unless the container came from Keyring.OpenContainer.
+type Container struct {
+	Owner        byte // 0x33 for the center, otherwise the user of the sender
+	FileType     byte
+	KeyType      byte
+	CircleIndex  int
+	SessionIndex int
+	Recipients   []Recipient // multi-recipient containers only
+
+	// User is the session key set the container is for: the sender for the center,
+	// 0 for a user key file. Set by Keyring.OpenContainer.
+	User int
+
+	svc   []byte
+	iv    []byte
+	ct    *io.SectionReader
+	spool *os.File // the temporary copy made by OpenContainerStream
+}
+
+func (c *Container) Compressed() bool { return c.svc[svcFlagsIdx]&flagCompressed != 0 }
+func (c *Container) Archive() bool    { return c.svc[svcArchiveIdx] == svcArchive }
+func (c *Container) Message() bool    { return c.svc[svcFlagsIdx]&flagMessage != 0 }
+func (c *Container) FromCenter() bool { return c.Owner == ownerCenter }
+
+// PayloadSize is the size of the encrypted payload.
+func (c *Container) PayloadSize() int { return int(c.ct.Size()) }
+
+// Close removes the temporary copy of a container from OpenContainerStream.
+func (c *Container) Close() error {
+	if c.spool == nil {
+		return nil
+	}
+	err := c.spool.Close()
+	os.Remove(c.spool.Name())
+	c.spool = nil
+	return err
+}
+
+func buildServiceInfo(owner, fileType, keyType byte, circleIdx, sessionIdx int) [qalqan.BLOCKLEN]byte {
+	var s [qalqan.BLOCKLEN]byte
+	s[1] = owner
+	s[2] = 0x04
+	s[3] = byte(qalqan.DEFAULT_KEY_LEN) // 0x20
+	s[4] = fileType
+	s[5] = keyType
+	if circleIdx >= 0 && circleIdx < circleCount {
+		s[6] = byte(circleIdx)
+	}
+	if sessionIdx >= 0 && sessionIdx < 0xFFFF {
+		s[7] = byte((sessionIdx + 1) >> 8)
+		s[8] = byte(sessionIdx + 1)
+	}
+	return s
+}
+
+// Inspect reads the layout of a container, armored or not, without any key;
+// nothing is verified.
+func Inspect(data []byte) (*Container, error) {
+	if IsArmored(data) {
+		raw, err := Dearmor(data)
+		if err != nil {
+			return nil, err
+		}
+		data = raw
+	}
+	return splitContainer(data)
+}
+
+func splitContainer(data []byte) (*Container, error) {
+	return parseContainer(bytes.NewReader(data), int64(len(data)))
+}
+
+// parseContainer reads the service info, the recipient table and the IV of a container of size bytes.
+func parseContainer(ra io.ReaderAt, size int64) (*Container, error) {
+	if size < 3*qalqan.BLOCKLEN {
+		return nil, ErrTooShort
+	}
+	body := size - qalqan.BLOCKLEN // without the file imit
+	head := make([]byte, min(body, maxHeadLen))
+	if _, err := ra.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	svc := head[:qalqan.BLOCKLEN]
+	c := &Container{
+		svc:          svc,
+		Owner:        svc[1],
+		FileType:     svc[4],
+		KeyType:      svc[5],
+		CircleIndex:  int(svc[6]),
+		SessionIndex: (int(svc[7])<<8 | int(svc[8])) - 1,
+	}
+
+	pos := 2 * qalqan.BLOCKLEN
+	if c.KeyType == KeyTypeMulti {
+		entries, n, err := parseRecipientTable(head[pos:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrTruncated, err)
+		}
+		c.Recipients = entries
+		pos += n
+	}
+
+	if size < int64(pos+qalqan.BLOCKLEN) {
+		return nil, ErrNoIV
+	}
+	if len(head) < pos+qalqan.BLOCKLEN {
+		return nil, ErrTruncated
+	}
+	c.iv = head[pos : pos+qalqan.BLOCKLEN]
+	pos += qalqan.BLOCKLEN
+	c.ct = io.NewSectionReader(ra, int64(pos), body-int64(pos))
+	if c.ct.Size()%qalqan.BLOCKLEN != 0 {
+		return nil, ErrTruncated
+	}
+	return c, nil
+}
+
+// OpenContainer verifies both imits of a container, armored or not, and parses it.
+// No key is used up.
+func (k *Keyring) OpenContainer(data []byte) (*Container, error) {
+	if IsArmored(data) {
+		raw, err := Dearmor(data)
+		if err != nil {
+			return nil, err
+		}
+		data = raw
+	}
+	if int64(len(data)) > MaxEncryptedSize {
+		return nil, ErrTooBig
+	}
+	return k.openAt(bytes.NewReader(data), int64(len(data)))
+}
+
+// OpenContainerStream is OpenContainer for a container of any length read from r, armored or not.
+// It is copied, still encrypted, to a temporary file; Close the container to remove it.
+func (k *Keyring) OpenContainerStream(r io.Reader) (*Container, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(1024)
+	var src io.Reader = br
+	if IsArmored(head) {
+		src = NewArmorReader(br)
+	}
+
+	f, err := os.CreateTemp("", "qds-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(f, src)
+	if err == nil {
+		var c *Container
+		if c, err = k.openAt(f, size); err == nil {
+			c.spool = f
+			return c, nil
+		}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil, err
+}
+
+func (k *Keyring) openAt(ra io.ReaderAt, size int64) (*Container, error) {
+	if size < 3*qalqan.BLOCKLEN {
+		return nil, ErrTooShort
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return nil, ErrKeyringClosed
+	}
+
+	body := size - qalqan.BLOCKLEN
+	m := qalqan.NewImit(k.imitKey)
+	if _, err := io.Copy(m, io.NewSectionReader(ra, 0, body)); err != nil {
+		return nil, err
+	}
+	var sum, stored [qalqan.BLOCKLEN]byte
+	m.Sum(sum[:])
+	if _, err := ra.ReadAt(stored[:], body); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(sum[:], stored[:]) != 1 {
+		return nil, ErrCorrupted
+	}
+	var svc [2 * qalqan.BLOCKLEN]byte
+	if _, err := ra.ReadAt(svc[:], 0); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(imit(k.imitKey, svc[:qalqan.BLOCKLEN]), svc[qalqan.BLOCKLEN:]) != 1 {
+		return nil, ErrHeaderImit
+	}
+
+	c, err := parseContainer(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	if k.center {
+		if c.Owner == ownerCenter {
+			return nil, ErrOwnContainer
+		}
+		c.User = int(c.Owner)
+		if c.User >= len(k.sessions) {
+			return nil, &UnknownSenderError{c.Owner}
+		}
+	}
+	return c, nil
+}
+
+// Payload is an unlocked container. It holds its key until Close.
+type Payload struct {
+	c *Container
+
+	mu   sync.Mutex
+	rKey []byte // nil once closed
+}
+
+func (p *Payload) Container() *Container { return p.c }
+
+// Close wipes the key of the payload; Open fails with ErrPayloadClosed from then on.
+// Readers already open go on with a copy of their own.
+func (p *Payload) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.rKey)
+	p.rKey = nil
+}
+
+// Unlock finds the key of a container from OpenContainer. A session key is used up
+// and the key file saved; the payload can then be read any number of times.
+func (k *Keyring) Unlock(c *Container) (*Payload, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return nil, ErrKeyringClosed
+	}
+
+	var rKey []byte
+	switch c.KeyType {
+	case KeyTypeCircle:
+		rKey = k.useCircleKey(c.CircleIndex)
+	case KeyTypeMulti:
+		entry, ok := findRecipient(c.Recipients, k.User())
+		if !ok {
+			return nil, ErrNotRecipient
+		}
+		if entry.SessionIndex < 0 || entry.SessionIndex >= len(k.sessions[c.User].In) {
+			return nil, ErrBadSession
+		}
+		if rk := k.useSessionIn(c.User, entry.SessionIndex); rk != nil {
+			rKey = expandKey(unwrapDataKey(rk, entry.wrappedKey[:]))
+		}
+	default:
+		if c.SessionIndex < 0 || c.SessionIndex >= len(k.sessions[c.User].In) {
+			return nil, ErrBadSession
+		}
+		rKey = k.useSessionIn(c.User, c.SessionIndex)
+	}
+	if rKey == nil {
+		return nil, ErrKeyUsed
+	}
+	if c.KeyType != KeyTypeCircle {
+		if err := k.save(); err != nil {
+			return nil, err
+		}
+	}
+	return &Payload{c: c, rKey: rKey}, nil
+}
+
+type payloadReader struct {
+	io.Reader
+	rp *io.PipeReader
+}
+
+func (p *payloadReader) Close() error { return p.rp.Close() }
+
+// Open streams the decrypted and, if flagged, inflated payload.
+// progress, if not nil, gets the share of the ciphertext decrypted so far.
+func (p *Payload) Open(progress func(float64)) io.ReadCloser {
+	c := p.c
+	p.mu.Lock()
+	rKey := bytes.Clone(p.rKey)
+	p.mu.Unlock()
+	rp, wp := io.Pipe()
+	go func() {
+		if rKey == nil {
+			wp.CloseWithError(ErrPayloadClosed)
+			return
+		}
+		defer clear(rKey)
+		size := c.ct.Size()
+		var src io.Reader = io.NewSectionReader(c.ct, 0, size)
+		if progress != nil {
+			src = &progressReader{r: src, total: size, emit: progress}
+		}
+		wp.CloseWithError(qalqan.DecryptOFB_File(int(size), rKey, c.iv, src, wp))
+	}()
+	var r io.Reader = rp
+	if c.Compressed() {
+		r = flate.NewReader(rp)
+	}
+	return &payloadReader{Reader: r, rp: rp}
+}
+
+type encryptPlan struct {
+	rKey       []byte
+	svc        [qalqan.BLOCKLEN]byte
+	header     []byte // recipient table, nil for single-recipient containers
+	recipients []int
+	keyIndexes []int
+	session    bool
+}
+
+func (k *Keyring) owner() byte {
+	if k.center {
+		return ownerCenter
+	}
+	return byte(k.User())
+}
+
+// planEncryption uses up the keys needed to encrypt one container for opts.Recipients.
+func (k *Keyring) planEncryption(opts *EncryptOptions) (*encryptPlan, error) {
+	targets := []int{0}
+	if k.center {
+		targets = opts.Recipients
+		if len(targets) == 0 {
+			if !opts.Circle {
+				return nil, fmt.Errorf("%w: no recipients selected", ErrBadRecipients)
+			}
+			targets = []int{0}
+		}
+	}
+	seen := map[int]bool{}
+	for _, u := range targets {
+		if u < 0 || u >= len(k.sessions) || seen[u] {
+			return nil, fmt.Errorf("%w: user #%d", ErrBadRecipients, u+1)
+		}
+		seen[u] = true
+	}
+	if opts.Circle && len(targets) > 1 {
+		return nil, fmt.Errorf("%w: several recipients need session keys", ErrBadRecipients)
+	}
+
+	if len(targets) == 1 {
+		rKey, keyType, circleIdx, sessionIdx, err := k.chooseKey(targets[0], !opts.Circle)
+		if err != nil {
+			return nil, err
+		}
+		return &encryptPlan{
+			rKey:       rKey,
+			svc:        buildServiceInfo(k.owner(), opts.FileType, keyType, circleIdx, sessionIdx),
+			recipients: targets,
+			keyIndexes: []int{max(circleIdx, sessionIdx)},
+			session:    !opts.Circle,
+		}, nil
+	}
+
+	for _, u := range targets {
+		if k.sessionOutLeft(u) == 0 {
+			return nil, fmt.Errorf("%w: session keys empty for user #%d", ErrNoKeys, u+1)
+		}
+	}
+
+	dataKey := make([]byte, qalqan.DEFAULT_KEY_LEN)
+	if _, err := crand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range dataKey {
+			dataKey[i] = 0
+		}
+	}()
+
+	entries := make([]Recipient, 0, len(targets))
+	indexes := make([]int, 0, len(targets))
+	for _, u := range targets {
+		rk, _, _, sessionIdx, err := k.chooseKey(u, true)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, sessionIdx)
+		entries = append(entries, Recipient{
+			User:         u,
+			SessionIndex: sessionIdx,
+			wrappedKey:   wrapDataKey(rk, dataKey),
+		})
+	}
+
+	return &encryptPlan{
+		rKey:       expandKey(dataKey),
+		svc:        buildServiceInfo(k.owner(), opts.FileType, KeyTypeMulti, -1, -1),
+		header:     encodeRecipientTable(entries),
+		recipients: targets,
+		keyIndexes: indexes,
+		session:    true,
+	}, nil
+}
+
+func (k *Keyring) seal(svc [qalqan.BLOCKLEN]byte, header, iv, ct []byte) []byte {
+	out := make([]byte, 0, len(svc)+qalqan.BLOCKLEN+len(header)+len(iv)+len(ct)+qalqan.BLOCKLEN)
+	out = append(out, svc[:]...)
+	out = append(out, imit(k.imitKey, svc[:])...)
+	out = append(out, header...)
+	out = append(out, iv...)
+	out = append(out, ct...)
+	return append(out, imit(k.imitKey, out)...)
+}
+
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	read     int64
+	lastEmit time.Time
+	emit     func(f float64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		if time.Since(p.lastEmit) > 40*time.Millisecond || p.read == p.total {
+			if p.total > 0 && p.emit != nil {
+				p.emit(float64(p.read) / float64(p.total))
+			}
+			p.lastEmit = time.Now()
+		}
+	}
+	return n, err
+}
+
+func compressible(fileType byte) bool {
+	switch fileType {
+	case FileTypeVideo, FileTypePhoto:
+		return false
+	}
+	return true
+}
+
+func compressStream(r io.Reader) (*bytes.Buffer, error) {
+	out := &bytes.Buffer{}
+	fw, err := flate.NewWriter(out, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		return nil, err
+	}
+	if err := fw.Close(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,316 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	"bytes"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+	journal:
+
+record = len[4] | IV[16] | ct[len] | imit[16]
+
+ct is one JournalEntry as JSON, encrypted in OFB mode under a key derived from the kikey.
+The imit covers the imit of the record before it (zeros for the first), len, IV and ct,
+so a record changed, removed or moved breaks the chain from there on. Records cut off
+the end, or the whole file removed, leave no trace in the journal itself: the key file
+keeps the number of records and the imit of the last one in its ext, see keyring.go.
+*/
+const (
+	DirectionOut = "out"
+	DirectionIn  = "in"
+
+	JournalFile    = "file"
+	JournalArchive = "archive"
+	JournalMessage = "message"
+
+	journalExt       = ".journal"
+	journalLenSize   = 4
+	maxJournalRecord = 1 << 16
+)
+
+var ErrJournalBroken = errors.New("journal chain is broken")
+
+// JournalEntry is one container made or opened with the key file.
+type JournalEntry struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Peer      int       `json:"peer"`     // user number counted from 1, 0 for the center
+	KeyType   string    `json:"key_type"` // session, circle or multi
+	KeyIndex  int       `json:"key_index"`
+	Kind      string    `json:"kind"` // file, archive or message
+	File      string    `json:"file,omitempty"`
+	Size      int64     `json:"size"` // the payload as encrypted
+	Via       string    `json:"via,omitempty"`
+}
+
+// JournalError tells which record, counted from 1, failed.
+type JournalError struct {
+	Record int
+	Err    error
+}
+
+func (e *JournalError) Error() string { return fmt.Sprintf("journal record %d: %v", e.Record, e.Err) }
+func (e *JournalError) Unwrap() error { return e.Err }
+
+// JournalPath is the journal kept next to the key file at keysPath.
+func JournalPath(keysPath string) string {
+	return strings.TrimSuffix(keysPath, filepath.Ext(keysPath)) + journalExt
+}
+
+// journalKeys derives the keys of the journal from the kikey. The caller holds k.mu.
+func (k *Keyring) journalKeys() (rKey, imitKey []byte) {
+	if k.journalKey == nil {
+		k.journalKey, k.journalImit = k.deriveKeys("qds journal")
+	}
+	return k.journalKey, k.journalImit
+}
+
+// deriveKeys derives from the kikey an expanded key and an imit key for the side file named
+// by label, so that they can't be used for anything else. The caller holds k.mu.
+func (k *Keyring) deriveKeys(label string) (rKey, imitKey []byte) {
+	enc := qalqan.Hash512(label + "\x00" + string(k.kikey))
+	mac := qalqan.Hash512(label + " imit\x00" + string(k.kikey))
+	rKey, imitKey = expandKey(enc[:]), expandKey(mac[:])
+	for i := range enc {
+		enc[i], mac[i] = 0, 0
+	}
+	return rKey, imitKey
+}
+
+// SealedEntries describes for the journal a container made with res, one entry per recipient.
+func (k *Keyring) SealedEntries(res *EncryptResult, kind, file string) []JournalEntry {
+	keyType := "circle"
+	if res.Session {
+		keyType = "session"
+		if len(res.Recipients) > 1 {
+			keyType = "multi"
+		}
+	}
+	now := time.Now()
+	entries := make([]JournalEntry, len(res.Recipients))
+	for i, u := range res.Recipients {
+		e := JournalEntry{Time: now, Direction: DirectionOut, KeyType: keyType, Kind: kind, File: file, Size: res.StoredSize}
+		if k.center {
+			e.Peer = u + 1
+		}
+		if i < len(res.KeyIndexes) {
+			e.KeyIndex = res.KeyIndexes[i] + 1
+		}
+		entries[i] = e
+	}
+	return entries
+}
+
+// OpenedEntry describes for the journal a container unlocked with the key file.
+func (k *Keyring) OpenedEntry(c *Container, file string) JournalEntry {
+	e := JournalEntry{Time: time.Now(), Direction: DirectionIn, Kind: JournalFile, File: file, Size: int64(c.PayloadSize())}
+	switch {
+	case c.Message():
+		e.Kind = JournalMessage
+	case c.Archive():
+		e.Kind = JournalArchive
+	}
+	if k.center {
+		e.Peer = c.User + 1
+	}
+	switch c.KeyType {
+	case KeyTypeCircle:
+		e.KeyType, e.KeyIndex = "circle", c.CircleIndex+1
+	case KeyTypeMulti:
+		e.KeyType = "multi"
+		if r, ok := findRecipient(c.Recipients, k.User()); ok {
+			e.KeyIndex = r.SessionIndex + 1
+		}
+	default:
+		e.KeyType, e.KeyIndex = "session", c.SessionIndex+1
+	}
+	return e
+}
+
+// AppendJournal adds entries to the end of the journal, creating it if needed.
+func (k *Keyring) AppendJournal(entries ...JournalEntry) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return ErrKeyringClosed
+	}
+	rKey, imitKey := k.journalKeys()
+
+	f, err := os.OpenFile(JournalPath(k.path), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	count, last, recorded := k.journalMark()
+	prev, end, n, marked, err := journalTail(f, count)
+	if err != nil {
+		return err
+	}
+	if recorded && (n < count || subtle.ConstantTimeCompare(marked, last) != 1) {
+		// appending would make a cut-off journal look whole again
+		return &JournalError{int(min(n, count)) + 1, ErrJournalBroken}
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		iv := make([]byte, qalqan.BLOCKLEN)
+		if _, err := crand.Read(iv); err != nil {
+			return err
+		}
+		var ct bytes.Buffer
+		if _, err := qalqan.EncryptOFB_Stream(rKey, iv, bytes.NewReader(data), &ct); err != nil {
+			return err
+		}
+		record := binary.BigEndian.AppendUint32(nil, uint32(ct.Len()))
+		record = append(record, iv...)
+		record = append(record, ct.Bytes()...)
+		prev = journalImit(imitKey, prev, record)
+		buf.Write(record)
+		buf.Write(prev)
+	}
+	if _, err := f.WriteAt(buf.Bytes(), end); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return k.setJournalMark(n+uint64(len(entries)), prev)
+}
+
+// journalMark is the number of records and the imit of the last one the key file keeps for
+// the journal. The caller holds k.mu.
+func (k *Keyring) journalMark() (count uint64, last []byte, recorded bool) {
+	if !k.hasFooter || k.footer[4] < 3 || k.ext[30]&extFlagJournal == 0 {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint64(k.ext[0:8]), k.ext[8:24], true
+}
+
+// setJournalMark keeps count and last in the key file. The caller holds k.mu.
+func (k *Keyring) setJournalMark(count uint64, last []byte) error {
+	old, oldExt, hadFooter := k.footer, k.ext, k.hasFooter
+	k.upgradeFooter()
+	binary.BigEndian.PutUint64(k.ext[0:8], count)
+	copy(k.ext[8:24], last)
+	k.ext[30] |= extFlagJournal
+	if err := k.save(); err != nil {
+		k.footer, k.ext, k.hasFooter = old, oldExt, hadFooter
+		return err
+	}
+	return nil
+}
+
+func journalImit(imitKey, prev, record []byte) []byte {
+	m := qalqan.NewImit(imitKey)
+	m.Write(prev)
+	m.Write(record)
+	sum := make([]byte, qalqan.BLOCKLEN)
+	m.Sum(sum)
+	return sum
+}
+
+// journalTail walks the records of f without decrypting them and returns the imit of the last
+// one, its end, the number of records and the imit of record mark (zeros for 0).
+func journalTail(f *os.File, mark uint64) (prev []byte, end int64, n uint64, marked []byte, err error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+	prev = make([]byte, qalqan.BLOCKLEN)
+	marked = make([]byte, qalqan.BLOCKLEN)
+	var head [journalLenSize]byte
+	for ; end < st.Size(); n++ {
+		broken := &JournalError{int(n) + 1, ErrJournalBroken}
+		if _, err := f.ReadAt(head[:], end); err != nil {
+			return nil, 0, 0, nil, broken
+		}
+		size := int64(binary.BigEndian.Uint32(head[:]))
+		next := end + journalLenSize + qalqan.BLOCKLEN + size + qalqan.BLOCKLEN
+		if size > maxJournalRecord || next > st.Size() {
+			return nil, 0, 0, nil, broken
+		}
+		if _, err := f.ReadAt(prev, next-qalqan.BLOCKLEN); err != nil {
+			return nil, 0, 0, nil, err
+		}
+		if n+1 == mark {
+			copy(marked, prev)
+		}
+		end = next
+	}
+	return prev, end, n, marked, nil
+}
+
+// ReadJournal decrypts and checks the whole journal. When the chain is broken, or the journal
+// is shorter than the key file says or missing, it returns the entries before the break and a
+// *JournalError wrapping ErrJournalBroken.
+func (k *Keyring) ReadJournal() ([]JournalEntry, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return nil, ErrKeyringClosed
+	}
+	rKey, imitKey := k.journalKeys()
+	count, last, recorded := k.journalMark()
+
+	data, err := os.ReadFile(JournalPath(k.path))
+	if errors.Is(err, os.ErrNotExist) {
+		if recorded && count > 0 {
+			return nil, &JournalError{1, ErrJournalBroken}
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []JournalEntry
+	prev := make([]byte, qalqan.BLOCKLEN)
+	for n := 1; len(data) > 0; n++ {
+		broken := &JournalError{n, ErrJournalBroken}
+		if len(data) < journalLenSize {
+			return entries, broken
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		recLen := journalLenSize + qalqan.BLOCKLEN + size
+		if size > maxJournalRecord || size%qalqan.BLOCKLEN != 0 || len(data) < recLen+qalqan.BLOCKLEN {
+			return entries, broken
+		}
+		record, sum := data[:recLen], data[recLen:recLen+qalqan.BLOCKLEN]
+		if subtle.ConstantTimeCompare(journalImit(imitKey, prev, record), sum) != 1 ||
+			recorded && uint64(n) == count && subtle.ConstantTimeCompare(sum, last) != 1 {
+			return entries, broken
+		}
+
+		iv := record[journalLenSize : journalLenSize+qalqan.BLOCKLEN]
+		var plain bytes.Buffer
+		if err := qalqan.DecryptOFB_File(size, rKey, iv, bytes.NewReader(record[journalLenSize+qalqan.BLOCKLEN:]), &plain); err != nil {
+			return entries, &JournalError{n, err}
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(plain.Bytes(), &e); err != nil {
+			return entries, &JournalError{n, err}
+		}
+		entries = append(entries, e)
+		prev = sum
+		data = data[recLen+qalqan.BLOCKLEN:]
+	}
+	if recorded && uint64(len(entries)) < count {
+		return entries, &JournalError{len(entries) + 1, ErrJournalBroken}
+	}
+	return entries, nil
+}
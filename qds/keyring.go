@@ -0,0 +1,512 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	key file (center.bin or abc.bin, see qalqan/keys.go for the header):
+
+header[16] | kikey[32] | circle keys 100 × [32] | session keys | [history] | [ext[32]] | [footer[16]] | imit[16] | [attempts[48]]
+
+the kikey and every key are encrypted with the password key; the imit covers
+everything before it and is keyed with the kikey. center.bin has In then Out
+session keys for every user, abc.bin one set for its own user. The record of
+failed sign-ins after the imit is described in attempts.go.
+
+	footer: 16 bytes before the imit
+
+[0..3]   = 'Q','P','W','D'
+[4]      = version (1 to 3)
+[5]      = flags (bit0 = 1 once the password has been changed)
+[6]      = number of history entries (version 2 on)
+[7..10]  = time of the last password change, unix seconds BE (version 2 on)
+[11..12] = maximum age of the password in days BE, 0 for no limit (version 2 on)
+[13..15] = 0
+
+the history holds the last passwords, the current one included, as salt[16] | hash[32]
+entries, oldest first; see password.go.
+
+	ext: 32 bytes before the footer (version 3)
+
+[0..7]   = number of records in the journal BE
+[8..23]  = imit of the last of them, see journal.go
+[24..25] = failures before each lockout BE
+[26..27] = lockout minutes BE
+[28..29] = failures after which the session keys are wiped BE
+[30]     = flags (bit0 = the sign-in policy above is set, bit1 = the journal above is)
+[31]     = 0
+*/
+const (
+	headerLen      = 16
+	circleCount    = 100
+	maxSessionKeys = 8000
+
+	footerFlagChanged byte = 0x01
+
+	extLen              = 32
+	extFlagPolicy  byte = 0x01
+	extFlagJournal byte = 0x02
+)
+
+var footerMagic = [4]byte{'Q', 'P', 'W', 'D'}
+
+// Keyring holds the keys of one key file. Its methods are safe for concurrent use;
+// every session key it uses up is written back to the file before the method returns.
+type Keyring struct {
+	mu sync.Mutex
+
+	path      string
+	center    bool
+	header    [headerLen]byte
+	rKey      []byte // expanded password key
+	kikey     []byte
+	imitKey   []byte
+	keyHash   [32]byte
+	footer    [qalqan.BLOCKLEN]byte
+	hasFooter bool
+	history   [][historyEntryLen]byte
+	ext       [extLen]byte
+	wiped     bool
+
+	circle   [][qalqan.DEFAULT_KEY_LEN]byte
+	sessions []qalqan.SessionKeySet
+	inCnt    int
+	outCnt   int
+	nextOut  []int
+	closed   bool
+	unlock   func()
+
+	journalKey, journalImit []byte // expanded, derived on first use
+}
+
+// IsCenterFile reports whether path names the key file of the center.
+func IsCenterFile(path string) bool {
+	return strings.EqualFold(filepath.Base(path), "center.bin")
+}
+
+func expandKey(key []byte) []byte {
+	rKey := make([]byte, qalqan.EXPKLEN)
+	qalqan.Kexp(key, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, rKey)
+	return rKey
+}
+
+func encryptKey(dst, key, rKey []byte) {
+	for i := 0; i < qalqan.DEFAULT_KEY_LEN; i += qalqan.BLOCKLEN {
+		qalqan.Encrypt(key[i:i+qalqan.BLOCKLEN], rKey, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, dst[i:i+qalqan.BLOCKLEN])
+	}
+}
+
+func decryptKey(dst, key, rKey []byte) {
+	for i := 0; i < qalqan.DEFAULT_KEY_LEN; i += qalqan.BLOCKLEN {
+		qalqan.DecryptOFB(key[i:i+qalqan.BLOCKLEN], rKey, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, dst[i:i+qalqan.BLOCKLEN])
+	}
+}
+
+func imit(key, data []byte) []byte {
+	out := make([]byte, qalqan.BLOCKLEN)
+	qalqan.Qalqan_Imit(uint64(len(data)), key, bytes.NewReader(data), out)
+	return out
+}
+
+// Open decrypts the key file at path with password. The center is recognized by the
+// file name center.bin; any other name is a user key file. The key file stays locked until
+// Close; while another program has it open, Open gives ErrKeysInUse.
+func Open(path, password string) (*Keyring, error) {
+	unlock, err := lockKeys(path)
+	if err != nil {
+		return nil, err
+	}
+	k, err := open(path, password)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	k.unlock = unlock
+	return k, nil
+}
+
+func open(path, password string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerLen+qalqan.DEFAULT_KEY_LEN+qalqan.BLOCKLEN {
+		return nil, ErrTooShort
+	}
+
+	k := &Keyring{path: path, center: IsCenterFile(path)}
+	copy(k.header[:], data[:headerLen])
+
+	if k.center {
+		k.inCnt = int(binary.BigEndian.Uint16(k.header[4:6]))
+		k.outCnt = int(binary.BigEndian.Uint16(k.header[6:8]))
+	} else {
+		k.inCnt = int(binary.BigEndian.Uint16(k.header[1:3]))
+		k.outCnt = int(binary.BigEndian.Uint16(k.header[3:5]))
+	}
+	k.inCnt = min(k.inCnt, maxSessionKeys)
+	k.outCnt = min(k.outCnt, maxSessionKeys)
+
+	k.keyHash = qalqan.Hash512(password)
+	k.rKey = expandKey(k.keyHash[:])
+
+	k.kikey = make([]byte, qalqan.DEFAULT_KEY_LEN)
+	decryptKey(k.kikey, data[headerLen:headerLen+qalqan.DEFAULT_KEY_LEN], k.rKey)
+	k.imitKey = expandKey(k.kikey)
+
+	data, rec := splitAttempts(data)
+	body := data[:len(data)-qalqan.BLOCKLEN]
+	if subtle.ConstantTimeCompare(imit(k.imitKey, body), data[len(body):]) != 1 {
+		// wiping the session keys broke the imit; the password is checked against the
+		// history instead and the circle keys are kept
+		if a, err := decodeAttempts(data, rec); err != nil || !a.Wiped {
+			return nil, ErrWrongPassword
+		}
+		if err := wipedPassword(body, k.keyHash); err != nil {
+			return nil, err
+		}
+		k.wiped = true
+	}
+
+	br := bytes.NewBuffer(body[headerLen+qalqan.DEFAULT_KEY_LEN:])
+	k.circle = make([][qalqan.DEFAULT_KEY_LEN]byte, circleCount)
+	if err := qalqan.LoadCircleKeys(br, k.rKey, &k.circle, circleCount); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyFileLayout, err)
+	}
+
+	sessBytes := br.Len()
+	if n := trailerLen(body); n > 0 && n <= sessBytes {
+		k.hasFooter = true
+		copy(k.footer[:], body[len(body)-qalqan.BLOCKLEN:])
+		end := len(body) - qalqan.BLOCKLEN
+		if k.footer[4] >= 3 {
+			end -= extLen
+			copy(k.ext[:], body[end:])
+		}
+		for h := body[len(body)-n : end]; len(h) > 0; h = h[historyEntryLen:] {
+			k.history = append(k.history, [historyEntryLen]byte(h))
+		}
+		sessBytes -= n
+	}
+
+	bytesPerUser := (k.inCnt + k.outCnt) * qalqan.DEFAULT_KEY_LEN
+	users := 1
+	if k.center {
+		if bytesPerUser <= 0 || sessBytes < bytesPerUser {
+			return nil, fmt.Errorf("%w: sessBytes=%d perUser=%d", ErrKeyFileLayout, sessBytes, bytesPerUser)
+		}
+		users = sessBytes / bytesPerUser
+		if users > 255 {
+			return nil, fmt.Errorf("%w: users=%d", ErrKeyFileLayout, users)
+		}
+		err = qalqan.LoadSessionKeysForCenter(br, k.rKey, &k.sessions, k.inCnt, k.outCnt, users)
+	} else {
+		err = qalqan.LoadSessionKeysInThenOutForUser(br, k.rKey, &k.sessions, k.inCnt, k.outCnt, users)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyFileLayout, err)
+	}
+	k.nextOut = make([]int, len(k.sessions))
+	if k.wiped {
+		k.clearSessions()
+		if err := k.save(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// encode builds the key file with every key encrypted under rKey.
+func (k *Keyring) encode(rKey []byte, footer [qalqan.BLOCKLEN]byte, hasFooter bool, history [][historyEntryLen]byte) []byte {
+	const key32 = qalqan.DEFAULT_KEY_LEN
+	size := headerLen + key32 + circleCount*key32 + len(k.sessions)*(k.inCnt+k.outCnt)*key32 + qalqan.BLOCKLEN
+	if hasFooter {
+		size += qalqan.BLOCKLEN + len(history)*historyEntryLen + extLen
+	}
+	out := make([]byte, 0, size)
+	out = append(out, k.header[:]...)
+
+	enc := make([]byte, key32)
+	add := func(key []byte) {
+		encryptKey(enc, key, rKey)
+		out = append(out, enc...)
+	}
+	add(k.kikey)
+	for i := range k.circle {
+		add(k.circle[i][:])
+	}
+	var zero [key32]byte
+	for _, s := range k.sessions {
+		for i := 0; i < k.inCnt; i++ {
+			if i < len(s.In) {
+				add(s.In[i][:])
+			} else {
+				add(zero[:])
+			}
+		}
+		for i := 0; i < k.outCnt; i++ {
+			if i < len(s.Out) {
+				add(s.Out[i][:])
+			} else {
+				add(zero[:])
+			}
+		}
+	}
+	if hasFooter {
+		for _, h := range history {
+			out = append(out, h[:]...)
+		}
+		if footer[4] >= 3 {
+			out = append(out, k.ext[:]...)
+		}
+		out = append(out, footer[:]...)
+	}
+	return append(out, imit(k.imitKey, out)...)
+}
+
+// Save writes the keys back to the key file.
+func (k *Keyring) Save() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.save()
+}
+
+func (k *Keyring) save() error {
+	if k.closed {
+		return ErrKeyringClosed
+	}
+	return k.writeKeys(k.encode(k.rKey, k.footer, k.hasFooter, k.history))
+}
+
+// writeKeys writes the key file data. The record of failed sign-ins is carried over, signed
+// anew for the new imit, and written even without one once the sign-in policy is set.
+func (k *Keyring) writeKeys(data []byte) error {
+	a, ok := readAttemptsRecord(k.path)
+	if _, recorded := extPolicy(k.ext); ok || recorded {
+		a.Wiped = false // the keys written are whatever is left
+		data = append(data, encodeAttempts(data, a)...)
+	}
+	if err := os.WriteFile(k.path, data, 0600); err != nil {
+		return fmt.Errorf("%w: %v", ErrSaveKeys, err)
+	}
+	return nil
+}
+
+// ChangePassword re-encrypts the key file with newPassword, marks the password as changed and
+// records it in the history. One of the last PasswordHistory passwords gives ErrPasswordReused.
+// Checking the strength of the password is up to the caller.
+func (k *Keyring) ChangePassword(newPassword string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return ErrKeyringClosed
+	}
+
+	keyHash := qalqan.Hash512(newPassword)
+	if k.passwordUsed(keyHash) {
+		return ErrPasswordReused
+	}
+	history := k.history
+	if len(history) == 0 {
+		// the password being replaced counts as well
+		cur, err := historyEntry(k.keyHash)
+		if err != nil {
+			return err
+		}
+		history = append(history, cur)
+	}
+	entry, err := historyEntry(keyHash)
+	if err != nil {
+		return err
+	}
+	history = append(history[:len(history):len(history)], entry)
+	history = history[max(len(history)-PasswordHistory, 0):]
+
+	rKey := expandKey(keyHash[:])
+	footer := k.passwordFooter(time.Now(), k.passwordMaxAge())
+	footer[5] |= footerFlagChanged
+	footer[6] = byte(len(history))
+
+	if err := k.writeKeys(k.encode(rKey, footer, true, history)); err != nil {
+		return err
+	}
+	k.rKey, k.keyHash = rKey, keyHash
+	k.footer, k.hasFooter, k.history = footer, true, history
+	return nil
+}
+
+// PasswordChanged reports whether the initial password of the key file has been replaced.
+func (k *Keyring) PasswordChanged() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.hasFooter && k.footer[5]&footerFlagChanged != 0
+}
+
+// Close wipes the keys from memory and unlocks the key file. The keyring can't be used afterwards.
+func (k *Keyring) Close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.unlock != nil {
+		k.unlock()
+	}
+	wipe := func(b []byte) {
+		for i := range b {
+			b[i] = 0
+		}
+	}
+	wipe(k.rKey)
+	wipe(k.kikey)
+	wipe(k.imitKey)
+	wipe(k.keyHash[:])
+	wipe(k.journalKey)
+	wipe(k.journalImit)
+	for i := range k.circle {
+		wipe(k.circle[i][:])
+	}
+	for _, s := range k.sessions {
+		for i := range s.In {
+			wipe(s.In[i][:])
+		}
+		for i := range s.Out {
+			wipe(s.Out[i][:])
+		}
+	}
+	k.closed = true
+}
+
+func (k *Keyring) Path() string   { return k.path }
+func (k *Keyring) IsCenter() bool { return k.center }
+
+// User is the user of a user key file, the index of its session keys in center.bin; -1 for the center.
+func (k *Keyring) User() int {
+	if k.center {
+		return -1
+	}
+	if k.header[0] == 0 {
+		return 1
+	}
+	return int(k.header[0])
+}
+
+// Users is the number of session key sets: the users of center.bin, 1 for a user key file.
+func (k *Keyring) Users() int { return len(k.sessions) }
+
+// KeyHash is the hex hash of the password the keys are encrypted with.
+func (k *Keyring) KeyHash() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return hex.EncodeToString(k.keyHash[:])
+}
+
+// Expiry is the date the keys expire, zero if the file has none.
+func (k *Keyring) Expiry() time.Time {
+	return headerExpiry(k.header[:], k.center)
+}
+
+// ReadExpiry reads the expiry date from the header of the key file at path without the password.
+func ReadExpiry(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	hdr := make([]byte, headerLen)
+	if _, err = io.ReadFull(f, hdr); err != nil {
+		return time.Time{}, err
+	}
+	return headerExpiry(hdr, IsCenterFile(path)), nil
+}
+
+func headerExpiry(hdr []byte, center bool) time.Time {
+	if center {
+		if t := unix32LEToTime(hdr[0:4]); !t.IsZero() {
+			return t
+		}
+		if start := be16DaysToTime(hdr[0], hdr[1]); !start.IsZero() {
+			return start.AddDate(0, 0, KeysValidityDays)
+		}
+		return time.Time{}
+	}
+
+	if t := unix32LEToTime(hdr[5:9]); !t.IsZero() {
+		return t
+	}
+	if start := be16DaysToTime(hdr[5], hdr[6]); !start.IsZero() {
+		return start.AddDate(0, 0, KeysValidityDays)
+	}
+	return time.Time{}
+}
+
+func unix32LEToTime(b []byte) time.Time {
+	if len(b) < 4 {
+		return time.Time{}
+	}
+	ts := binary.LittleEndian.Uint32(b)
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(ts), 0).In(time.Local)
+}
+
+func be16DaysToTime(hi, lo byte) time.Time {
+	days := int64(hi)<<8 | int64(lo)
+	if days <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(days*86400, 0).In(time.Local)
+}
+
+type KeyCount struct {
+	User int `json:"user"`
+	In   int `json:"in"`
+	Out  int `json:"out"`
+}
+
+type Status struct {
+	Path            string
+	Center          bool
+	User            int // see Keyring.User
+	Expires         time.Time
+	PasswordChanged bool
+	PasswordSetAt   time.Time // zero when not recorded
+	PasswordExpires time.Time // zero without a limit
+	CircleKeys      int
+	SessionKeys     []KeyCount // per user of center.bin, or the one set of a user key file
+}
+
+// Status counts the keys that are left.
+func (k *Keyring) Status() Status {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	s := Status{
+		Path:            k.path,
+		Center:          k.center,
+		User:            k.User(),
+		Expires:         k.Expiry(),
+		PasswordChanged: k.hasFooter && k.footer[5]&footerFlagChanged != 0,
+		PasswordSetAt:   k.passwordSetAt(),
+		PasswordExpires: k.passwordExpires(),
+		CircleKeys:      k.circleKeysLeft(),
+	}
+	for u := range k.sessions {
+		n := KeyCount{User: u, In: k.sessionInLeft(u), Out: k.sessionOutLeft(u)}
+		if !k.center {
+			n.User = s.User
+		}
+		s.SessionKeys = append(s.SessionKeys, n)
+	}
+	return s
+}
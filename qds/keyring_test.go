@@ -0,0 +1,696 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testPassword = "Passw0rd!x"
+	testUsers    = 3
+	testKeys     = 4
+)
+
+func randomKeys(n int) [][qalqan.DEFAULT_KEY_LEN]byte {
+	keys := make([][qalqan.DEFAULT_KEY_LEN]byte, n)
+	for i := range keys {
+		crand.Read(keys[i][:])
+	}
+	return keys
+}
+
+func writeKeyFile(t *testing.T, path string, header [headerLen]byte, kikey []byte, circle [][qalqan.DEFAULT_KEY_LEN]byte, sessions []qalqan.SessionKeySet) {
+	t.Helper()
+	hash := qalqan.Hash512(testPassword)
+	k := &Keyring{
+		path:     path,
+		header:   header,
+		rKey:     expandKey(hash[:]),
+		kikey:    kikey,
+		imitKey:  expandKey(kikey),
+		circle:   circle,
+		sessions: sessions,
+		inCnt:    testKeys,
+		outCnt:   testKeys,
+	}
+	if err := k.save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestKeys creates center.bin with testUsers users and abc.bin of user #1,
+// whose In keys are the Out keys of the center for it and the other way round.
+func writeTestKeys(t *testing.T) (center, user string) {
+	t.Helper()
+	dir := t.TempDir()
+	kikey := make([]byte, qalqan.DEFAULT_KEY_LEN)
+	crand.Read(kikey)
+	circle := randomKeys(circleCount)
+
+	sessions := make([]qalqan.SessionKeySet, testUsers)
+	for u := range sessions {
+		sessions[u] = qalqan.SessionKeySet{In: randomKeys(testKeys), Out: randomKeys(testKeys)}
+	}
+	var ch [headerLen]byte
+	binary.BigEndian.PutUint16(ch[4:6], testKeys)
+	binary.BigEndian.PutUint16(ch[6:8], testKeys)
+	center = filepath.Join(dir, "center.bin")
+	writeKeyFile(t, center, ch, kikey, circle, sessions)
+
+	var uh [headerLen]byte
+	uh[0] = 1
+	binary.BigEndian.PutUint16(uh[1:3], testKeys)
+	binary.BigEndian.PutUint16(uh[3:5], testKeys)
+	own := qalqan.SessionKeySet{
+		In:  append([][qalqan.DEFAULT_KEY_LEN]byte(nil), sessions[1].Out...),
+		Out: append([][qalqan.DEFAULT_KEY_LEN]byte(nil), sessions[1].In...),
+	}
+	user = filepath.Join(dir, "abc.bin")
+	writeKeyFile(t, user, uh, kikey, circle, []qalqan.SessionKeySet{own})
+	return center, user
+}
+
+func openTest(t *testing.T, path string) *Keyring {
+	t.Helper()
+	k, err := Open(path, testPassword)
+	if err != nil {
+		t.Fatalf("Open(%s): %v", filepath.Base(path), err)
+	}
+	t.Cleanup(k.Close)
+	return k
+}
+
+func TestOpen(t *testing.T) {
+	centerPath, userPath := writeTestKeys(t)
+
+	if _, err := Open(centerPath, "wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("wrong password: got %v", err)
+	}
+
+	center := openTest(t, centerPath)
+	if !center.IsCenter() || center.User() != -1 || center.Users() != testUsers {
+		t.Fatalf("center: center=%v user=%d users=%d", center.IsCenter(), center.User(), center.Users())
+	}
+	user := openTest(t, userPath)
+	if user.IsCenter() || user.User() != 1 || user.Users() != 1 {
+		t.Fatalf("user: center=%v user=%d users=%d", user.IsCenter(), user.User(), user.Users())
+	}
+
+	st := center.Status()
+	if st.CircleKeys != circleCount || len(st.SessionKeys) != testUsers {
+		t.Fatalf("status: %+v", st)
+	}
+	for _, n := range st.SessionKeys {
+		if n.In != testKeys || n.Out != testKeys {
+			t.Fatalf("status of user %d: %+v", n.User, n)
+		}
+	}
+}
+
+func encrypt(t *testing.T, k *Keyring, plain []byte, opts EncryptOptions) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if _, err := k.EncryptFile(&out, bytes.NewReader(plain), opts); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+	return out.Bytes()
+}
+
+func decrypt(t *testing.T, k *Keyring, data []byte) ([]byte, *Container) {
+	t.Helper()
+	var out bytes.Buffer
+	c, err := k.Decrypt(&out, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	return out.Bytes(), c
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	centerPath, userPath := writeTestKeys(t)
+	center := openTest(t, centerPath)
+	user := openTest(t, userPath)
+	plain := bytes.Repeat([]byte("session keys are used once. "), 100)
+
+	data := encrypt(t, center, plain, EncryptOptions{Recipients: []int{1}, Compress: true})
+	got, c := decrypt(t, user, data)
+	if !bytes.Equal(got, plain) {
+		t.Fatal("center -> user: payload differs")
+	}
+	if c.KeyType != KeyTypeSession || c.Owner != ownerCenter || !c.Compressed() {
+		t.Fatalf("center -> user: %+v compressed=%v", c, c.Compressed())
+	}
+	if _, err := user.Decrypt(&bytes.Buffer{}, bytes.NewReader(data)); !errors.Is(err, ErrKeyUsed) {
+		t.Fatalf("second decryption: got %v", err)
+	}
+
+	data = encrypt(t, user, plain, EncryptOptions{Armor: true})
+	if !IsArmored(data) {
+		t.Fatal("armored output expected")
+	}
+	got, c = decrypt(t, center, data)
+	if !bytes.Equal(got, plain) || c.User != 1 {
+		t.Fatalf("user -> center: equal=%v user=%d", bytes.Equal(got, plain), c.User)
+	}
+	if _, err := center.OpenContainer(encrypt(t, center, plain, EncryptOptions{Recipients: []int{2}})); !errors.Is(err, ErrOwnContainer) {
+		t.Fatalf("own container: got %v", err)
+	}
+
+	// the used keys were saved
+	reopened := openTest(t, centerPath)
+	if in, out := reopened.SessionKeysLeft(1); in != testKeys-1 || out != testKeys-1 {
+		t.Fatalf("center keys left for user #2: in=%d out=%d", in, out)
+	}
+}
+
+func TestCircleAndMulti(t *testing.T) {
+	centerPath, userPath := writeTestKeys(t)
+	center := openTest(t, centerPath)
+	user := openTest(t, userPath)
+	plain := []byte("hello")
+
+	for i := 0; i < 2; i++ {
+		got, c := decrypt(t, user, encrypt(t, center, plain, EncryptOptions{Circle: true}))
+		if !bytes.Equal(got, plain) || c.KeyType != KeyTypeCircle {
+			t.Fatalf("circle key: %q %+v", got, c)
+		}
+	}
+	if center.CircleKeysLeft() != circleCount {
+		t.Fatal("circle keys must not be used up")
+	}
+
+	data := encrypt(t, center, plain, EncryptOptions{Recipients: []int{0, 1, 2}})
+	got, c := decrypt(t, user, data)
+	if !bytes.Equal(got, plain) || c.KeyType != KeyTypeMulti || len(c.Recipients) != 3 {
+		t.Fatalf("multi: %q %+v", got, c)
+	}
+	if _, err := center.EncryptFile(&bytes.Buffer{}, bytes.NewReader(plain), EncryptOptions{Recipients: []int{1, 1}}); !errors.Is(err, ErrBadRecipients) {
+		t.Fatalf("duplicate recipients: got %v", err)
+	}
+
+	data = encrypt(t, center, plain, EncryptOptions{Recipients: []int{0, 2}})
+	c, err := user.OpenContainer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.Unlock(c); !errors.Is(err, ErrNotRecipient) {
+		t.Fatalf("not a recipient: got %v", err)
+	}
+}
+
+func TestNoKeysLeft(t *testing.T) {
+	_, userPath := writeTestKeys(t)
+	user := openTest(t, userPath)
+	for i := 0; i < testKeys; i++ {
+		encrypt(t, user, []byte("x"), EncryptOptions{})
+	}
+	if _, err := user.EncryptFile(&bytes.Buffer{}, bytes.NewReader([]byte("x")), EncryptOptions{}); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestDamagedContainer(t *testing.T) {
+	centerPath, userPath := writeTestKeys(t)
+	center := openTest(t, centerPath)
+	user := openTest(t, userPath)
+	data := encrypt(t, center, []byte("payload"), EncryptOptions{Circle: true})
+
+	damaged := append([]byte(nil), data...)
+	damaged[len(damaged)-qalqan.BLOCKLEN-1] ^= 1
+	if _, err := user.Decrypt(&bytes.Buffer{}, bytes.NewReader(damaged)); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("damaged payload: got %v", err)
+	}
+	if _, err := user.Decrypt(&bytes.Buffer{}, bytes.NewReader(data[:2*qalqan.BLOCKLEN])); !errors.Is(err, ErrTooShort) {
+		t.Fatalf("short container: got %v", err)
+	}
+
+	armored := Armor(data)
+	armored[len(ArmorHeader)+5] = '*'
+	var ae *ArmorError
+	if _, err := user.Decrypt(&bytes.Buffer{}, bytes.NewReader(armored)); !errors.As(err, &ae) {
+		t.Fatalf("damaged armor: got %v", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	_, userPath := writeTestKeys(t)
+	k := openTest(t, userPath)
+	if k.PasswordChanged() {
+		t.Fatal("new key file reports a changed password")
+	}
+	data := encrypt(t, k, []byte("x"), EncryptOptions{})
+	if err := k.ChangePassword("N3w-passw0rd"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(userPath, testPassword); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("old password: got %v", err)
+	}
+	k2, err := Open(userPath, "N3w-passw0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k2.Close()
+	if !k2.PasswordChanged() {
+		t.Fatal("password change not recorded")
+	}
+	if _, out := k2.SessionKeysLeft(0); out != testKeys-1 {
+		t.Fatalf("keys left after the change: %d", out)
+	}
+	if _, err := k2.OpenContainer(data); err != nil {
+		t.Fatalf("container made before the change: %v", err)
+	}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	centerPath, _ := writeTestKeys(t)
+	k := openTest(t, centerPath)
+	if !k.PasswordSetAt().IsZero() || !k.PasswordExpires().IsZero() {
+		t.Fatal("new key file records a password change")
+	}
+	if err := k.ChangePassword(testPassword); !errors.Is(err, ErrPasswordReused) {
+		t.Fatalf("current password: got %v", err)
+	}
+	if !k.CheckPassword(testPassword) || k.CheckPassword("Pass-0001") {
+		t.Fatal("CheckPassword doesn't tell the current password")
+	}
+
+	passwords := []string{"Pass-0001", "Pass-0002", "Pass-0003", "Pass-0004", "Pass-0005", "Pass-0006"}
+	for _, p := range passwords {
+		if err := k.ChangePassword(p); err != nil {
+			t.Fatal(p, err)
+		}
+	}
+	k2, err := Open(centerPath, "Pass-0006")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k2.Close()
+	if k2.Users() != testUsers {
+		t.Fatalf("users after the changes: %d", k2.Users())
+	}
+	if since := time.Since(k2.PasswordSetAt()); since < 0 || since > time.Minute {
+		t.Fatalf("change time: %v", k2.PasswordSetAt())
+	}
+	for _, p := range passwords[1:] {
+		if err := k2.ChangePassword(p); !errors.Is(err, ErrPasswordReused) {
+			t.Fatalf("%s: got %v", p, err)
+		}
+	}
+	if k2.PasswordUsed(passwords[0]) || k2.PasswordUsed(testPassword) {
+		t.Fatal("passwords older than the history still count")
+	}
+
+	if got := k2.PasswordMaxAge(); got != DefaultPasswordMaxAge {
+		t.Fatalf("default max age: %d", got)
+	}
+	if err := k2.SetPasswordMaxAge(30); err != nil {
+		t.Fatal(err)
+	}
+	k3, err := Open(centerPath, "Pass-0006")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k3.Close()
+	if got := k3.PasswordExpires(); !got.Equal(k2.PasswordSetAt().AddDate(0, 0, 30)) {
+		t.Fatalf("expires: %v", got)
+	}
+	if !k3.PasswordUsed("Pass-0002") {
+		t.Fatal("history lost by saving the max age")
+	}
+
+	if err := WipeSessionKeys(centerPath); err != nil {
+		t.Fatal(err)
+	}
+	k3.Close()
+	k4, err := Open(centerPath, "Pass-0006")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k4.Close()
+	if !k4.Wiped() || k4.Users() != testUsers || !k4.PasswordUsed("Pass-0002") {
+		t.Fatal("key file after the wipe")
+	}
+}
+
+func TestKeysInUse(t *testing.T) {
+	if path := os.Getenv("QDS_TEST_OPEN"); path != "" {
+		k, err := Open(path, testPassword)
+		switch {
+		case errors.Is(err, ErrKeysInUse):
+			os.Exit(3)
+		case err != nil:
+			os.Exit(4)
+		}
+		k.Close()
+		os.Exit(0)
+	}
+
+	_, userPath := writeTestKeys(t)
+	openElsewhere := func() int {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestKeysInUse$")
+		cmd.Env = append(os.Environ(), "QDS_TEST_OPEN="+userPath)
+		var ee *exec.ExitError
+		if err := cmd.Run(); errors.As(err, &ee) {
+			return ee.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return 0
+	}
+
+	k := openTest(t, userPath)
+	k2 := openTest(t, userPath) // the same process shares the lock
+	k2.Close()
+	if code := openElsewhere(); code != 3 {
+		t.Fatalf("open in another process while locked: exit %d", code)
+	}
+	k.Close()
+	if code := openElsewhere(); code != 0 {
+		t.Fatalf("open in another process after Close: exit %d", code)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	_, userPath := writeTestKeys(t)
+	k, err := Open(userPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+	if _, err := k.EncryptFile(&bytes.Buffer{}, bytes.NewReader([]byte("x")), EncryptOptions{}); !errors.Is(err, ErrKeyringClosed) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestPayloadClosed(t *testing.T) {
+	centerPath, userPath := writeTestKeys(t)
+	center := openTest(t, centerPath)
+	user := openTest(t, userPath)
+	c, err := user.OpenContainer(encrypt(t, center, []byte("payload"), EncryptOptions{Recipients: []int{1}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := user.Unlock(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := p.Open(nil)
+	p.Close()
+	if got, err := io.ReadAll(open); err != nil || string(got) != "payload" {
+		t.Fatalf("reader open before Close: %q %v", got, err)
+	}
+	if _, err := io.ReadAll(p.Open(nil)); !errors.Is(err, ErrPayloadClosed) {
+		t.Fatalf("Open after Close: %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	centerPath, userPath := writeTestKeys(t)
+	center := openTest(t, centerPath)
+	user := openTest(t, userPath)
+
+	for _, plain := range [][]byte{nil, []byte("0123456789abcdef"), bytes.Repeat([]byte("piped data "), 5000)} {
+		for _, opts := range []EncryptOptions{{Circle: true}, {Recipients: []int{1}, Compress: true, Armor: true}} {
+			var enc bytes.Buffer
+			res, err := center.EncryptStream(&enc, bytes.NewReader(plain), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.PlainSize != int64(len(plain)) || res.Compressed != opts.Compress || IsArmored(enc.Bytes()) != opts.Armor {
+				t.Fatalf("result: %+v", res)
+			}
+			var got bytes.Buffer
+			if _, err := user.DecryptStream(&got, &enc); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), plain) {
+				t.Fatalf("%d bytes, %+v: payload differs", len(plain), opts)
+			}
+		}
+	}
+
+	// both ways are one format
+	plain := []byte("made by EncryptStream")
+	var enc bytes.Buffer
+	if _, err := user.EncryptStream(&enc, bytes.NewReader(plain), EncryptOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := decrypt(t, center, enc.Bytes()); !bytes.Equal(got, plain) {
+		t.Fatal("Decrypt of a streamed container differs")
+	}
+	data := encrypt(t, user, plain, EncryptOptions{Armor: true})
+	data[len(data)/2] ^= 1
+	if _, err := center.DecryptStream(io.Discard, bytes.NewReader(data)); err == nil {
+		t.Fatal("damaged container accepted")
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	_, userPath := writeTestKeys(t)
+	user := openTest(t, userPath)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts := EncryptOptions{Context: ctx}
+	if _, err := user.EncryptFile(&bytes.Buffer{}, bytes.NewReader([]byte("x")), opts); !errors.Is(err, context.Canceled) {
+		t.Fatalf("EncryptFile: got %v", err)
+	}
+	if _, err := user.EncryptArchive(&bytes.Buffer{}, []Entry{memEntry("a", []byte("x"))}, opts); !errors.Is(err, context.Canceled) {
+		t.Fatalf("EncryptArchive: got %v", err)
+	}
+	if _, out := user.SessionKeysLeft(0); out != testKeys {
+		t.Fatalf("keys used by canceled work: %d left", out)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	centerPath, userPath := writeTestKeys(t)
+	center := openTest(t, centerPath)
+	user := openTest(t, userPath)
+
+	var enc bytes.Buffer
+	res, err := center.EncryptFile(&enc, bytes.NewReader([]byte("report")), EncryptOptions{Recipients: []int{0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := center.AppendJournal(center.SealedEntries(res, JournalFile, "report.txt")...); err != nil {
+		t.Fatal(err)
+	}
+	c, err := user.OpenContainer(enc.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.Unlock(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.AppendJournal(user.OpenedEntry(c, "report.bin")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := center.ReadJournal()
+	if err != nil || len(got) != 2 {
+		t.Fatalf("center journal: %+v %v", got, err)
+	}
+	if got[1].Direction != DirectionOut || got[1].Peer != 2 || got[1].KeyType != "multi" || got[1].KeyIndex != 1 || got[1].File != "report.txt" {
+		t.Fatalf("sealed entry: %+v", got[1])
+	}
+	mine, err := user.ReadJournal()
+	if err != nil || len(mine) != 1 || mine[0].Direction != DirectionIn || mine[0].Peer != 0 || mine[0].KeyIndex != 1 {
+		t.Fatalf("user journal: %+v %v", mine, err)
+	}
+
+	if err := center.AppendJournal(JournalEntry{File: "third"}); err != nil {
+		t.Fatal(err)
+	}
+	path := JournalPath(centerPath)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recLen := journalLenSize + 2*qalqan.BLOCKLEN + int(binary.BigEndian.Uint32(data))
+	var je *JournalError
+
+	// the second record removed
+	second := journalLenSize + 2*qalqan.BLOCKLEN + int(binary.BigEndian.Uint32(data[recLen:]))
+	cut := append(append([]byte(nil), data[:recLen]...), data[recLen+second:]...)
+	os.WriteFile(path, cut, 0o600)
+	if got, err := center.ReadJournal(); !errors.As(err, &je) || je.Record != 2 || len(got) != 1 {
+		t.Fatalf("removed record: %d entries, %v", len(got), err)
+	}
+
+	// a byte of the first record changed
+	data[10] ^= 1
+	os.WriteFile(path, data, 0o600)
+	if _, err := center.ReadJournal(); !errors.As(err, &je) || je.Record != 1 || !errors.Is(err, ErrJournalBroken) {
+		t.Fatalf("changed record: %v", err)
+	}
+	data[10] ^= 1
+
+	// records cut off the end, which can't be hidden by appending
+	os.WriteFile(path, data[:recLen], 0o600)
+	if got, err := center.ReadJournal(); !errors.As(err, &je) || je.Record != 2 || len(got) != 1 {
+		t.Fatalf("cut off journal: %d entries, %v", len(got), err)
+	}
+	if err := center.AppendJournal(JournalEntry{File: "fourth"}); !errors.Is(err, ErrJournalBroken) {
+		t.Fatalf("append to a cut off journal: %v", err)
+	}
+
+	// the journal removed, also after the key file is opened again
+	os.Remove(path)
+	center.Close()
+	center = openTest(t, centerPath)
+	if _, err := center.ReadJournal(); !errors.As(err, &je) || je.Record != 1 {
+		t.Fatalf("removed journal: %v", err)
+	}
+
+	os.WriteFile(path, data, 0o600)
+	if got, err := center.ReadJournal(); err != nil || len(got) != 3 {
+		t.Fatalf("restored journal: %d entries, %v", len(got), err)
+	}
+}
+
+func TestContacts(t *testing.T) {
+	centerPath, _ := writeTestKeys(t)
+	center := openTest(t, centerPath)
+
+	if got, err := center.LoadContacts(); err != nil || got != nil {
+		t.Fatalf("no address book yet: %v %v", got, err)
+	}
+	want := []Contact{{User: 2, Name: "Aigerim", Department: "Finance", Avatar: []byte{0x89, 'P', 'N', 'G'}}}
+	if err := center.SaveContacts(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := center.LoadContacts()
+	if err != nil || len(got) != 1 || got[0].Name != "Aigerim" || !bytes.Equal(got[0].Avatar, want[0].Avatar) {
+		t.Fatalf("loaded %+v %v", got, err)
+	}
+
+	data, err := os.ReadFile(ContactsPath(centerPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[20] ^= 1
+	os.WriteFile(ContactsPath(centerPath), data, 0o600)
+	if _, err := center.LoadContacts(); !errors.Is(err, ErrContactsBroken) {
+		t.Fatalf("changed file: %v", err)
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	_, userPath := writeTestKeys(t)
+
+	a, err := ReadAttempts(userPath)
+	if err != nil || a.Failures != 0 || a.MaxFailures != DefaultMaxFailures {
+		t.Fatalf("no record yet: %+v %v", a, err)
+	}
+	want := Attempts{Failures: 3, Last: time.Unix(1700000000, 0), LockedUntil: time.Unix(1700000900, 0)}
+	if err := WriteAttempts(userPath, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadAttempts(userPath)
+	if err != nil || got.Failures != 3 || !got.Last.Equal(want.Last) || !got.LockedUntil.Equal(want.LockedUntil) {
+		t.Fatalf("read %+v %v", got, err)
+	}
+
+	// the policy is kept under the imit of the key file, the record follows it
+	k := openTest(t, userPath)
+	if _, recorded := k.SignInPolicy(); recorded {
+		t.Fatal("policy recorded before it was set")
+	}
+	if err := k.SetSignInPolicy(Attempts{MaxFailures: 3, LockoutMinutes: 30, WipeAfter: 10}); err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+	got, err = ReadAttempts(userPath)
+	if err != nil || got.Failures != 3 || got.MaxFailures != 3 || got.LockoutMinutes != 30 || got.WipeAfter != 10 {
+		t.Fatalf("after the policy: %+v %v", got, err)
+	}
+	k = openTest(t, userPath)
+	if p, recorded := k.SignInPolicy(); !recorded || p.WipeAfter != 10 {
+		t.Fatalf("policy after reopening: %+v %v", p, recorded)
+	}
+	k.Close()
+
+	data, _ := os.ReadFile(userPath)
+	changed := bytes.Clone(data)
+	changed[len(changed)-attemptsRecLen+6] = 0 // fewer failures
+	os.WriteFile(userPath, changed, 0o600)
+	if _, err := ReadAttempts(userPath); !errors.Is(err, ErrAttemptsBroken) {
+		t.Fatalf("changed record: %v", err)
+	}
+	os.WriteFile(userPath, data[:len(data)-attemptsRecLen], 0o600)
+	if a, err := ReadAttempts(userPath); !errors.Is(err, ErrAttemptsBroken) || a.WipeAfter != 10 {
+		t.Fatalf("record cut off after the policy was set: %+v %v", a, err)
+	}
+	os.WriteFile(userPath, data, 0o600)
+
+	if err := WipeSessionKeys(userPath); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := ReadAttempts(userPath); err != nil || !a.Wiped || a.Failures != 3 {
+		t.Fatalf("record after the wipe: %+v %v", a, err)
+	}
+	if _, err := Open(userPath, testPassword); !errors.Is(err, ErrKeysWiped) {
+		t.Fatalf("open after the wipe: %v", err)
+	}
+}
+
+func TestWipedKeys(t *testing.T) {
+	_, userPath := writeTestKeys(t)
+	k := openTest(t, userPath)
+	if err := k.ChangePassword("N3w-passw0rd"); err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+
+	if err := WipeSessionKeys(userPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(userPath, testPassword); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("older password after the wipe: %v", err)
+	}
+	k, err := Open(userPath, "N3w-passw0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+	if !k.Wiped() || k.CircleKeysLeft() != circleCount {
+		t.Fatalf("wiped %v, circle keys %d", k.Wiped(), k.CircleKeysLeft())
+	}
+	if in, out := k.SessionKeysLeft(0); in != 0 || out != 0 {
+		t.Fatalf("session keys left after the wipe: %d %d", in, out)
+	}
+	k.Close()
+
+	// the file is whole again, without the session keys
+	k2, err := Open(userPath, "N3w-passw0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k2.Close()
+	if k2.Wiped() {
+		t.Fatal("wipe reported again")
+	}
+	if a, err := ReadAttempts(userPath); err != nil || a.Wiped {
+		t.Fatalf("record after reopening: %+v %v", a, err)
+	}
+
+	// without a password history the key file can't be told from a wrong password
+	_, userPath = writeTestKeys(t)
+	if err := WipeSessionKeys(userPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(userPath, testPassword); !errors.Is(err, ErrKeysWiped) {
+		t.Fatalf("wiped key file without history: %v", err)
+	}
+}
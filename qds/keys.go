@@ -0,0 +1,145 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	crand "crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// The helpers below expect k.mu to be held.
+
+func keyAllZero(k *[qalqan.DEFAULT_KEY_LEN]byte) bool {
+	for i := 0; i < qalqan.DEFAULT_KEY_LEN; i++ {
+		if k[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (k *Keyring) useCircleKey(idx int) []byte {
+	if idx < 0 || idx >= len(k.circle) || keyAllZero(&k.circle[idx]) {
+		return nil
+	}
+	return expandKey(k.circle[idx][:])
+}
+
+// pickCircleKey picks a random circle key; circle keys are not used up.
+func (k *Keyring) pickCircleKey() (int, []byte) {
+	n := len(k.circle)
+	available := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		if !keyAllZero(&k.circle[i]) {
+			available = append(available, i)
+		}
+	}
+	if len(available) == 0 {
+		return -1, nil
+	}
+
+	idx := available[0]
+	if r, err := crand.Int(crand.Reader, big.NewInt(int64(len(available)))); err == nil {
+		idx = available[r.Int64()]
+	}
+	return idx, k.useCircleKey(idx)
+}
+
+// useSessionIn expands the In key idx of user and deletes it.
+func (k *Keyring) useSessionIn(user, idx int) []byte {
+	if user < 0 || user >= len(k.sessions) {
+		return nil
+	}
+	in := k.sessions[user].In
+	if idx < 0 || idx >= len(in) || keyAllZero(&in[idx]) {
+		return nil
+	}
+	rKey := expandKey(in[idx][:])
+	in[idx] = [qalqan.DEFAULT_KEY_LEN]byte{}
+	return rKey
+}
+
+// useSessionOut expands the next Out key of user that is left and deletes it.
+func (k *Keyring) useSessionOut(user int) ([]byte, int) {
+	if user < 0 || user >= len(k.sessions) {
+		return nil, -1
+	}
+	out := k.sessions[user].Out
+	for ofs := 0; ofs < len(out); ofs++ {
+		idx := (k.nextOut[user] + ofs) % len(out)
+		if keyAllZero(&out[idx]) {
+			continue
+		}
+		rKey := expandKey(out[idx][:])
+		out[idx] = [qalqan.DEFAULT_KEY_LEN]byte{}
+		k.nextOut[user] = (idx + 1) % len(out)
+		return rKey, idx
+	}
+	return nil, -1
+}
+
+func (k *Keyring) sessionInLeft(user int) int {
+	if user < 0 || user >= len(k.sessions) {
+		return 0
+	}
+	n := 0
+	for i := range k.sessions[user].In {
+		if !keyAllZero(&k.sessions[user].In[i]) {
+			n++
+		}
+	}
+	return n
+}
+
+func (k *Keyring) sessionOutLeft(user int) int {
+	if user < 0 || user >= len(k.sessions) {
+		return 0
+	}
+	n := 0
+	for i := range k.sessions[user].Out {
+		if !keyAllZero(&k.sessions[user].Out[i]) {
+			n++
+		}
+	}
+	return n
+}
+
+func (k *Keyring) circleKeysLeft() int {
+	n := 0
+	for i := range k.circle {
+		if !keyAllZero(&k.circle[i]) {
+			n++
+		}
+	}
+	return n
+}
+
+// SessionKeysLeft counts the session keys left for user: the user of center.bin, 0 for a user key file.
+func (k *Keyring) SessionKeysLeft(user int) (in, out int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.sessionInLeft(user), k.sessionOutLeft(user)
+}
+
+func (k *Keyring) CircleKeysLeft() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.circleKeysLeft()
+}
+
+// chooseKey uses up a key to encrypt for user: the next Out session key or a random circle key.
+func (k *Keyring) chooseKey(user int, session bool) (rKey []byte, keyType byte, circleIdx, sessionIdx int, err error) {
+	if !session {
+		if ci, rk := k.pickCircleKey(); rk != nil {
+			return rk, KeyTypeCircle, ci, -1, nil
+		}
+		return nil, 0, -1, -1, fmt.Errorf("%w: no circle keys left", ErrNoKeys)
+	}
+	if len(k.sessions) == 0 {
+		return nil, 0, -1, -1, fmt.Errorf("%w: no session keys loaded", ErrNoKeys)
+	}
+	if rk, idx := k.useSessionOut(user); rk != nil {
+		return rk, KeyTypeSession, -1, idx, nil
+	}
+	return nil, 0, -1, -1, fmt.Errorf("%w: session keys empty for user #%d", ErrNoKeys, user+1)
+}
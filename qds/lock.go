@@ -0,0 +1,66 @@
+package qds
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A key file is locked for as long as a keyring has it open, so that two programs never use
+// up the same session key or write back keys the other has deleted. The lock is taken on a
+// file next to the key file, which is left behind; within one process it is shared.
+const lockExt = ".lock"
+
+var (
+	locksMu sync.Mutex
+	locks   = map[string]*keysLock{}
+)
+
+type keysLock struct {
+	f    *os.File
+	refs int
+}
+
+// LockPath is the lock file kept next to the key file at keysPath.
+func LockPath(keysPath string) string {
+	return strings.TrimSuffix(keysPath, filepath.Ext(keysPath)) + lockExt
+}
+
+// lockKeys locks the key file at keysPath for this process; ErrKeysInUse tells that another
+// process holds it. The returned function releases the lock.
+func lockKeys(keysPath string) (func(), error) {
+	path, err := filepath.Abs(LockPath(keysPath))
+	if err != nil {
+		return nil, err
+	}
+	locksMu.Lock()
+	defer locksMu.Unlock()
+
+	l := locks[path]
+	if l == nil {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		l = &keysLock{f: f}
+		locks[path] = l
+	}
+	l.refs++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			locksMu.Lock()
+			defer locksMu.Unlock()
+			if l.refs--; l.refs == 0 {
+				delete(locks, path)
+				l.f.Close() // closing the file releases the lock
+			}
+		})
+	}, nil
+}
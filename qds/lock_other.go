@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+
+package qds
+
+import "os"
+
+// there is only one program at a time where files can't be locked (the browser)
+func lockFile(*os.File) error { return nil }
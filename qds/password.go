@@ -0,0 +1,170 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"time"
+)
+
+// The footer of version 2 keeps the time of the last password change, the maximum age of the
+// password and the last PasswordHistory passwords. A password is kept as a random salt and
+// the hash of the salt with the password key, so it can be matched but not read back.
+const (
+	historyEntryLen = qalqan.BLOCKLEN + 32
+
+	PasswordHistory       = 5
+	DefaultPasswordMaxAge = 90 // days
+)
+
+// trailerLen is the length of the footer with the history before it at the end of body, 0 without one.
+func trailerLen(body []byte) int {
+	if len(body) < qalqan.BLOCKLEN {
+		return 0
+	}
+	footer := body[len(body)-qalqan.BLOCKLEN:]
+	if [4]byte(footer[:4]) != footerMagic {
+		return 0
+	}
+	n := qalqan.BLOCKLEN
+	if footer[4] >= 2 {
+		n += int(footer[6]) * historyEntryLen
+	}
+	if footer[4] >= 3 {
+		n += extLen
+	}
+	if n > len(body) {
+		return 0
+	}
+	return n
+}
+
+func historySum(salt []byte, keyHash [32]byte) [32]byte {
+	return qalqan.Hash512("qds password\x00" + string(salt) + string(keyHash[:]))
+}
+
+func historyEntry(keyHash [32]byte) ([historyEntryLen]byte, error) {
+	var e [historyEntryLen]byte
+	if _, err := crand.Read(e[:qalqan.BLOCKLEN]); err != nil {
+		return e, err
+	}
+	sum := historySum(e[:qalqan.BLOCKLEN], keyHash)
+	copy(e[qalqan.BLOCKLEN:], sum[:])
+	return e, nil
+}
+
+func (k *Keyring) passwordUsed(keyHash [32]byte) bool {
+	used := subtle.ConstantTimeCompare(keyHash[:], k.keyHash[:])
+	for _, e := range k.history {
+		sum := historySum(e[:qalqan.BLOCKLEN], keyHash)
+		used |= subtle.ConstantTimeCompare(sum[:], e[qalqan.BLOCKLEN:])
+	}
+	return used == 1
+}
+
+// passwordFooter is the footer of version 3 with the flags and history of the current one.
+func (k *Keyring) passwordFooter(setAt time.Time, maxAge int) [qalqan.BLOCKLEN]byte {
+	var f [qalqan.BLOCKLEN]byte
+	copy(f[0:4], footerMagic[:])
+	f[4] = 3
+	if k.hasFooter {
+		f[5] = k.footer[5]
+	}
+	f[6] = byte(len(k.history))
+	if !setAt.IsZero() {
+		binary.BigEndian.PutUint32(f[7:11], uint32(setAt.Unix()))
+	}
+	binary.BigEndian.PutUint16(f[11:13], uint16(min(max(maxAge, 0), 0xffff)))
+	return f
+}
+
+// upgradeFooter brings the footer to version 3, which has the ext block.
+func (k *Keyring) upgradeFooter() {
+	if !k.hasFooter || k.footer[4] < 3 {
+		k.footer, k.hasFooter = k.passwordFooter(k.passwordSetAt(), k.passwordMaxAge()), true
+	}
+}
+
+func (k *Keyring) passwordSetAt() time.Time {
+	if !k.hasFooter || k.footer[4] < 2 {
+		return time.Time{}
+	}
+	if t := binary.BigEndian.Uint32(k.footer[7:11]); t != 0 {
+		return time.Unix(int64(t), 0)
+	}
+	return time.Time{}
+}
+
+func (k *Keyring) passwordMaxAge() int {
+	if !k.hasFooter || k.footer[4] < 2 {
+		return DefaultPasswordMaxAge
+	}
+	return int(binary.BigEndian.Uint16(k.footer[11:13]))
+}
+
+func (k *Keyring) passwordExpires() time.Time {
+	setAt, days := k.passwordSetAt(), k.passwordMaxAge()
+	if setAt.IsZero() || days == 0 {
+		return time.Time{}
+	}
+	return setAt.AddDate(0, 0, days)
+}
+
+// CheckPassword reports whether password is the one the key file is encrypted with.
+func (k *Keyring) CheckPassword(password string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	h := qalqan.Hash512(password)
+	return !k.closed && subtle.ConstantTimeCompare(h[:], k.keyHash[:]) == 1
+}
+
+// PasswordUsed reports whether password is the current one or one of the last PasswordHistory.
+func (k *Keyring) PasswordUsed(password string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.passwordUsed(qalqan.Hash512(password))
+}
+
+// PasswordSetAt is the time of the last password change, zero when the key file doesn't record it.
+func (k *Keyring) PasswordSetAt() time.Time {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.passwordSetAt()
+}
+
+// PasswordMaxAge is the number of days a password may be used, 0 for no limit.
+func (k *Keyring) PasswordMaxAge() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.passwordMaxAge()
+}
+
+// PasswordExpires is when the password has to be changed, zero without a limit or before
+// the time of the change is recorded.
+func (k *Keyring) PasswordExpires() time.Time {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.passwordExpires()
+}
+
+// SetPasswordMaxAge sets the number of days a password may be used, 0 for no limit, and writes
+// the key file. A key file that doesn't record the time of the last change starts counting now.
+func (k *Keyring) SetPasswordMaxAge(days int) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return ErrKeyringClosed
+	}
+	setAt := k.passwordSetAt()
+	if setAt.IsZero() {
+		setAt = time.Now()
+	}
+	old, hadFooter := k.footer, k.hasFooter
+	k.footer, k.hasFooter = k.passwordFooter(setAt, days), true
+	if err := k.save(); err != nil {
+		k.footer, k.hasFooter = old, hadFooter
+		return err
+	}
+	return nil
+}
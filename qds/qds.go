@@ -0,0 +1,87 @@
+// Package qds is the Qalqan-DS encryption engine: key files, containers,
+// ASCII armor and multi-file archives. The desktop application and the
+// command line are clients of this package; it has no user interface.
+//
+//	k, err := qds.Open("center.bin", password)
+//	if err != nil { ... }
+//	defer k.Close()
+//	res, err := k.EncryptFile(out, in, qds.EncryptOptions{Recipients: []int{1}})
+//	...
+//	c, err := k.Decrypt(plain, container)
+//
+// User numbers are indexes of the session key sets in center.bin, counted from 0.
+package qds
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	FileTypeGeneric = 0x00
+	FileTypeVideo   = 0x77
+	FileTypePhoto   = 0x88
+	FileTypeText    = 0x00
+	FileTypeAudio   = 0x55
+
+	MaxPlainSize int64 = 2 * 1024 * 1024 * 1024 // 2Gb
+
+	MaxEncryptedSize int64 = MaxPlainSize + 80 // (serviceinfo + metaImit + IV + fileImit) +16 = 64
+
+	MaxArmoredSize int64 = MaxEncryptedSize/3*4 + MaxEncryptedSize/32 + 1024 // base64 + CRLF every 64 chars + header/footer
+
+	KeysValidityDays = 90
+	KeyValidityDays  = 30
+)
+
+var (
+	ErrTooShort       = errors.New("file too short")
+	ErrTooBig         = errors.New("file too big")
+	ErrWrongPassword  = errors.New("wrong password or damaged key file")
+	ErrKeyFileLayout  = errors.New("bad key file layout")
+	ErrCorrupted      = errors.New("container imit mismatch")
+	ErrHeaderImit     = errors.New("service info imit mismatch")
+	ErrNoIV           = errors.New("invalid container: no IV")
+	ErrTruncated      = errors.New("invalid container: not enough data")
+	ErrOwnContainer   = errors.New("the container was made with this key file")
+	ErrNotRecipient   = errors.New("this key file is not a recipient of the container")
+	ErrBadSession     = errors.New("invalid session key index")
+	ErrKeyUsed        = errors.New("decryption key is not available")
+	ErrNoKeys         = errors.New("no keys available")
+	ErrBadRecipients  = errors.New("bad recipients")
+	ErrSaveKeys       = errors.New("can't save the key file")
+	ErrKeyringClosed  = errors.New("keyring is closed")
+	ErrEntryNotFound  = errors.New("entry not found")
+	ErrUnsafeEntry    = errors.New("unsafe path in archive")
+	ErrArchiveChanged = errors.New("file changed while packing")
+	ErrPasswordReused = errors.New("password was used recently")
+	ErrKeysInUse      = errors.New("key file is in use by another program")
+	ErrPayloadClosed  = errors.New("container is closed")
+)
+
+// UnknownSenderError is returned by the center for a container whose sender has no session keys in center.bin.
+type UnknownSenderError struct {
+	Owner byte
+}
+
+func (e *UnknownSenderError) Error() string {
+	return fmt.Sprintf("unknown sender %d", e.Owner)
+}
+
+// ArmorError reports armored text that can't be decoded.
+type ArmorError struct {
+	Err error
+}
+
+func (e *ArmorError) Error() string { return "armor: " + e.Err.Error() }
+
+func (e *ArmorError) Unwrap() error { return e.Err }
+
+// ChecksumError reports an archive entry whose data does not match its SHA-256.
+type ChecksumError struct {
+	Name string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: %s", e.Name)
+}
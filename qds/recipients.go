@@ -0,0 +1,99 @@
+package qds
+
+import (
+	"QalqanDS/qalqan"
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+	multi-recipient container (service info [5] = 0x02):
+
+svc[16] | metaImit[16] | table | IV[16] | ct | fileImit[16]
+
+table header [16]:
+
+	[0..3] = 'Q','R','C','P'
+	[4..5] = recipients count (BE16)
+	[6..15] = 0
+
+table entry [48] for every recipient:
+
+	[0]      = user index in center.bin (== localUserNumber of the recipient)
+	[1..2]   = session_index+1 (BE16), the same encoding as svc[7..8]
+	[3..15]  = 0
+	[16..47] = data key encrypted with the recipient's session key
+*/
+const (
+	recipientTableMagic = "QRCP"
+	recipientHeaderLen  = qalqan.BLOCKLEN
+	recipientEntryLen   = qalqan.BLOCKLEN + qalqan.DEFAULT_KEY_LEN
+	maxRecipients       = 255
+)
+
+// Recipient is an entry of the recipient table of a multi-recipient container.
+type Recipient struct {
+	User         int
+	SessionIndex int
+
+	wrappedKey [qalqan.DEFAULT_KEY_LEN]byte
+}
+
+func wrapDataKey(rKey []byte, dataKey []byte) [qalqan.DEFAULT_KEY_LEN]byte {
+	var w [qalqan.DEFAULT_KEY_LEN]byte
+	encryptKey(w[:], dataKey, rKey)
+	return w
+}
+
+func unwrapDataKey(rKey []byte, wrapped []byte) []byte {
+	dk := make([]byte, qalqan.DEFAULT_KEY_LEN)
+	decryptKey(dk, wrapped, rKey)
+	return dk
+}
+
+func encodeRecipientTable(entries []Recipient) []byte {
+	out := make([]byte, recipientHeaderLen+len(entries)*recipientEntryLen)
+	copy(out[0:4], recipientTableMagic)
+	binary.BigEndian.PutUint16(out[4:6], uint16(len(entries)))
+	off := recipientHeaderLen
+	for _, e := range entries {
+		out[off] = byte(e.User)
+		binary.BigEndian.PutUint16(out[off+1:off+3], uint16(e.SessionIndex+1))
+		copy(out[off+qalqan.BLOCKLEN:off+recipientEntryLen], e.wrappedKey[:])
+		off += recipientEntryLen
+	}
+	return out
+}
+
+// parseRecipientTable returns the entries and the number of bytes the table occupies.
+func parseRecipientTable(b []byte) ([]Recipient, int, error) {
+	if len(b) < recipientHeaderLen || string(b[0:4]) != recipientTableMagic {
+		return nil, 0, fmt.Errorf("bad recipient table")
+	}
+	n := int(binary.BigEndian.Uint16(b[4:6]))
+	if n <= 0 || n > maxRecipients {
+		return nil, 0, fmt.Errorf("bad recipients count %d", n)
+	}
+	size := recipientHeaderLen + n*recipientEntryLen
+	if len(b) < size {
+		return nil, 0, fmt.Errorf("recipient table truncated")
+	}
+	entries := make([]Recipient, n)
+	off := recipientHeaderLen
+	for i := range entries {
+		entries[i].User = int(b[off])
+		entries[i].SessionIndex = int(binary.BigEndian.Uint16(b[off+1:off+3])) - 1
+		copy(entries[i].wrappedKey[:], b[off+qalqan.BLOCKLEN:off+recipientEntryLen])
+		off += recipientEntryLen
+	}
+	return entries, size, nil
+}
+
+func findRecipient(entries []Recipient, user int) (Recipient, bool) {
+	for _, e := range entries {
+		if e.User == user {
+			return e, true
+		}
+	}
+	return Recipient{}, false
+}
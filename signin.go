@@ -0,0 +1,251 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"errors"
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Each failed sign-in makes the next one wait longer: 1, 2, 4… seconds, up to signInMaxDelay.
+// After MaxFailures in a row the key file is locked out for LockoutMinutes, and again after
+// every failure past that; after WipeAfter failures the session keys are wiped. The count
+// and the policy are kept in the record next to the key file, so the CLI obeys them too.
+const signInMaxDelay = 30 * time.Second
+
+var (
+	maxFailureChoices = []int{3, 5, 10, 0}
+	lockoutChoices    = []int{5, 15, 30, 60}
+	wipeAfterChoices  = []int{0, 10, 20, 50}
+)
+
+// lastFailedSignIns is how many failed sign-ins came before the current session, and
+// lastSignInWiped whether they wiped the session keys.
+var (
+	lastFailedSignIns int
+	lastSignInWiped   bool
+)
+
+func signInDelay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	return min(time.Second<<min(failures-1, 5), signInMaxDelay)
+}
+
+func formatWait(d time.Duration) string {
+	return formatJobDuration(max(d, time.Second))
+}
+
+// writeAttempts records a and tells, if it can't, that signing in has to wait until it can:
+// failures that aren't recorded aren't throttled.
+func writeAttempts(keysPath string, a qds.Attempts) error {
+	if err := qds.WriteAttempts(keysPath, a); err != nil {
+		return fmt.Errorf(tr("signin_record_error"), localizeError(err))
+	}
+	return nil
+}
+
+// checkSignIn tells whether the key file at keysPath may be tried now.
+func checkSignIn(keysPath string) error {
+	a, err := qds.ReadAttempts(keysPath)
+	now := time.Now()
+	if errors.Is(err, qds.ErrAttemptsBroken) {
+		// an edited or missing record counts as a lockout
+		a.Failures, a.Last = max(a.MaxFailures, 1), now
+		a.LockedUntil = now.Add(time.Duration(a.LockoutMinutes) * time.Minute)
+		if err := writeAttempts(keysPath, a); err != nil {
+			return err
+		}
+		return fmt.Errorf(tr("signin_record_broken"), a.LockoutMinutes)
+	}
+	if err != nil {
+		return fmt.Errorf(tr("signin_record_error"), localizeError(err))
+	}
+	if now.Before(a.LockedUntil) {
+		return fmt.Errorf(tr("signin_locked"), formatWait(a.LockedUntil.Sub(now)))
+	}
+	if wait := a.Last.Add(signInDelay(a.Failures)).Sub(now); wait > 0 {
+		return fmt.Errorf(tr("signin_wait"), formatWait(wait))
+	}
+	return nil
+}
+
+// signInFailed counts a wrong password for the key file at keysPath and tells what follows from it.
+// With the key file open, open wipes its session keys itself, so that nothing writes them back.
+func signInFailed(keysPath string, open *qds.Keyring) error {
+	a, err := qds.ReadAttempts(keysPath)
+	if err != nil && !errors.Is(err, qds.ErrAttemptsBroken) {
+		return fmt.Errorf(tr("signin_record_error"), localizeError(err))
+	}
+	now := time.Now()
+	a.Failures++
+	a.Last = now
+
+	if a.WipeAfter > 0 && a.Failures >= a.WipeAfter && !a.Wiped {
+		if open != nil {
+			err = open.DropSessionKeys()
+		} else {
+			err = qds.WipeSessionKeys(keysPath)
+		}
+		if err != nil {
+			return fmt.Errorf(tr("signin_wipe_error"), localizeError(err))
+		}
+		a.Wiped = true
+		if err := writeAttempts(keysPath, a); err != nil {
+			return err
+		}
+		return errors.New(tr("signin_wiped"))
+	}
+
+	msg := fmt.Errorf(tr("signin_failed"), a.Failures, formatWait(signInDelay(a.Failures)))
+	if a.MaxFailures > 0 && a.Failures >= a.MaxFailures {
+		a.LockedUntil = now.Add(time.Duration(a.LockoutMinutes) * time.Minute)
+		msg = fmt.Errorf(tr("signin_lockout"), a.Failures, a.LockoutMinutes)
+	}
+	switch {
+	case a.Wiped:
+		msg = fmt.Errorf("%s\n%v", tr("signin_keys_wiped"), msg)
+	case a.WipeAfter > 0:
+		msg = fmt.Errorf("%v\n%s", msg, fmt.Sprintf(tr("signin_wipe_warning"), a.WipeAfter-a.Failures))
+	}
+	if err := writeAttempts(keysPath, a); err != nil {
+		return err
+	}
+	return msg
+}
+
+// signInSucceeded clears the failures with the key file of k and keeps their number for the log.
+// The first time, it records the policy in the key file, after which the record can't be dropped.
+func signInSucceeded(k *qds.Keyring) error {
+	keysPath := k.Path()
+	a, _ := qds.ReadAttempts(keysPath)
+	lastFailedSignIns, lastSignInWiped = a.Failures, a.Wiped || k.Wiped()
+	a.Failures, a.Last, a.LockedUntil, a.Wiped = 0, time.Time{}, time.Time{}, false
+	if err := writeAttempts(keysPath, a); err != nil {
+		return err
+	}
+	if _, recorded := k.SignInPolicy(); !recorded {
+		if err := k.SetSignInPolicy(a); err != nil {
+			return fmt.Errorf(tr("signin_policy_error"), localizeError(err))
+		}
+	}
+	return nil
+}
+
+func choiceSelect(choices []int, label func(int) string, current int, set func(int)) *widget.Select {
+	opts := make([]string, len(choices))
+	for i, c := range choices {
+		opts[i] = label(c)
+	}
+	s := widget.NewSelect(opts, func(picked string) {
+		for i, o := range opts {
+			if o == picked {
+				set(choices[i])
+			}
+		}
+	})
+	s.SetSelected(label(current))
+	if s.Selected == "" {
+		s.PlaceHolder = label(current)
+	}
+	return s
+}
+
+// ShowSecurityWindow sets the auto-lock, the rules for new passwords, their maximum age and the
+// policy for failed sign-ins with the key file.
+func ShowSecurityWindow(win fyne.Window, logs *widget.RichText) {
+	a, _ := keyring.SignInPolicy()
+	curPass := widget.NewPasswordEntry()
+	curPass.SetPlaceHolder(tr("current_password"))
+
+	lockMin := lockMinutes()
+	lockSelect := choiceSelect(lockMinuteChoices, lockMinutesLabel, lockMin, func(n int) { lockMin = n })
+	maxAge := keyring.PasswordMaxAge()
+	maxAgeSelect := choiceSelect(passwordMaxAgeChoices, passwordMaxAgeLabel, maxAge, func(n int) { maxAge = n })
+	minScore, minLen := passwordMinScore(), passwordMinLength()
+	minScoreSelect := choiceSelect(passwordMinScoreChoices, passwordScoreLabel, minScore, func(n int) { minScore = n })
+	minLenSelect := choiceSelect(passwordMinLengthChoices, func(n int) string {
+		return fmt.Sprintf(tr("password_n_chars"), n)
+	}, minLen, func(n int) { minLen = n })
+	maxSelect := choiceSelect(maxFailureChoices, func(n int) string {
+		if n == 0 {
+			return tr("signin_no_lockout")
+		}
+		return fmt.Sprintf(tr("signin_n_failures"), n)
+	}, a.MaxFailures, func(n int) { a.MaxFailures = n })
+	lockoutSelect := choiceSelect(lockoutChoices, func(n int) string {
+		return fmt.Sprintf(tr("signin_n_minutes"), n)
+	}, a.LockoutMinutes, func(n int) { a.LockoutMinutes = n })
+	wipeSelect := choiceSelect(wipeAfterChoices, func(n int) string {
+		if n == 0 {
+			return tr("signin_never_wipe")
+		}
+		return fmt.Sprintf(tr("signin_n_failures"), n)
+	}, a.WipeAfter, func(n int) { a.WipeAfter = n })
+
+	hint := widget.NewLabel(tr("signin_policy_hint"))
+	hint.Wrapping = fyne.TextWrapWord
+	hint.TextStyle.Italic = true
+
+	form := container.NewVBox(
+		widget.NewForm(
+			widget.NewFormItem(tr("current_password"), curPass),
+			widget.NewFormItem(tr("auto_lock"), lockSelect),
+			widget.NewFormItem(tr("password_max_age"), maxAgeSelect),
+			widget.NewFormItem(tr("password_min_length"), minLenSelect),
+			widget.NewFormItem(tr("password_min_score"), minScoreSelect),
+			widget.NewFormItem(tr("signin_lockout_after"), maxSelect),
+			widget.NewFormItem(tr("signin_lockout_for"), lockoutSelect),
+			widget.NewFormItem(tr("signin_wipe_after"), wipeSelect),
+		),
+		hint,
+	)
+
+	bg := canvas.NewImageFromFile("assets/background.png")
+	bg.FillMode = canvas.ImageFillStretch
+	d := dialog.NewCustomConfirm(tr("security"), tr("save"), tr("cancel"), container.NewStack(bg, container.NewPadded(form)), func(ok bool) {
+		if !ok {
+			return
+		}
+		if curPass.Text == "" {
+			dialog.ShowInformation(tr("error"), tr("enter_current_password"), win)
+			return
+		}
+		lock, err := checkCurrentPassword(curPass.Text)
+		if err != nil {
+			d := dialog.NewError(err, win)
+			if lock {
+				d.SetOnClosed(func() { lockSession(fyne.CurrentApp(), win) })
+			}
+			d.Show()
+			return
+		}
+		prefs := fyne.CurrentApp().Preferences()
+		prefs.SetInt("lock_minutes", lockMin)
+		prefs.SetInt("password_min_length", minLen)
+		prefs.SetInt("password_min_score", minScore)
+		noteActivity()
+		if maxAge != keyring.PasswordMaxAge() {
+			if err := keyring.SetPasswordMaxAge(maxAge); err != nil {
+				dialog.ShowError(fmt.Errorf(tr("password_max_age_error"), localizeError(err)), win)
+				return
+			}
+			addLog(logs, fmt.Sprintf(tr("password_max_age_saved"), passwordMaxAgeLabel(maxAge)))
+		}
+
+		if err := keyring.SetSignInPolicy(a); err != nil {
+			dialog.ShowError(fmt.Errorf(tr("signin_policy_error"), localizeError(err)), win)
+			return
+		}
+		addLog(logs, tr("signin_policy_saved"))
+	}, win)
+	d.Resize(fyne.NewSize(620, 500))
+	d.Show()
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+
+package main
+
+import "errors"
+
+func readPasswordTTY(prompt string) (string, error) {
+	return "", errors.New("reading the password from a terminal is not supported here, use --password-fd")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// readPasswordTTY asks for the password on the console with echo turned off.
+func readPasswordTTY(prompt string) (string, error) {
+	in, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no console to read the password from, use --password-fd: %w", err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0)
+	if err != nil {
+		return "", fmt.Errorf("no console to read the password from, use --password-fd: %w", err)
+	}
+	defer out.Close()
+
+	h := windows.Handle(in.Fd())
+	var old uint32
+	if err := windows.GetConsoleMode(h, &old); err != nil {
+		return "", err
+	}
+	mode := old&^windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT
+	if err := windows.SetConsoleMode(h, mode); err != nil {
+		return "", err
+	}
+	defer windows.SetConsoleMode(h, old)
+
+	fmt.Fprint(out, prompt)
+	defer fmt.Fprintln(out)
+	return readPasswordLine(in)
+}
@@ -1,19 +1,13 @@
 package main
 
 import (
-	"QalqanDS/qalqan"
-	"bytes"
-	crand "crypto/rand"
-	"crypto/subtle"
-	"encoding/binary"
-	"encoding/hex"
+	"QalqanDS/qds"
+	"errors"
 	"fmt"
 	"image/color"
 	"io"
-	"math/big"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -27,21 +21,6 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
-const (
-	FileTypeGeneric = 0x00
-	FileTypeVideo   = 0x77
-	FileTypePhoto   = 0x88
-	FileTypeText    = 0x00
-	FileTypeAudio   = 0x55
-
-	MaxPlainSize int64 = 2 * 1024 * 1024 * 1024 // 2Gb
-
-	MaxEncryptedSize int64 = MaxPlainSize + 80 // (serviceinfo + metaImit + IV + fileImit) +16 = 64
-
-	KeysValidityDays = 90
-	KeyValidityDays  = 30
-)
-
 type KeyPref int
 
 const (
@@ -49,84 +28,11 @@ const (
 	KeyPrefCircle
 )
 
-var SkeyInCnt int
-var SkeyOutCnt int
-
-type progressReader struct {
-	r        io.Reader
-	total    int64
-	read     int64
-	lastEmit time.Time
-	emit     func(f float64)
-}
-
-func (p *progressReader) Read(b []byte) (int, error) {
-	n, err := p.r.Read(b)
-	if n > 0 {
-		p.read += int64(n)
-		if time.Since(p.lastEmit) > 40*time.Millisecond || p.read == p.total {
-			if p.total > 0 && p.emit != nil {
-				p.emit(float64(p.read) / float64(p.total))
-			}
-			p.lastEmit = time.Now()
-		}
-	}
-	return n, err
-}
-
 func uiLog(logs *widget.RichText, msg string) {
-	runOnMain(func() { addLog(logs, msg) })
-}
-
-type ServiceInfo struct {
-	Owner        byte // [1]
-	FileType     byte // [4]
-	KeyType      byte // [5]
-	CircleIndex  int  // [6] (0..99) или 0, если не используется
-	SessionIndex int  // [7..8] (0..999) или -1, если не используется
-}
-
-func SetLocalUserNumber(n int) {
-	if n <= 0 || n > 255 {
-		n = 1
-	}
-	localUserNumber = byte(n)
-}
-
-func buildServiceInfo(fileTypeCode, keyType byte, circleNo int, usedIdx int) [qalqan.BLOCKLEN]byte {
-	var s [qalqan.BLOCKLEN]byte
-	s[0] = 0x00
-	if isCenterMode {
-		s[1] = 0x33 // метка Центра
-	} else {
-		s[1] = byte(localUserNumber) // номер отправителя (1..N)
-	}
-	s[2] = 0x04
-	s[3] = byte(qalqan.DEFAULT_KEY_LEN) // 0x20
-	s[4] = fileTypeCode
-	s[5] = keyType
-
-	if circleNo >= 0 && circleNo < len(circle_keys) {
-		s[6] = byte(circleNo)
-	}
-
-	if usedIdx > 0 && usedIdx <= 0xFFFF {
-		s[7] = byte(usedIdx >> 8)
-		s[8] = byte(usedIdx)
-		//s[9] = 0x88 multi encrypt files
-
-	}
-	// [10..15] = 0
-	return s
-}
-
-func decodeSessionIndex(si []byte) int {
-	if len(si) < 9 {
-		return -1
+	if logs == nil {
+		return
 	}
-
-	nBE := int(si[7])<<8 | int(si[8])
-	return (nBE - 1) // если -1 (нет индекса), иначе 0-базовый индекс
+	runOnMain(func() { addLog(logs, msg) })
 }
 
 func keyPrefIsSession() bool { return keyPref == KeyPrefSession }
@@ -139,15 +45,29 @@ func suggestEncryptedNameFromPath(p string) string {
 	return b + ".bin"
 }
 
+func fileTypeFromPath(p string) byte {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".jpg", ".jpeg", ".png", ".bmp", ".gif", ".webp", ".tiff":
+		return qds.FileTypePhoto
+	case ".txt", ".md", ".log", ".csv":
+		return qds.FileTypeText
+	case ".mp3", ".wav", ".ogg", ".m4a", ".flac":
+		return qds.FileTypeAudio
+	case ".mp4", ".mov", ".avi", ".mkv", ".wmv", ".flv", ".webm", ".m4v":
+		return qds.FileTypeVideo
+	}
+	return qds.FileTypeGeneric
+}
+
 func fileTypeDefaultExt(ft byte) string {
 	switch ft {
-	case FileTypePhoto:
+	case qds.FileTypePhoto:
 		return ".jpg"
-	case FileTypeText:
+	case qds.FileTypeText:
 		return ".txt"
-	case FileTypeAudio:
+	case qds.FileTypeAudio:
 		return ".mp3"
-	case FileTypeVideo:
+	case qds.FileTypeVideo:
 		return ".mp4"
 	default:
 		return ".bin"
@@ -174,6 +94,9 @@ func makeTitleBanner() fyne.CanvasObject {
 
 func suggestDecryptedNameFromPath(p string, fileType byte) string {
 	b := baseName(p)
+	if strings.EqualFold(filepath.Ext(b), qds.ArmorExt) {
+		b = b[:len(b)-len(qds.ArmorExt)]
+	}
 	name := b
 	if strings.EqualFold(filepath.Ext(b), ".bin") {
 		name = b[:len(b)-len(".bin")]
@@ -188,52 +111,6 @@ func suggestDecryptedNameFromPath(p string, fileType byte) string {
 	return name
 }
 
-func readKeysExpiryDates(path string, centerMode bool) (keysExp, keyExp time.Time, err error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return time.Time{}, time.Time{}, err
-	}
-	defer f.Close()
-
-	hdr := make([]byte, 16)
-	if _, err = io.ReadFull(f, hdr); err != nil {
-		return time.Time{}, time.Time{}, err
-	}
-
-	if centerMode {
-		ke := unix32LEToTime(hdr[0:4])
-		e := unix32LEToTime(hdr[4:8])
-
-		if ke.IsZero() {
-			start := be16DaysToTime(hdr[0], hdr[1])
-			if !start.IsZero() {
-				ke = start.AddDate(0, 0, KeysValidityDays)
-			}
-		}
-		if e.IsZero() {
-			start := be16DaysToTime(hdr[2], hdr[3])
-			if !start.IsZero() {
-				e = start.AddDate(0, 0, KeyValidityDays)
-			}
-		}
-		return ke, e, nil
-	}
-
-	if t := unix32LEToTime(hdr[5:9]); !t.IsZero() {
-		return t, time.Time{}, nil
-	}
-
-	startKeys := be16DaysToTime(hdr[5], hdr[6])
-	startKey := be16DaysToTime(hdr[7], hdr[8])
-	if !startKeys.IsZero() {
-		startKeys = startKeys.AddDate(0, 0, KeysValidityDays)
-	}
-	if !startKey.IsZero() {
-		startKey = startKey.AddDate(0, 0, KeyValidityDays)
-	}
-	return startKeys, startKey, nil
-}
-
 func ruDays(n int) string {
 	a := n % 100
 	if a >= 11 && a <= 14 {
@@ -281,27 +158,8 @@ func formatKeysCountdownText(exp time.Time) string {
 	return fmt.Sprintf(tr("keys_countdown"), leftDays, daysWord(leftDays), d)
 }
 
-func unix32LEToTime(b []byte) time.Time {
-	if len(b) < 4 {
-		return time.Time{}
-	}
-	ts := binary.LittleEndian.Uint32(b)
-	if ts == 0 {
-		return time.Time{}
-	}
-	return time.Unix(int64(ts), 0).In(time.Local)
-}
-
-func be16DaysToTime(hi, lo byte) time.Time {
-	days := int64(hi)<<8 | int64(lo)
-	if days <= 0 {
-		return time.Time{}
-	}
-	return time.Unix(days*86400, 0).In(time.Local)
-}
-
 func updateKeysDates(keysPath string) {
-	keysExp, _, err := readKeysExpiryDates(keysPath, isCenterMode)
+	keysExp, err := qds.ReadExpiry(keysPath)
 	if err != nil {
 		keysDatesText = ""
 		keysExpiryCache = time.Time{}
@@ -316,194 +174,17 @@ func updateKeysDates(keysPath string) {
 
 var (
 	isCenterMode       bool
-	session_keys       []qalqan.SessionKeySet
-	circle_keys        [][qalqan.DEFAULT_KEY_LEN]byte
-	rimitkey           []byte
-	localUserIndex          = 0
-	localUserNumber    byte = 1
+	localUserIndex     = 0
+	armorOutput        bool
 	keysDateLabel      *widget.Label
 	keysDatesText      string
 	lastKeyHashHex     string
 	keysExpiryCache    time.Time
-	nextOutIdx         []int
-	nextCircleIdx      int
 	recipientHintLabel *widget.Label
 	recipientDim       *canvas.Rectangle
 	recipientLockLbl   *widget.Label
 )
 
-func init() {
-	rimitkey = make([]byte, qalqan.EXPKLEN)
-}
-
-func ApplyLocalUserContext(keysPath string, users int) {
-	base := strings.ToLower(filepath.Base(keysPath))
-	if strings.Contains(base, "center") || users > 1 {
-		isCenterMode = true
-		localUserNumber = 0x33
-		localUserIndex = 0
-	} else {
-		isCenterMode = false
-		localUserNumber = 1
-		localUserIndex = 0
-	}
-	updateKeysDates(keysPath)
-}
-
-func sessionKeyAllZero(k *[qalqan.DEFAULT_KEY_LEN]byte) bool {
-	for i := 0; i < qalqan.DEFAULT_KEY_LEN; i++ {
-		if k[i] != 0 {
-			return false
-		}
-	}
-	return true
-}
-
-func circleKeyAllZero(k *[qalqan.DEFAULT_KEY_LEN]byte) bool {
-	for i := 0; i < qalqan.DEFAULT_KEY_LEN; i++ {
-		if k[i] != 0 {
-			return false
-		}
-	}
-	return true
-}
-
-func useCircleKey(circleKeyNumber int) []uint8 {
-	if circleKeyNumber < 0 || circleKeyNumber >= len(circle_keys) {
-		return nil
-	}
-	if circleKeyAllZero(&circle_keys[circleKeyNumber]) {
-		return nil
-	}
-	key := circle_keys[circleKeyNumber][:]
-	rkey := make([]uint8, qalqan.EXPKLEN)
-	qalqan.Kexp(key, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, rkey)
-
-	return rkey
-}
-
-func pickAnyCircleKey() (int, []byte) {
-	n := len(circle_keys)
-	if n == 0 {
-		return -1, nil
-	}
-
-	available := make([]int, 0, n)
-	for i := 0; i < n; i++ {
-		if !circleKeyAllZero(&circle_keys[i]) {
-			available = append(available, i)
-		}
-	}
-	if len(available) == 0 {
-		return -1, nil
-	}
-
-	r, err := crand.Int(crand.Reader, big.NewInt(int64(len(available))))
-	if err != nil {
-		idx := available[0]
-		if rk := useCircleKey(idx); rk != nil {
-			nextCircleIdx = (idx + 1) % n
-			return idx, rk
-		}
-		return -1, nil
-	}
-
-	idx := available[r.Int64()]
-	if rk := useCircleKey(idx); rk != nil {
-		nextCircleIdx = (idx + 1) % n
-		return idx, rk
-	}
-
-	for _, j := range available {
-		if rk := useCircleKey(j); rk != nil {
-			nextCircleIdx = (j + 1) % n
-			return j, rk
-		}
-	}
-	return -1, nil
-}
-
-func useAndDeleteSessionIn(userIdx, idx int) ([]uint8, int) {
-	if len(session_keys) == 0 || userIdx < 0 || userIdx >= len(session_keys) {
-		return nil, -1
-	}
-	inCnt := len(session_keys[userIdx].In)
-	if idx < 0 || idx >= inCnt {
-		return nil, -1
-	}
-	if sessionKeyAllZero(&session_keys[userIdx].In[idx]) {
-		return nil, -1
-	}
-	raw := session_keys[userIdx].In[idx][:]
-	rkey := make([]uint8, qalqan.EXPKLEN)
-	qalqan.Kexp(raw, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, rkey)
-
-	for j := 0; j < qalqan.DEFAULT_KEY_LEN; j++ {
-		session_keys[userIdx].In[idx][j] = 0
-	}
-	return rkey, idx
-}
-
-func useAndDeleteSessionOut(userIdx int, start int) ([]uint8, int) {
-	if len(session_keys) == 0 || userIdx < 0 || userIdx >= len(session_keys) {
-		return nil, -1
-	}
-	outCnt := len(session_keys[userIdx].Out)
-	if outCnt <= 0 {
-		return nil, -1
-	}
-
-	for ofs := 0; ofs < outCnt; ofs++ {
-		idx := (start + ofs) % outCnt
-		if !sessionKeyAllZero(&session_keys[userIdx].Out[idx]) {
-			raw := session_keys[userIdx].Out[idx][:]
-			rkey := make([]uint8, qalqan.EXPKLEN)
-			qalqan.Kexp(raw, qalqan.DEFAULT_KEY_LEN, qalqan.BLOCKLEN, rkey)
-
-			for j := 0; j < qalqan.DEFAULT_KEY_LEN; j++ {
-				session_keys[userIdx].Out[idx][j] = 0
-			}
-
-			nextOutIdx[userIdx] = (idx + 1) % outCnt
-			if nextOutIdx[userIdx] >= outCnt {
-				nextOutIdx[userIdx] = 0
-			}
-
-			if isCenterMode {
-				_ = writeCurrentKeysFile()
-			}
-			return rkey, idx
-		}
-	}
-	return nil, -1
-}
-
-func countRemainingSessionOut(userIdx int) int {
-	if len(session_keys) == 0 || userIdx < 0 || userIdx >= len(session_keys) {
-		return 0
-	}
-	cnt := 0
-	for i := 0; i < len(session_keys[userIdx].Out); i++ {
-		if !sessionKeyAllZero(&session_keys[userIdx].Out[i]) {
-			cnt++
-		}
-	}
-	return cnt
-}
-
-func countRemainingSessionIn(userIdx int) int {
-	if len(session_keys) == 0 || userIdx < 0 || userIdx >= len(session_keys) {
-		return 0
-	}
-	cnt := 0
-	for i := 0; i < len(session_keys[userIdx].In); i++ {
-		if !sessionKeyAllZero(&session_keys[userIdx].In[i]) {
-			cnt++
-		}
-	}
-	return cnt
-}
-
 func baseName(path string) string {
 	b := filepath.Base(path)
 	if b == "." || b == "/" || b == "\\" || b == "" {
@@ -512,28 +193,6 @@ func baseName(path string) string {
 	return b
 }
 
-func chooseKeyForEncryption(targetUserIdx int, useSession bool) (rKey []byte, keyTypeByte byte, circleIndex int, usedIdx int, err error) {
-	if useSession {
-		if len(session_keys) == 0 {
-			return nil, 0, -1, -1, fmt.Errorf("no session keys loaded")
-		}
-		uidx := targetUserIdx
-		if uidx < 0 || uidx >= len(session_keys) {
-			uidx = localUserIndex
-		}
-		start := nextOutIdx[uidx]
-		if rk, idx := useAndDeleteSessionOut(uidx, start); rk != nil && idx >= 0 {
-			return rk, 0x01, -1, idx, nil // 0x01 = session
-		}
-		return nil, 0, -1, -1, fmt.Errorf("session keys empty for user #%d", uidx+1)
-	}
-
-	if ci, rk := pickAnyCircleKey(); rk != nil {
-		return rk, 0x00, ci, -1, nil // 0x00 = circle
-	}
-	return nil, 0, -1, -1, fmt.Errorf("no circle keys available")
-}
-
 func makeLogsArea() (*widget.RichText, fyne.CanvasObject) {
 	logs := widget.NewRichText(&widget.TextSegment{Text: "", Style: widget.RichTextStyleInline})
 	logs.Wrapping = fyne.TextWrapWord
@@ -564,6 +223,9 @@ func makeLogsArea() (*widget.RichText, fyne.CanvasObject) {
 }
 
 func addLog(logs *widget.RichText, text string) {
+	if logs == nil {
+		return
+	}
 	logs.Segments = append(logs.Segments, &widget.TextSegment{
 		Text:  text + "\n",
 		Style: widget.RichTextStyleInline,
@@ -606,7 +268,7 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 
 	selectedLanguage := widget.NewSelect([]string{"KZ", "RU", "EN"}, nil)
 	var updateRecipientState func()
-	var changePwdBtn *widget.Button
+	var changePwdBtn, watchBtn, apiBtn, journalBtn, dashboardBtn, contactsBtn, lockBtn, securityBtn *widget.Button
 	selectedLanguage.PlaceHolder = tr("select_language")
 	selectedLanguage.OnChanged = func(code string) {
 		setLang(app, code)
@@ -616,19 +278,20 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 		if decBtn != nil {
 			decBtn.SetText(tr("decrypt"))
 		}
-		if keysLeftLabel != nil {
-			idx := selectedUserIdx
-			if !isCenterMode {
-				idx = localUserIndex
-			}
-			keysLeftLabel.SetText(formatKeysLeft(idx))
-		}
+		refreshKeysLeft()
+		refreshJobs()
 		if encHintLabel != nil {
 			encHintLabel.SetText(tr("encrypt_card_hint"))
 		}
 		if decHintLabel != nil {
 			decHintLabel.SetText(tr("decrypt_card_hint"))
 		}
+		if msgBtn != nil {
+			msgBtn.SetText(tr("messages"))
+		}
+		if msgHintLabel != nil {
+			msgHintLabel.SetText(tr("messages_card_hint"))
+		}
 		if clearLogBtn != nil {
 			clearLogBtn.SetText(tr("clear_log"))
 		}
@@ -653,6 +316,53 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 		if changePwdBtn != nil {
 			changePwdBtn.SetText(tr("change_password"))
 		}
+		if watchBtn != nil {
+			watchBtn.SetText(tr("watch_folders"))
+		}
+		if apiBtn != nil {
+			apiBtn.SetText(tr("local_api"))
+		}
+		if journalBtn != nil {
+			journalBtn.SetText(tr("journal"))
+		}
+		if dashboardBtn != nil {
+			dashboardBtn.SetText(tr("dashboard"))
+		}
+		if contactsBtn != nil {
+			contactsBtn.SetText(tr("address_book"))
+		}
+		if lockBtn != nil {
+			lockBtn.SetText(tr("lock"))
+		}
+		if securityBtn != nil {
+			securityBtn.SetText(tr("security"))
+		}
+		if multiRecipientsBtn != nil {
+			multiRecipientsBtn.SetText(tr("several_recipients"))
+		}
+		if optionsCard != nil {
+			optionsCard.Subtitle = tr("options")
+			optionsCard.Refresh()
+		}
+		if compressCheck != nil {
+			compressCheck.Text = tr("compress_before_encrypt")
+			compressCheck.Refresh()
+		}
+		if armorCheck != nil {
+			armorCheck.Text = tr("armored_output")
+			armorCheck.Refresh()
+		}
+		if volumeSelect != nil {
+			volumeSelect.Options = volumeSizeOptions()
+			volumeSelect.SetSelected(volumeSizeLabel(volumeSize))
+		}
+		if volumeCaption != nil {
+			volumeCaption.SetText(tr("split_volumes"))
+		}
+		if recipientSelect != nil && len(selectedRecipients) > 1 {
+			recipientSelect.PlaceHolder = recipientsLabel(selectedRecipients)
+			recipientSelect.Refresh()
+		}
 		updateRecipientState()
 	}
 
@@ -663,21 +373,62 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 		}
 
 		changePwdBtn = widget.NewButtonWithIcon(tr("change_password"), icon, func() {
-			if strings.TrimSpace(keysFilePath) == "" || len(currentPlainKikey) != qalqan.DEFAULT_KEY_LEN {
+			if keyring == nil {
 				dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
 				return
 			}
-			data, err := os.ReadFile(keysFilePath)
-			if err != nil {
-				dialog.ShowError(err, win)
-				return
-			}
-			ShowChangePassword(app, win, keysFilePath, data, append([]byte(nil), currentPlainKikey...))
+			ShowChangePassword(app, win, true)
 		})
 	}
 
 	logs, logsArea := makeLogsArea()
 
+	watchBtn = widget.NewButtonWithIcon(tr("watch_folders"), theme.FolderIcon(), func() {
+		if keyring == nil {
+			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+			return
+		}
+		ShowWatchFoldersWindow(win, logs)
+	})
+	apiBtn = widget.NewButtonWithIcon(tr("local_api"), theme.ComputerIcon(), func() {
+		if keyring == nil {
+			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+			return
+		}
+		ShowLocalAPIWindow(win, logs)
+	})
+	journalBtn = widget.NewButtonWithIcon(tr("journal"), theme.HistoryIcon(), func() {
+		if keyring == nil {
+			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+			return
+		}
+		ShowJournalWindow(win, logs)
+	})
+	dashboardBtn = widget.NewButtonWithIcon(tr("dashboard"), theme.GridIcon(), func() {
+		if keyring == nil {
+			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+			return
+		}
+		ShowDashboardWindow(win, logs)
+	})
+	contactsBtn = widget.NewButtonWithIcon(tr("address_book"), theme.AccountIcon(), func() {
+		if keyring == nil {
+			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+			return
+		}
+		ShowAddressBookWindow(win, logs)
+	})
+	lockBtn = widget.NewButtonWithIcon(tr("lock"), theme.VisibilityOffIcon(), func() {
+		confirmLock(app, win)
+	})
+	securityBtn = widget.NewButtonWithIcon(tr("security"), theme.SettingsIcon(), func() {
+		if keyring == nil {
+			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+			return
+		}
+		ShowSecurityWindow(win, logs)
+	})
+
 	keysLeftLabel = widget.NewLabelWithStyle(formatKeysLeft(localUserIndex),
 		fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
 	keysLeftLabel.TextStyle.Monospace = true
@@ -691,7 +442,7 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 	))
 	keysWrap := container.NewGridWrap(fyne.NewSize(280, 100), keysCard)
 
-	if len(session_keys) > 0 {
+	if keyring.Users() > 0 {
 		keyPref = KeyPrefSession
 	} else {
 		keyPref = KeyPrefCircle
@@ -719,6 +470,9 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 
 		if wantDisabled {
 			recipientSelect.Disable()
+			if multiRecipientsBtn != nil {
+				multiRecipientsBtn.Disable()
+			}
 			if recipientLockLbl != nil {
 				recipientLockLbl.Show()
 			}
@@ -726,6 +480,9 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 			recipientCard.Refresh()
 		} else {
 			recipientSelect.Enable()
+			if multiRecipientsBtn != nil {
+				multiRecipientsBtn.Enable()
+			}
 			if recipientLockLbl != nil {
 				recipientLockLbl.Hide()
 			}
@@ -746,15 +503,44 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 	keyTypeCard = widget.NewCard("", tr("select_key_type"), container.NewVBox(keyTypeSelect))
 	keyTypeWrap := container.NewGridWrap(fyne.NewSize(200, 100), keyTypeCard)
 
+	compressEnabled = app.Preferences().BoolWithFallback("compress", false)
+	compressCheck = widget.NewCheck(tr("compress_before_encrypt"), func(on bool) {
+		compressEnabled = on
+		app.Preferences().SetBool("compress", on)
+	})
+	compressCheck.SetChecked(compressEnabled)
+
+	loadExtractPrefs()
+
+	armorOutput = app.Preferences().BoolWithFallback("armor", false)
+	armorCheck = widget.NewCheck(tr("armored_output"), func(on bool) {
+		armorOutput = on
+		app.Preferences().SetBool("armor", on)
+	})
+	armorCheck.SetChecked(armorOutput)
+
+	volumeSize = labelToVolumeSize(volumeSizeLabel(int64(app.Preferences().IntWithFallback("volume_size", 0))))
+	volumeSelect = widget.NewSelect(volumeSizeOptions(), func(s string) {
+		volumeSize = labelToVolumeSize(s)
+		app.Preferences().SetInt("volume_size", int(volumeSize))
+	})
+	volumeSelect.SetSelected(volumeSizeLabel(volumeSize))
+	volumeCaption = widget.NewLabel(tr("split_volumes"))
+
+	optionsCard = widget.NewCard("", tr("options"), container.NewVBox(
+		compressCheck,
+		armorCheck,
+		container.NewHBox(volumeCaption, volumeSelect),
+	))
+	optionsWrap := container.NewGridWrap(fyne.NewSize(300, 160), optionsCard)
+
 	var recipientWrap fyne.CanvasObject
-	if isCenterMode && len(session_keys) > 0 {
-		opts := make([]string, len(session_keys))
-		for i := range session_keys {
-			opts[i] = strconv.Itoa(i + 1)
-		}
+	if isCenterMode && keyring.Users() > 0 {
+		opts := userOptions()
 		recipientSelect = widget.NewSelect(opts, func(val string) {
-			if i, err := strconv.Atoi(val); err == nil {
-				selectedUserIdx = i - 1
+			if u, ok := parseUserOption(val); ok {
+				selectedUserIdx = u
+				selectedRecipients = nil
 				keysLeftLabel.SetText(formatKeysLeft(selectedUserIdx))
 			}
 		})
@@ -762,13 +548,25 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 		recipientSelect.SetSelected(opts[0])
 		keysLeftLabel.SetText(formatKeysLeft(selectedUserIdx))
 
+		multiRecipientsBtn = widget.NewButtonWithIcon(tr("several_recipients"), theme.AccountIcon(), func() {
+			ShowRecipientsPicker(win, func() {
+				if len(selectedRecipients) == 1 {
+					recipientSelect.SetSelected(userOption(selectedRecipients[0]))
+					return
+				}
+				recipientSelect.PlaceHolder = recipientsLabel(selectedRecipients)
+				recipientSelect.ClearSelected()
+				keysLeftLabel.SetText(formatKeysLeft(selectedUserIdx))
+			})
+		})
+
 		recipientHintLabel = widget.NewLabelWithStyle("", fyne.TextAlignCenter, fyne.TextStyle{Italic: true})
 		recipientHintLabel.Hide()
 
 		recipientLockLbl = widget.NewLabelWithStyle("🔒", fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
 		recipientLockLbl.Hide()
 
-		inner := container.NewVBox(recipientSelect, widget.NewLabel(" "), recipientHintLabel)
+		inner := container.NewVBox(recipientSelect, multiRecipientsBtn, recipientHintLabel)
 
 		stacked := container.NewMax(
 			inner,
@@ -808,6 +606,14 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 
 	encCardWrap := container.NewGridWrap(fyne.NewSize(285, 110), encCard)
 	decCardWrap := container.NewGridWrap(fyne.NewSize(285, 110), decCard)
+
+	msgBtn = makeMessagesButton(win, logs)
+	msgHintLabel = widget.NewLabelWithStyle(tr("messages_card_hint"), fyne.TextAlignCenter, fyne.TextStyle{})
+	msgCard := widget.NewCard("", "", container.NewVBox(
+		container.NewCenter(container.NewGridWrap(fyne.NewSize(140, 44), msgBtn)),
+		msgHintLabel,
+	))
+	msgCardWrap := container.NewGridWrap(fyne.NewSize(285, 110), msgCard)
 	titleBanner := makeTitleBanner()
 
 	modeLabel = widget.NewLabelWithStyle(getModeLabelText(), fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
@@ -820,36 +626,52 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 		keysDateLabel,
 	)
 
-	topBar := container.NewHBox(
-		container.NewPadded(left),
+	tools := []fyne.CanvasObject{
 		layout.NewSpacer(),
-		container.NewGridWrap(fyne.NewSize(180, 28), changePwdBtn),
+		container.NewGridWrap(fyne.NewSize(180, 28), watchBtn),
 		widget.NewLabel(" "),
-		container.NewGridWrap(fyne.NewSize(65, 28), selectedLanguage),
+		container.NewGridWrap(fyne.NewSize(150, 28), apiBtn),
+		widget.NewLabel(" "),
+		container.NewGridWrap(fyne.NewSize(150, 28), journalBtn),
+	}
+	if isCenterMode {
+		tools = append(tools,
+			widget.NewLabel(" "),
+			container.NewGridWrap(fyne.NewSize(150, 28), dashboardBtn),
+			widget.NewLabel(" "),
+			container.NewGridWrap(fyne.NewSize(150, 28), contactsBtn),
+		)
+	}
+	topBar := container.NewVBox(
+		container.NewHBox(
+			container.NewPadded(left),
+			layout.NewSpacer(),
+			container.NewGridWrap(fyne.NewSize(110, 28), lockBtn),
+			container.NewGridWrap(fyne.NewSize(130, 28), securityBtn),
+			widget.NewLabel(" "),
+			container.NewGridWrap(fyne.NewSize(180, 28), changePwdBtn),
+			widget.NewLabel(" "),
+			container.NewGridWrap(fyne.NewSize(65, 28), selectedLanguage),
+		),
+		container.NewHBox(tools...),
 	)
 
-	rowElems := []fyne.CanvasObject{layout.NewSpacer(), keysWrap, widget.NewLabel("  "), keyTypeWrap}
+	rowElems := []fyne.CanvasObject{layout.NewSpacer(), keysWrap, widget.NewLabel("  "), keyTypeWrap, widget.NewLabel("  "), optionsWrap}
 	if recipientWrap != nil {
 		rowElems = append(rowElems, widget.NewLabel("  "), recipientWrap)
 	}
 	rowElems = append(rowElems, layout.NewSpacer())
 	infoRow := container.NewHBox(rowElems...)
 
-	progressBar = widget.NewProgressBar()
-	progressBar.Min = 0
-	progressBar.Max = 1
-	progressLabel = widget.NewLabel("")
-	progressCard = widget.NewCard("", "", container.NewVBox(
-		container.NewCenter(progressLabel),
-		progressBar,
-	))
-	progressCard.Hide()
+	jobsCard := makeJobsCard()
 
 	actionsRow := container.NewHBox(
 		layout.NewSpacer(),
 		encCardWrap,
 		widget.NewLabel(" "),
 		decCardWrap,
+		widget.NewLabel(" "),
+		msgCardWrap,
 		layout.NewSpacer(),
 	)
 
@@ -858,16 +680,17 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 		widget.NewLabel(" "),
 		infoRow,
 		titleBanner,
-		progressCard,
+		jobsCard,
 		actionsRow,
 		widget.NewLabel(" "),
 		logsArea,
 	)
 
-	content := container.NewStack(bgImage, mainUI)
+	content := container.NewStack(bgImage, newActivitySurface(), mainUI)
 	win.SetContent(content)
 
 	win.Canvas().SetOnTypedKey(func(ev *fyne.KeyEvent) {
+		noteActivity()
 		switch ev.Name {
 		case fyne.KeyF11:
 			newVal := !win.FullScreen()
@@ -892,6 +715,25 @@ func InitMainUI(app fyne.App, win fyne.Window) {
 	} else {
 		addLog(logs, tr("keys_loaded"))
 	}
+	if lastFailedSignIns > 0 {
+		addLog(logs, fmt.Sprintf(tr("signin_failures_since"), lastFailedSignIns))
+	}
+	if lastSignInWiped {
+		addLog(logs, tr("signin_keys_were_wiped"))
+	}
+	if exp := keyring.PasswordExpires(); !exp.IsZero() && time.Until(exp) < passwordExpiryWarnDays*24*time.Hour {
+		addLog(logs, fmt.Sprintf(tr("password_expires_soon"), exp.Format("02.01.2006 15:04")))
+	}
+	win.SetOnDropped(func(_ fyne.Position, uris []fyne.URI) {
+		handleDroppedURIs(win, logs, keysLeftLabel, uris)
+	})
+	restoreFolderWatcher(logs)
+	restoreLocalAPI(win, logs)
+	startIdleLock(app, win)
+	win.SetOnClosed(func() {
+		stopLocalAPI()
+		stopFolderWatcher()
+	})
 }
 
 var (
@@ -899,75 +741,37 @@ var (
 	keysLeftCaptionLabel       *widget.Label
 	encBtn, decBtn             *widget.Button
 	encHintLabel, decHintLabel *widget.Label
+	msgBtn                     *widget.Button
+	msgHintLabel               *widget.Label
 	clearLogBtn                *widget.Button
 	modeLabel                  *widget.Label
 
-	progressCard  *widget.Card
-	progressBar   *widget.ProgressBar
-	progressLabel *widget.Label
-	progressTitle string
-
-	selectedUserIdx int
-	recipientSelect *widget.Select
-	recipientCard   *widget.Card
-	keyPref         KeyPref
-	keyTypeSelect   *widget.Select
-	keyTypeCard     *widget.Card
+	selectedUserIdx    int
+	recipientSelect    *widget.Select
+	multiRecipientsBtn *widget.Button
+	recipientCard      *widget.Card
+	keyPref            KeyPref
+	keyTypeSelect      *widget.Select
+	keyTypeCard        *widget.Card
+	optionsCard        *widget.Card
+	compressCheck      *widget.Check
+	armorCheck         *widget.Check
+	volumeSelect       *widget.Select
+	volumeCaption      *widget.Label
 )
 
 func formatKeysLeft(uIdx int) string {
-	return fmt.Sprintf(tr("keys_left_inout"),
-		countRemainingSessionIn(uIdx),
-		countRemainingSessionOut(uIdx),
-	)
+	in, out := keyring.SessionKeysLeft(uIdx)
+	return fmt.Sprintf(tr("keys_left_inout"), in, out)
 }
 
 func runOnMain(f func()) { fyne.Do(f) }
 
-func uiProgressStart(title string) {
-	progressTitle = title
-	runOnMain(func() {
-		if progressLabel != nil {
-			progressLabel.SetText(title)
-		}
-		if progressBar != nil {
-			progressBar.SetValue(0)
-		}
-		if progressCard != nil {
-			progressCard.Show()
-		}
-	})
-}
-
-func uiProgressSet(f float64) {
-	runOnMain(func() {
-		if progressBar != nil {
-			progressBar.SetValue(f)
-		}
-	})
-}
-
-func uiProgressDone() {
-	runOnMain(func() {
-		if progressCard != nil {
-			progressCard.Hide()
-		}
-	})
-}
-
 func getModeLabelText() string {
 	if isCenterMode {
 		return tr("mode_center")
 	}
-	return fmt.Sprintf("%s %s", tr("mode_user"), fmt.Sprintf(tr("user_n"), int(localUserNumber+1)))
-}
-
-func SetLastKeyHashFromBytes(b []byte) {
-	lastKeyHashHex = hex.EncodeToString(b)
-}
-
-func SetLastKeyHash(hexStr string) {
-	lastKeyHashHex = hexStr
+	return fmt.Sprintf("%s %s", tr("mode_user"), fmt.Sprintf(tr("user_n"), keyring.User()+1))
 }
 
 func makeEncryptButton(win fyne.Window, logs *widget.RichText, keysLeft *widget.Label) *widget.Button {
@@ -976,11 +780,11 @@ func makeEncryptButton(win fyne.Window, logs *widget.RichText, keysLeft *widget.
 		icon = theme.ConfirmIcon()
 	}
 	btn := widget.NewButtonWithIcon(tr("encrypt"), icon, func() {
-		if rimitkeyAllZero() {
+		if keyring == nil {
 			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
 			return
 		}
-		if (len(session_keys) == 0 || (countRemainingSessionIn(localUserIndex)+countRemainingSessionOut(localUserIndex) == 0)) && noCircleKeys() {
+		if !hasEncryptionKeys() {
 			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
 			return
 		}
@@ -997,7 +801,7 @@ func makeEncryptButton(win fyne.Window, logs *widget.RichText, keysLeft *widget.
 		})
 		multiBtn := widget.NewButtonWithIcon(tr("several_files"), multiIcon, func() {
 			chooser.Hide()
-			ShowMultiEncryptWindow(win, logs, keysLeft)
+			ShowMultiEncryptWindow(win, logs, keysLeft, nil)
 		})
 
 		oneWrap := container.NewGridWrap(fyne.NewSize(220, 40), oneBtn)
@@ -1045,158 +849,138 @@ func openSingleFileEncryptFlow(win fyne.Window, logs *widget.RichText, keysLeft
 		}
 
 		uri := reader.URI()
+		encryptSingleFile(win, logs, keysLeft, reader, uri.Path(), uri.Name())
+	}, win)
 
-		go func(reader fyne.URIReadCloser, uri fyne.URI) {
-			defer reader.Close()
+	fileDialog.Resize(fyne.NewSize(700, 700))
+	fileDialog.Show()
+}
 
-			lr := &io.LimitedReader{R: reader, N: MaxPlainSize + 1}
-			data, err := io.ReadAll(lr)
-			if err != nil {
-				uiLog(logs, fmt.Sprintf(tr("read_error"), err))
-				return
-			}
-			if int64(len(data)) > MaxPlainSize || lr.N == 0 {
-				runOnMain(func() { dialog.ShowError(fmt.Errorf(tr("file_too_big")), win) })
-				return
-			}
+// encryptSingleFile queues a job that encrypts one file read from reader for the key type
+// and recipients chosen in the window at the time it is queued.
+func encryptSingleFile(win fyne.Window, logs *widget.RichText, keysLeft *widget.Label, reader io.ReadCloser, selPath, selName string) {
+	useSession, targets := keyPrefIsSession(), encryptionTargets()
+	base := selPath
+	if strings.TrimSpace(base) == "" {
+		base = baseName(selName)
+	}
+	var size int64
+	if st, err := os.Stat(selPath); err == nil {
+		size = st.Size()
+	}
 
-			targetIdx := selectedUserIdx
-			if !isCenterMode {
-				targetIdx = localUserIndex
-			}
+	runJob(fmt.Sprintf(tr("job_encrypt"), filepath.Base(base)), size, func(j *job) error {
+		defer reader.Close()
 
-			ext := strings.ToLower(filepath.Ext(uri.Path()))
-			var fileTypeCode byte
-			switch ext {
-			case ".jpg", ".jpeg", ".png", ".bmp", ".gif", ".webp", ".tiff":
-				fileTypeCode = FileTypePhoto
-			case ".txt", ".md", ".log", ".csv":
-				fileTypeCode = FileTypeText
-			case ".mp3", ".wav", ".ogg", ".m4a", ".flac":
-				fileTypeCode = FileTypeAudio
-			case ".mp4", ".mov", ".avi", ".mkv", ".wmv", ".flv", ".webm", ".m4v":
-				fileTypeCode = FileTypeVideo
-			default:
-				fileTypeCode = FileTypeGeneric
-			}
+		lr := &io.LimitedReader{R: j.reader(reader), N: qds.MaxPlainSize + 1}
+		data, err := io.ReadAll(lr)
+		if err != nil {
+			uiLog(logs, fmt.Sprintf(tr("read_error"), localizeError(err)))
+			return err
+		}
+		if int64(len(data)) > qds.MaxPlainSize || lr.N == 0 {
+			runOnMain(func() { dialog.ShowError(fmt.Errorf(tr("file_too_big")), win) })
+			return errors.New(tr("file_too_big"))
+		}
 
-			useSession := keyPrefIsSession()
-			rKey, keyTypeByte, circleNo, usedIdx, err := chooseKeyForEncryption(targetIdx, useSession)
-			if err != nil || rKey == nil {
+		out, res, err := buildContainer(logs, data, fileTypeFromPath(selPath), false, useSession, targets, j)
+		if err != nil {
+			uiLog(logs, err.Error())
+			if j.ctx.Err() == nil {
 				runOnMain(func() { dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win) })
-				return
-			}
-
-			iv := make([]byte, qalqan.BLOCKLEN)
-			if _, err := crand.Read(iv); err != nil {
-				uiLog(logs, fmt.Sprintf(tr("iv_generation_error"), err))
-				return
 			}
+			return err
+		}
+		journalSealed(logs, res, qds.JournalFile, base, viaWindow)
 
-			svc := buildServiceInfo(fileTypeCode, keyTypeByte, circleNo, usedIdx+1)
+		if res.Session {
+			runOnMain(func() { keysLeft.SetText(formatKeysLeft(res.Recipients[0])) })
+		}
+		if len(res.Recipients) > 1 {
+			uiLog(logs, fmt.Sprintf(tr("encrypted_for_recipients"), recipientsLabel(res.Recipients)))
+		}
+		saveEncryptedOutput(win, logs, out.Bytes(), suggestEncryptedNameFromPath(base), armorOutput)
+		return nil
+	})
+}
 
-			uiProgressStart(tr("encrypting"))
+func hasEncryptionKeys() bool {
+	in, out := keyring.SessionKeysLeft(localUserIndex)
+	return in+out > 0 || keyring.CircleKeysLeft() > 0
+}
 
-			selPath := uri.Path()
-			selName := uri.Name()
+func saveEncryptedOutput(win fyne.Window, logs *widget.RichText, data []byte, suggested string, armored bool) {
+	ext := ".bin"
+	if armored {
+		data = qds.Armor(data)
+		ext = qds.ArmorExt
+		suggested = strings.TrimSuffix(suggested, ".bin") + qds.ArmorExt
+	}
 
-			ctBuf := &bytes.Buffer{}
-			pr := &progressReader{
-				r:     bytes.NewReader(data),
-				total: int64(len(data)),
-				emit:  func(f float64) { runOnMain(func() { uiProgressSet(f) }) },
+	runOnMain(func() {
+		saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				addLog(logs, fmt.Sprintf(tr("save_error"), err))
+				return
 			}
-			qalqan.EncryptOFB_File(len(data), rKey, iv, pr, ctBuf)
-
-			out := &bytes.Buffer{}
-			out.Write(svc[:])
-
-			meta := make([]byte, qalqan.BLOCKLEN)
-			qalqan.Qalqan_Imit(uint64(qalqan.BLOCKLEN), rimitkey, bytes.NewReader(svc[:]), meta)
-			out.Write(meta)
-
-			out.Write(iv)
-			out.Write(ctBuf.Bytes())
-
-			fileImit := make([]byte, qalqan.BLOCKLEN)
-			qalqan.Qalqan_Imit(uint64(out.Len()), rimitkey, bytes.NewReader(out.Bytes()), fileImit)
-			out.Write(fileImit)
-
-			if useSession && usedIdx >= 0 {
-				runOnMain(func() { keysLeft.SetText(formatKeysLeft(targetIdx)) })
-				persistKeysToDiskAsync(logs)
+			if writer == nil {
+				return
 			}
-
-			runOnMain(func() {
-				saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
-					if err != nil {
-						addLog(logs, fmt.Sprintf(tr("save_error"), err))
-						return
-					}
-					if writer == nil {
-						uiProgressDone()
-						return
+			title := fmt.Sprintf(tr("job_save"), writer.URI().Name())
+			if !armored && volumeSize > 0 && int64(len(data)) > volumeSize {
+				base := writer.URI().Path()
+				writer.Close()
+				os.Remove(base)
+				runJob(title, int64(len(data)), func(j *job) error {
+					if err := j.ctx.Err(); err != nil {
+						return err
 					}
-					go func() {
-						defer writer.Close()
-						data := out.Bytes()
-						const chunk = 8 << 20 // 8MB
-						for off := 0; off < len(data); off += chunk {
-							end := off + chunk
-							if end > len(data) {
-								end = len(data)
-							}
-							if _, werr := writer.Write(data[off:end]); werr != nil {
-								runOnMain(func() {
-									addLog(logs, fmt.Sprintf(tr("write_error"), werr))
-									uiProgressDone()
-								})
-								return
-							}
-							runOnMain(func() { uiProgressSet(float64(end) / float64(len(data))) })
+					paths, err := writeVolumes(base, data, volumeSize, j.progress)
+					runOnMain(func() {
+						if err != nil {
+							addLog(logs, fmt.Sprintf(tr("write_error"), err))
+							return
 						}
-						runOnMain(func() {
-							uiProgressDone()
-							addLog(logs, tr("encrypt_saved_ok"))
-						})
-					}()
-				}, win)
-
-				base := selPath
-				if strings.TrimSpace(base) == "" {
-					base = baseName(selName)
+						addLog(logs, volumesWrittenText(paths))
+						addLog(logs, tr("encrypt_saved_ok"))
+					})
+					return err
+				})
+				return
+			}
+			runJob(title, int64(len(data)), func(j *job) error {
+				const chunk = 8 << 20 // 8MB
+				for off := 0; off < len(data); off += chunk {
+					end := off + chunk
+					if end > len(data) {
+						end = len(data)
+					}
+					werr := j.ctx.Err()
+					if werr == nil {
+						_, werr = writer.Write(data[off:end])
+					}
+					if werr != nil {
+						writer.Close()
+						storage.Delete(writer.URI())
+						uiLog(logs, fmt.Sprintf(tr("write_error"), localizeError(werr)))
+						return werr
+					}
+					j.progress(float64(end) / float64(len(data)))
 				}
-				saveDialog.Resize(fyne.NewSize(700, 700))
-				saveDialog.SetFileName(suggestEncryptedNameFromPath(base))
-				saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".bin"}))
-				saveDialog.Show()
+				if err := writer.Close(); err != nil {
+					uiLog(logs, fmt.Sprintf(tr("write_error"), err))
+					return err
+				}
+				uiLog(logs, tr("encrypt_saved_ok"))
+				return nil
 			})
-		}(reader, uri)
-	}, win)
-
-	fileDialog.Resize(fyne.NewSize(700, 700))
-	fileDialog.Show()
-}
-
-func rimitkeyAllZero() bool {
-	if len(rimitkey) == 0 {
-		return true
-	}
-	for _, b := range rimitkey {
-		if b != 0 {
-			return false
-		}
-	}
-	return true
-}
+		}, win)
 
-func noCircleKeys() bool {
-	for i := 0; i < len(circle_keys); i++ {
-		if !circleKeyAllZero(&circle_keys[i]) {
-			return false
-		}
-	}
-	return true
+		saveDialog.Resize(fyne.NewSize(700, 700))
+		saveDialog.SetFileName(suggested)
+		saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{ext}))
+		saveDialog.Show()
+	})
 }
 
 func makeDecryptButton(win fyne.Window, logs *widget.RichText) *widget.Button {
@@ -1204,12 +988,7 @@ func makeDecryptButton(win fyne.Window, logs *widget.RichText) *widget.Button {
 	if err != nil {
 		icon = theme.CancelIcon()
 	}
-	btn := widget.NewButtonWithIcon(tr("decrypt"), icon, func() {
-		if len(session_keys) == 0 && noCircleKeys() {
-			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
-			return
-		}
-
+	openFile := func() {
 		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
 			if err != nil {
 				addLog(logs, fmt.Sprintf(tr("open_error"), err))
@@ -1222,229 +1001,225 @@ func makeDecryptButton(win fyne.Window, logs *widget.RichText) *widget.Button {
 
 			uri := reader.URI()
 
-			lr := &io.LimitedReader{R: reader, N: MaxEncryptedSize + 1}
-			data, err := io.ReadAll(lr)
-			if err != nil {
-				uiLog(logs, fmt.Sprintf(tr("read_error"), err))
-				return
-			}
-			if int64(len(data)) > MaxEncryptedSize || lr.N == 0 {
-				dialog.ShowError(fmt.Errorf(tr("file_too_big")), win)
-				return
-			}
-			if len(data) < 3*qalqan.BLOCKLEN {
-				uiLog(logs, tr("file_too_short"))
+			if isVolumeFile(uri.Path()) {
+				decryptVolumeSet(win, logs, uri.Path())
 				return
 			}
+			decryptContainerReader(win, logs, reader, uri.Path())
+		}, win)
 
-			calc := make([]byte, qalqan.BLOCKLEN)
-			qalqan.Qalqan_Imit(uint64(len(data)-qalqan.BLOCKLEN), rimitkey, bytes.NewReader(data[:len(data)-qalqan.BLOCKLEN]), calc)
-			rimit := data[len(data)-qalqan.BLOCKLEN:]
-			if subtle.ConstantTimeCompare(calc, rimit) != 1 {
-				uiLog(logs, tr("file_corrupted"))
-				return
-			}
+		fileDialog.Resize(fyne.NewSize(700, 700))
+		fileDialog.SetFilter(containerFileFilter{})
+		fileDialog.Show()
+	}
 
-			serviceinfo := data[:qalqan.BLOCKLEN]
-			storedMetaImit := data[qalqan.BLOCKLEN : 2*qalqan.BLOCKLEN]
-			comp := make([]byte, qalqan.BLOCKLEN)
-			qalqan.Qalqan_Imit(uint64(qalqan.BLOCKLEN), rimitkey, bytes.NewReader(serviceinfo), comp)
-			if subtle.ConstantTimeCompare(comp, storedMetaImit) != 1 {
-				uiLog(logs, tr("file_info_imit_mismatch"))
-				return
-			}
+	btn := widget.NewButtonWithIcon(tr("decrypt"), icon, func() {
+		if keyring == nil {
+			dialog.ShowError(fmt.Errorf(tr("need_keys_first")), win)
+			return
+		}
 
-			pos := 2 * qalqan.BLOCKLEN
-			userNumber := serviceinfo[1]
-			fileType := serviceinfo[4]
-			keyType := serviceinfo[5]
-			circleKeyNumber := int(serviceinfo[6])
-			sessionIndex := decodeSessionIndex(serviceinfo)
+		var chooser *dialog.CustomDialog
+		sub := widget.NewLabelWithStyle(tr("decrypt_choose_source"), fyne.TextAlignCenter, fyne.TextStyle{})
 
-			if len(data) < pos+qalqan.BLOCKLEN {
-				uiLog(logs, tr("invalid_file_no_iv"))
-				return
-			}
-			iv := data[pos : pos+qalqan.BLOCKLEN]
-			pos += qalqan.BLOCKLEN
-			end := len(data) - qalqan.BLOCKLEN
-			if end < pos {
-				uiLog(logs, tr("invalid_file_not_enough_data"))
-				return
-			}
-			ct := data[pos:end]
+		fileBtn := widget.NewButtonWithIcon(tr("from_file"), iconFrom("assets/onefile.png", theme.FileIcon()), func() {
+			chooser.Hide()
+			openFile()
+		})
+		pasteBtn := widget.NewButtonWithIcon(tr("from_text"), theme.ContentPasteIcon(), func() {
+			chooser.Hide()
+			showPasteDecryptDialog(win, logs)
+		})
 
-			if len(ct)%qalqan.BLOCKLEN != 0 {
-				uiLog(logs, tr("invalid_file_not_enough_data"))
-				return
-			}
+		buttonsRow := container.NewHBox(
+			layout.NewSpacer(),
+			container.NewGridWrap(fyne.NewSize(220, 40), fileBtn),
+			widget.NewLabel(" "),
+			container.NewGridWrap(fyne.NewSize(220, 40), pasteBtn),
+			layout.NewSpacer(),
+		)
 
-			var rKey []byte
-			var uidx int
+		bg := canvas.NewImageFromFile("assets/background.png")
+		bg.FillMode = canvas.ImageFillStretch
 
-			if isCenterMode {
-				if userNumber == 0x33 {
-					uiLog(logs, tr("center_file_decrypt_on_recipient"))
-					return
-				}
-				uidx = int(userNumber)
-				if uidx < 0 || uidx >= len(session_keys) {
-					uiLog(logs, fmt.Sprintf(tr("unknown_sender"), userNumber))
-					return
-				}
-			} else {
-				uidx = localUserIndex
-			}
+		inner := container.NewVBox(
+			widget.NewLabel(" "),
+			sub,
+			widget.NewLabel(" "),
+			buttonsRow,
+			widget.NewLabel(" "),
+		)
 
-			if keyType == 0x00 {
-				rKey = useCircleKey(circleKeyNumber)
-			} else {
-				if sessionIndex < 0 || sessionIndex >= len(session_keys[uidx].In) {
-					uiLog(logs, tr("invalid_session_index"))
-					return
-				}
-				rKey, _ = useAndDeleteSessionIn(uidx, sessionIndex)
-			}
+		chooser = dialog.NewCustom(tr("decrypt"), tr("close"), container.NewStack(bg, container.NewPadded(inner)), win)
+		chooser.Resize(fyne.NewSize(520, 240))
+		chooser.Show()
+	})
 
-			if rKey == nil {
-				uiLog(logs, tr("decryption_key_not_available"))
-				return
-			}
+	return btn
+}
 
-			if keyType == 0x01 {
-				if keysLeftLabel != nil {
-					runOnMain(func() { keysLeftLabel.SetText(formatKeysLeft(uidx)) })
-				}
-				if isCenterMode && recipientSelect != nil {
-					runOnMain(func() {
-						selectedUserIdx = uidx
-						recipientSelect.SetSelected(strconv.Itoa(uidx + 1))
-					})
-				}
-				persistKeysToDiskAsync(logs)
-			}
+// refreshKeysLeft shows the keys left for the recipient selected in the window.
+func refreshKeysLeft() {
+	if keysLeftLabel == nil {
+		return
+	}
+	idx := selectedUserIdx
+	if !isCenterMode {
+		idx = localUserIndex
+	}
+	runOnMain(func() { keysLeftLabel.SetText(formatKeysLeft(idx)) })
+}
 
-			if isMultiArchiveFlag(serviceinfo) {
-				folderDlg := dialog.NewFolderOpen(func(list fyne.ListableURI, err error) {
-					if err != nil || list == nil {
-						return
-					}
-					dest := list.Path()
-					if strings.TrimSpace(dest) == "" {
-						return
-					}
+func noteSessionKeyUsed(uidx int) {
+	if keysLeftLabel != nil {
+		runOnMain(func() { keysLeftLabel.SetText(formatKeysLeft(uidx)) })
+	}
+	if isCenterMode && recipientSelect != nil {
+		runOnMain(func() {
+			selectedUserIdx = uidx
+			recipientSelect.SetSelected(userOption(uidx))
+		})
+	}
+}
 
-					go func(dest string, ct, iv, rKey []byte) {
-						runOnMain(func() { uiProgressStart(tr("decrypting")) })
+func decryptContainerReader(win fyne.Window, logs *widget.RichText, r io.Reader, srcPath string) {
+	lr := &io.LimitedReader{R: r, N: qds.MaxArmoredSize + 1}
+	data, err := io.ReadAll(lr)
+	if err != nil {
+		uiLog(logs, fmt.Sprintf(tr("read_error"), err))
+		return
+	}
+	if int64(len(data)) > qds.MaxArmoredSize || lr.N == 0 {
+		runOnMain(func() { dialog.ShowError(fmt.Errorf(tr("file_too_big")), win) })
+		return
+	}
+	decryptContainerData(win, logs, data, srcPath)
+}
 
-						pr := &progressReader{
-							r:     bytes.NewReader(ct),
-							total: int64(len(ct)),
-							emit:  func(f float64) { runOnMain(func() { uiProgressSet(f) }) },
-						}
+func decryptVolumeSet(win fyne.Window, logs *widget.RichText, path string) {
+	vr, err := openVolumeSet(path)
+	if err != nil {
+		uiLog(logs, err.Error())
+		return
+	}
+	defer vr.Close()
 
-						rp, wp := io.Pipe()
-						done := make(chan error, 1)
+	lr := &io.LimitedReader{R: vr, N: qds.MaxEncryptedSize + 1}
+	data, err := io.ReadAll(lr)
+	if err != nil {
+		uiLog(logs, err.Error())
+		return
+	}
+	if int64(len(data)) > qds.MaxEncryptedSize || lr.N == 0 {
+		dialog.ShowError(fmt.Errorf(tr("file_too_big")), win)
+		return
+	}
+	uiLog(logs, fmt.Sprintf(tr("volumes_joined"), len(vr.paths)))
+	decryptContainerData(win, logs, data, volumeBaseName(path))
+}
 
-						go func() {
-							done <- unpackQpkg(rp, dest)
-						}()
+func decryptContainerData(win fyne.Window, logs *widget.RichText, data []byte, srcPath string) {
+	p, err := openContainer(data)
+	if err != nil {
+		uiLog(logs, err.Error())
+		return
+	}
+	c := p.Container()
+	journalOpened(logs, c, srcPath, viaWindow)
+	if isCenterMode {
+		uiLog(logs, fmt.Sprintf(tr("received_from"), userLabel(c.User)))
+	}
+	if c.KeyType != qds.KeyTypeCircle {
+		noteSessionKeyUsed(c.User)
+	}
 
-						if err := qalqan.DecryptOFB_File(len(ct), rKey, iv, pr, wp); err != nil {
-							wp.Close()
-							uiLog(logs, fmt.Sprintf(tr("decrypt_error"), err))
-							return
-						}
-						wp.Close()
+	if c.Message() {
+		text, err := readMessagePayload(p)
+		releasePayload(p)
+		if err != nil {
+			uiLog(logs, err.Error())
+			return
+		}
+		runOnMain(func() {
+			showMessageText(win, logs, text)
+			addLog(logs, tr("message_decrypted"))
+		})
+		return
+	}
 
-						if err := <-done; err != nil {
-							uiLog(logs, fmt.Sprintf("unpack error: %v", err))
-							runOnMain(func() { uiProgressDone() })
-							return
-						}
+	if c.Archive() {
+		browseArchive(win, logs, p, srcPath)
+		return
+	}
 
-						runOnMain(func() {
-							uiProgressDone()
-							addLog(logs, tr("decrypt_saved_ok"))
-						})
-					}(
-						dest,
-						append([]byte(nil), ct...),
-						append([]byte(nil), iv...),
-						append([]byte(nil), rKey...),
-					)
-				}, win)
-
-				folderDlg.Resize(fyne.NewSize(700, 700))
-				folderDlg.Show()
+	runOnMain(func() {
+		saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				releasePayload(p)
+				addLog(logs, fmt.Sprintf(tr("save_error"), err))
 				return
 			}
+			if writer == nil {
+				releasePayload(p)
+				return
+			}
+			runJob(fmt.Sprintf(tr("job_decrypt"), writer.URI().Name()), int64(c.PayloadSize()), func(j *job) error {
+				defer releasePayload(p)
+				defer writer.Close()
 
-			runOnMain(func() {
-				saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
-					if err != nil {
-						addLog(logs, fmt.Sprintf(tr("save_error"), err))
-						return
-					}
-					if writer == nil {
-						uiProgressDone()
-						return
-					}
-					go func() {
-						defer writer.Close()
-
-						uiProgressStart(tr("decrypting"))
-
-						pr := &progressReader{
-							r:     bytes.NewReader(ct),
-							total: int64(len(ct)),
-							emit:  func(f float64) { runOnMain(func() { uiProgressSet(f) }) },
-						}
-						if err := qalqan.DecryptOFB_File(len(ct), rKey, iv, pr, writer); err != nil {
-							runOnMain(func() {
-								uiProgressDone()
-								addLog(logs, fmt.Sprintf(tr("decrypt_error"), err))
-							})
-							return
-						}
-
-						runOnMain(func() {
-							uiProgressDone()
-							addLog(logs, tr("decrypt_saved_ok"))
-						})
-					}()
-				}, win)
-
-				safeName := sanitizeFileName(suggestDecryptedNameFromPath(uri.Path(), fileType))
+				src := p.Open(j.progress)
+				defer src.Close()
 
-				saveDialog.Resize(fyne.NewSize(700, 700))
-				saveDialog.SetFileName(safeName)
-				saveDialog.SetFilter(nil)
-				saveDialog.Show()
+				n, err := io.Copy(writer, j.reader(src))
+				if err != nil {
+					uiLog(logs, fmt.Sprintf(tr("decrypt_error"), localizeError(err)))
+					return err
+				}
+				if c.Compressed() {
+					uiLog(logs, compressionRatioText(n, int64(c.PayloadSize())))
+				}
+				uiLog(logs, tr("decrypt_saved_ok"))
+				return nil
 			})
 		}, win)
 
-		fileDialog.Resize(fyne.NewSize(700, 700))
-		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".bin"}))
-		fileDialog.Show()
-	})
+		safeName := qds.SanitizeFileName(suggestDecryptedNameFromPath(srcPath, c.FileType))
 
-	return btn
+		saveDialog.Resize(fyne.NewSize(700, 700))
+		saveDialog.SetFileName(safeName)
+		saveDialog.SetFilter(nil)
+		saveDialog.Show()
+	})
 }
 
-func UI_OnKeysLoaded(
-	kikey []byte,
-	sess []qalqan.SessionKeySet,
-	circ [][qalqan.DEFAULT_KEY_LEN]byte,
-	imitKey []byte,
-	passwordHash32 [32]byte,
-) {
-	session_keys = sess
-	circle_keys = circ
-	if len(imitKey) == qalqan.EXPKLEN {
-		rimitkey = make([]byte, qalqan.EXPKLEN)
-		copy(rimitkey, imitKey)
+func showPasteDecryptDialog(win fyne.Window, logs *widget.RichText) {
+	entry := widget.NewMultiLineEntry()
+	entry.SetPlaceHolder(qds.ArmorHeader + "\n…\n" + qds.ArmorFooter)
+	entry.Wrapping = fyne.TextWrapBreak
+	if clip := win.Clipboard().Content(); qds.IsArmored([]byte(clip)) {
+		entry.SetText(clip)
 	}
-	nextOutIdx = make([]int, len(session_keys))
-	nextCircleIdx = 0
+
+	pasteBtn := widget.NewButtonWithIcon(tr("paste_from_clipboard"), theme.ContentPasteIcon(), func() {
+		entry.SetText(win.Clipboard().Content())
+	})
+
+	scroll := container.NewVScroll(entry)
+	scroll.SetMinSize(fyne.NewSize(620, 320))
+
+	content := container.NewBorder(container.NewHBox(layout.NewSpacer(), pasteBtn), nil, nil, nil, scroll)
+
+	d := dialog.NewCustomConfirm(tr("decrypt"), tr("decrypt"), tr("cancel"), content, func(ok bool) {
+		if !ok {
+			return
+		}
+		text := entry.Text
+		if !qds.IsArmored([]byte(text)) {
+			addLog(logs, tr("armor_not_found"))
+			return
+		}
+		decryptContainerData(win, logs, []byte(text), "")
+	}, win)
+	d.Resize(fyne.NewSize(680, 460))
+	d.Show()
 }
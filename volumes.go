@@ -0,0 +1,327 @@
+package main
+
+import (
+	"QalqanDS/qalqan"
+	"QalqanDS/qds"
+	"bytes"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"fyne.io/fyne/v2"
+)
+
+/*
+	volume file name.bin.001, name.bin.002, …:
+
+header [64]:
+
+	[0..3]   = 'Q','V','O','L'
+	[4]      = volume format version
+	[5..7]   = 0
+	[8..15]  = volume set id (random, the same in every volume of the set)
+	[16..17] = volume number, 1-based (BE16)
+	[18..19] = volumes count (BE16)
+	[20..27] = whole container size (BE64)
+	[28..31] = 0
+	[32..63] = SHA-256 of this volume's payload
+
+payload = next part of the container; the parts concatenated in order give the container back.
+*/
+const (
+	volumeMagic     = "QVOL"
+	volumeVersion   = 1
+	volumeHeaderLen = 4 * qalqan.BLOCKLEN
+	maxVolumes      = 999
+)
+
+var volumeExtRe = regexp.MustCompile(`\.(\d{3})$`)
+
+// volumeSize is the size limit of one volume file, header included; 0 = do not split.
+var volumeSize int64
+
+var volumeSizePresets = []int64{0, 25 << 20, 100 << 20, 700 << 20, 4<<30 - 1}
+
+func volumeSizeOptions() []string {
+	opts := make([]string, len(volumeSizePresets))
+	for i, v := range volumeSizePresets {
+		opts[i] = volumeSizeLabel(v)
+	}
+	return opts
+}
+
+func volumeSizeLabel(v int64) string {
+	switch {
+	case v == 0:
+		return tr("volumes_off")
+	case v >= 4<<30-1:
+		return "4 Gb"
+	}
+	return fmt.Sprintf("%d Mb", v>>20)
+}
+
+func labelToVolumeSize(s string) int64 {
+	for _, v := range volumeSizePresets {
+		if volumeSizeLabel(v) == s {
+			return v
+		}
+	}
+	return 0
+}
+
+type volumeHeader struct {
+	SetID [8]byte
+	Index int
+	Count int
+	Total int64
+	Sum   [sha256.Size]byte
+}
+
+func (h *volumeHeader) encode() []byte {
+	b := make([]byte, volumeHeaderLen)
+	copy(b[0:4], volumeMagic)
+	b[4] = volumeVersion
+	copy(b[8:16], h.SetID[:])
+	binary.BigEndian.PutUint16(b[16:18], uint16(h.Index))
+	binary.BigEndian.PutUint16(b[18:20], uint16(h.Count))
+	binary.BigEndian.PutUint64(b[20:28], uint64(h.Total))
+	copy(b[32:64], h.Sum[:])
+	return b
+}
+
+func parseVolumeHeader(b []byte) (*volumeHeader, error) {
+	if len(b) < volumeHeaderLen || string(b[0:4]) != volumeMagic {
+		return nil, fmt.Errorf("not a volume")
+	}
+	if b[4] != volumeVersion {
+		return nil, fmt.Errorf("unsupported volume version %d", b[4])
+	}
+	h := &volumeHeader{
+		Index: int(binary.BigEndian.Uint16(b[16:18])),
+		Count: int(binary.BigEndian.Uint16(b[18:20])),
+		Total: int64(binary.BigEndian.Uint64(b[20:28])),
+	}
+	copy(h.SetID[:], b[8:16])
+	copy(h.Sum[:], b[32:64])
+	if h.Count < 1 || h.Count > maxVolumes || h.Index < 1 || h.Index > h.Count || h.Total <= 0 {
+		return nil, fmt.Errorf("bad volume header")
+	}
+	return h, nil
+}
+
+func isVolumeFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	return string(head) == volumeMagic
+}
+
+// volumeBaseName strips the .NNN suffix: "a.bin.002" -> "a.bin".
+func volumeBaseName(path string) string {
+	return volumeExtRe.ReplaceAllString(path, "")
+}
+
+func volumePath(base string, n int) string {
+	return fmt.Sprintf("%s.%03d", base, n)
+}
+
+// writeVolumes splits data into volumes of at most size bytes next to base and returns their paths.
+func writeVolumes(base string, data []byte, size int64, progress func(float64)) ([]string, error) {
+	part := size - volumeHeaderLen
+	if part <= 0 {
+		return nil, fmt.Errorf("volume size too small")
+	}
+	count := int((int64(len(data)) + part - 1) / part)
+	if count > maxVolumes {
+		return nil, fmt.Errorf("too many volumes: %d", count)
+	}
+
+	h := volumeHeader{Count: count, Total: int64(len(data))}
+	if _, err := crand.Read(h.SetID[:]); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		off := int64(i) * part
+		end := off + part
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		chunk := data[off:end]
+
+		h.Index = i + 1
+		h.Sum = sha256.Sum256(chunk)
+
+		p := volumePath(base, i+1)
+		f, err := os.Create(p)
+		if err != nil {
+			return paths, err
+		}
+		if _, err := f.Write(h.encode()); err == nil {
+			_, err = f.Write(chunk)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, p)
+		if progress != nil {
+			progress(float64(end) / float64(len(data)))
+		}
+	}
+	return paths, nil
+}
+
+// findVolumeSet returns the paths of all volumes of the set that path belongs to, in order.
+func findVolumeSet(path string) ([]string, *volumeHeader, error) {
+	first, err := readVolumeHeaderFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	base := volumeBaseName(path)
+	paths := make([]string, first.Count)
+	for n := 1; n <= first.Count; n++ {
+		p := volumePath(base, n)
+		h, err := readVolumeHeaderFile(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf(tr("volume_missing"), filepath.Base(p))
+		}
+		if h.SetID != first.SetID || h.Index != n || h.Count != first.Count || h.Total != first.Total {
+			return nil, nil, fmt.Errorf(tr("volume_foreign"), filepath.Base(p))
+		}
+		paths[n-1] = p
+	}
+	return paths, first, nil
+}
+
+func readVolumeHeaderFile(path string) (*volumeHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := make([]byte, volumeHeaderLen)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, err
+	}
+	return parseVolumeHeader(b)
+}
+
+// volumeReader streams the payloads of a volume set and checks every volume's
+// SHA-256 when its end is reached, so a damaged volume fails with its own name.
+type volumeReader struct {
+	paths []string
+	set   *volumeHeader
+	cur   int
+	f     *os.File
+	r     io.Reader
+	h     hash.Hash
+	want  [sha256.Size]byte
+	read  int64
+}
+
+func openVolumeSet(path string) (*volumeReader, error) {
+	paths, set, err := findVolumeSet(path)
+	if err != nil {
+		return nil, err
+	}
+	return &volumeReader{paths: paths, set: set, cur: -1}, nil
+}
+
+func (v *volumeReader) next() error {
+	if v.f != nil {
+		v.f.Close()
+		v.f = nil
+	}
+	v.cur++
+	if v.cur >= len(v.paths) {
+		return io.EOF
+	}
+	f, err := os.Open(v.paths[v.cur])
+	if err != nil {
+		return err
+	}
+	b := make([]byte, volumeHeaderLen)
+	if _, err := io.ReadFull(f, b); err != nil {
+		f.Close()
+		return err
+	}
+	h, err := parseVolumeHeader(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	v.f = f
+	v.h = sha256.New()
+	v.want = h.Sum
+	v.r = io.TeeReader(f, v.h)
+	return nil
+}
+
+func (v *volumeReader) Read(p []byte) (int, error) {
+	for {
+		if v.f == nil {
+			if err := v.next(); err != nil {
+				if err == io.EOF && v.read != v.set.Total {
+					return 0, fmt.Errorf(tr("volume_size_mismatch"))
+				}
+				return 0, err
+			}
+		}
+		n, err := v.r.Read(p)
+		v.read += int64(n)
+		if err == io.EOF {
+			if !bytes.Equal(v.h.Sum(nil), v.want[:]) {
+				return n, fmt.Errorf(tr("volume_damaged"), filepath.Base(v.paths[v.cur]))
+			}
+			v.f.Close()
+			v.f = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (v *volumeReader) Close() error {
+	if v.f != nil {
+		return v.f.Close()
+	}
+	return nil
+}
+
+type containerFileFilter struct{}
+
+func (containerFileFilter) Matches(u fyne.URI) bool {
+	ext := strings.ToLower(u.Extension())
+	switch ext {
+	case ".bin", qds.ArmorExt, ".txt":
+		return true
+	}
+	if volumeExtRe.MatchString(ext) {
+		return strings.EqualFold(filepath.Ext(strings.TrimSuffix(u.Name(), ext)), ".bin")
+	}
+	return false
+}
+
+func volumesWrittenText(paths []string) string {
+	return fmt.Sprintf(tr("volumes_written"), len(paths), filepath.Base(paths[0]), filepath.Base(paths[len(paths)-1]))
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"QalqanDS/qds"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch folders: every file put into outbox/<recipient>/ is encrypted with the next
+// session-out key into outbox/<recipient>/encrypted/, every container put into the
+// inbox is decrypted into the plaintext folder. A file is moved to working/ while it is
+// handled, so it is never taken twice; originals then go to processed/ next to them, files
+// that fail go to quarantine/ with the reason in a .error file.
+const (
+	watchEncryptedDir  = "encrypted"
+	watchWorkingDir    = "working"
+	watchProcessedDir  = "processed"
+	watchQuarantineDir = "quarantine"
+
+	// a file is taken once it has not been written to for this long
+	watchSettle = 2 * time.Second
+)
+
+var activeWatcher *folderWatcher
+
+type folderWatcher struct {
+	outbox, inbox, plainDir string
+	logs                    *widget.RichText
+
+	w       *fsnotify.Watcher
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+	waiting map[string]bool // put back for lack of keys; taken again by the watcher of the next sign-in
+	jobs    chan string
+	stop    chan struct{}
+	done    sync.WaitGroup
+}
+
+// outboxFolderName is the subfolder of the outbox for user index u, or for the center with a user key file.
+func outboxFolderName(u int) string {
+	if !isCenterMode {
+		return "center"
+	}
+	return fmt.Sprintf("user%d", u+1)
+}
+
+// outboxRecipient finds the user index of an outbox subfolder.
+func outboxRecipient(dir string) (int, bool) {
+	name := strings.ToLower(filepath.Base(dir))
+	if !isCenterMode {
+		return localUserIndex, name == "center"
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(name, "user"))
+	if err != nil || n < 1 || n > keyring.Users() {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+func watchSkipName(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") ||
+		strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".crdownload")
+}
+
+func isContainerName(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".bin" || ext == qds.ArmorExt
+}
+
+func startFolderWatcher(outbox, inbox, plainDir string, logs *widget.RichText) (*folderWatcher, error) {
+	if outbox == "" && inbox == "" {
+		return nil, errors.New(tr("watch_no_folders"))
+	}
+	if inbox != "" && plainDir == "" {
+		return nil, errors.New(tr("watch_no_plain_folder"))
+	}
+	if inbox != "" && (samePath(inbox, plainDir) || outbox != "" && samePath(inbox, outbox)) ||
+		outbox != "" && plainDir != "" && samePath(outbox, plainDir) {
+		return nil, errors.New(tr("watch_same_folders"))
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	fw := &folderWatcher{
+		outbox:   outbox,
+		inbox:    inbox,
+		plainDir: plainDir,
+		logs:     logs,
+		w:        w,
+		pending:  map[string]*time.Timer{},
+		waiting:  map[string]bool{},
+		jobs:     make(chan string, 64),
+		stop:     make(chan struct{}),
+	}
+
+	var dirs []string
+	if outbox != "" {
+		users := 1
+		if isCenterMode {
+			users = keyring.Users()
+		}
+		for u := 0; u < users; u++ {
+			dirs = append(dirs, filepath.Join(outbox, outboxFolderName(u)))
+		}
+	}
+	if inbox != "" {
+		dirs = append(dirs, inbox)
+		if err := os.MkdirAll(plainDir, 0o755); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	for _, d := range dirs {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			w.Close()
+			return nil, err
+		}
+		if err := w.Add(d); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("%s: %w", d, err)
+		}
+	}
+
+	fw.done.Add(2)
+	go fw.watch()
+	go fw.work()
+
+	// files left from the last run; the ones it was handling may have their output already
+	for _, d := range dirs {
+		left, _ := os.ReadDir(filepath.Join(d, watchWorkingDir))
+		for _, it := range left {
+			if !it.IsDir() {
+				fw.quarantine(filepath.Join(d, watchWorkingDir, it.Name()), d, errors.New(tr("watch_interrupted")))
+			}
+		}
+		items, _ := os.ReadDir(d)
+		for _, it := range items {
+			if !it.IsDir() {
+				fw.schedule(filepath.Join(d, it.Name()))
+			}
+		}
+	}
+	return fw, nil
+}
+
+func (fw *folderWatcher) Stop() {
+	close(fw.stop)
+	fw.w.Close()
+	fw.mu.Lock()
+	for p, t := range fw.pending {
+		t.Stop()
+		delete(fw.pending, p)
+	}
+	fw.mu.Unlock()
+	fw.done.Wait()
+}
+
+func (fw *folderWatcher) watch() {
+	defer fw.done.Done()
+	for {
+		select {
+		case ev, ok := <-fw.w.Events:
+			if !ok {
+				return
+			}
+			if ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write) {
+				fw.schedule(ev.Name)
+			}
+		case err, ok := <-fw.w.Errors:
+			if !ok {
+				return
+			}
+			uiLog(fw.logs, fmt.Sprintf(tr("watch_error"), err))
+		}
+	}
+}
+
+// schedule (re)starts the settle timer of path; every write pushes it further.
+func (fw *folderWatcher) schedule(path string) {
+	if watchSkipName(filepath.Base(path)) {
+		return
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.waiting[path] {
+		return
+	}
+	if t, ok := fw.pending[path]; ok {
+		t.Reset(watchSettle)
+		return
+	}
+	fw.pending[path] = time.AfterFunc(watchSettle, func() {
+		fw.mu.Lock()
+		delete(fw.pending, path)
+		fw.mu.Unlock()
+		select {
+		case fw.jobs <- path:
+		case <-fw.stop:
+		}
+	})
+}
+
+// work handles one file at a time, so the keys are used in the order the files settled.
+func (fw *folderWatcher) work() {
+	defer fw.done.Done()
+	for {
+		select {
+		case p := <-fw.jobs:
+			fw.process(p)
+		case <-fw.stop:
+			return
+		}
+	}
+}
+
+func (fw *folderWatcher) process(path string) {
+	st, err := os.Stat(path)
+	if err != nil || !st.Mode().IsRegular() {
+		return
+	}
+	dir := filepath.Dir(path)
+	name := filepath.Base(path)
+
+	decrypt := fw.inbox != "" && samePath(dir, fw.inbox)
+	uidx, encrypt := outboxRecipient(dir)
+	encrypt = encrypt && fw.outbox != "" && samePath(filepath.Dir(dir), fw.outbox)
+	if decrypt && !isContainerName(name) || !decrypt && !encrypt {
+		return
+	}
+
+	work, err := moveTo(path, filepath.Join(dir, watchWorkingDir))
+	if err != nil {
+		uiLog(fw.logs, fmt.Sprintf(tr("watch_error"), err))
+		return
+	}
+	if decrypt {
+		err = fw.decrypt(work, path)
+	} else {
+		err = fw.encrypt(work, path, uidx)
+	}
+
+	if errors.Is(err, qds.ErrNoKeys) {
+		// the file waits in place for new keys, which come with a new sign-in and watcher
+		uiLog(fw.logs, fmt.Sprintf(tr("watch_failed"), name, err))
+		back := qds.UniquePath(path)
+		fw.mu.Lock()
+		fw.waiting[back] = true
+		fw.mu.Unlock()
+		if err := os.Rename(work, back); err != nil {
+			uiLog(fw.logs, fmt.Sprintf(tr("watch_error"), err))
+		}
+		return
+	}
+	if err != nil {
+		uiLog(fw.logs, fmt.Sprintf(tr("watch_failed"), name, err))
+		fw.quarantine(work, dir, err)
+		return
+	}
+	if _, err := moveTo(work, filepath.Join(dir, watchProcessedDir)); err != nil {
+		uiLog(fw.logs, fmt.Sprintf(tr("watch_error"), err))
+	}
+}
+
+// quarantine moves path into the quarantine folder of dir with the reason next to it.
+func (fw *folderWatcher) quarantine(path, dir string, reason error) {
+	q, err := moveTo(path, filepath.Join(dir, watchQuarantineDir))
+	if err != nil {
+		uiLog(fw.logs, fmt.Sprintf(tr("watch_error"), err))
+		return
+	}
+	os.WriteFile(q+".error", []byte(reason.Error()+"\n"), 0o644)
+	uiLog(fw.logs, fmt.Sprintf(tr("watch_quarantined"), q))
+}
+
+// encrypt encrypts work, the file put into the outbox at path, for user uidx.
+func (fw *folderWatcher) encrypt(work, path string, uidx int) error {
+	data, err := readLimitedFile(work, qds.MaxPlainSize)
+	if err != nil {
+		return err
+	}
+	out, res, err := buildContainer(fw.logs, data, fileTypeFromPath(path), false, true, []int{uidx}, nil)
+	if err != nil {
+		return err
+	}
+	journalSealed(fw.logs, res, qds.JournalFile, path, viaWatch)
+	refreshKeysLeft()
+
+	enc := out.Bytes()
+	target := suggestEncryptedNameFromPath(path)
+	if armorOutput {
+		enc = qds.Armor(enc)
+		target = strings.TrimSuffix(target, ".bin") + qds.ArmorExt
+	}
+	dir := filepath.Join(filepath.Dir(path), watchEncryptedDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	target = qds.UniquePath(filepath.Join(dir, target))
+	if err := os.WriteFile(target, enc, 0o644); err != nil {
+		os.Remove(target)
+		return fmt.Errorf(tr("write_error"), err)
+	}
+	uiLog(fw.logs, fmt.Sprintf(tr("watch_encrypted"), filepath.Base(path), outboxFolderName(uidx), target))
+	return nil
+}
+
+// decrypt decrypts work, the container put into the inbox at path.
+func (fw *folderWatcher) decrypt(work, path string) error {
+	data, err := readLimitedFile(work, qds.MaxArmoredSize)
+	if err != nil {
+		return err
+	}
+	p, err := openContainer(data)
+	if err != nil {
+		return err
+	}
+	defer releasePayload(p)
+	c := p.Container()
+	journalOpened(fw.logs, c, path, viaWatch)
+	if isCenterMode {
+		uiLog(fw.logs, fmt.Sprintf(tr("received_from"), userLabel(c.User)))
+	}
+	if c.KeyType != qds.KeyTypeCircle {
+		refreshKeysLeft()
+	}
+
+	if c.Message() {
+		text, err := readMessagePayload(p)
+		if err != nil {
+			return err
+		}
+		target := qds.UniquePath(filepath.Join(fw.plainDir, archiveFolderName(path)+".txt"))
+		if err := os.WriteFile(target, []byte(text), 0o644); err != nil {
+			return fmt.Errorf(tr("write_error"), err)
+		}
+		uiLog(fw.logs, fmt.Sprintf(tr("watch_decrypted"), filepath.Base(path), target))
+		return nil
+	}
+
+	src := p.Open(nil)
+	defer src.Close()
+
+	if c.Archive() {
+		dest, err := makeExtractFolder(fw.plainDir, path)
+		if err != nil {
+			return err
+		}
+		sum, err := qds.Unpack(src, dest, qds.UnpackOptions{Policy: qds.ConflictRename})
+		if err != nil {
+			return localizeError(err)
+		}
+		uiLog(fw.logs, fmt.Sprintf(tr("watch_decrypted"), filepath.Base(path), dest))
+		uiLog(fw.logs, strings.TrimRight(fmt.Sprintf(tr("summary_log"),
+			len(sum.Written), len(sum.Overwritten), len(sum.Renamed), len(sum.Skipped), len(sum.Damaged)), "\n"))
+		return nil
+	}
+
+	target := qds.UniquePath(filepath.Join(fw.plainDir, qds.SanitizeFileName(suggestDecryptedNameFromPath(path, c.FileType))))
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(target)
+		return fmt.Errorf(tr("decrypt_error"), localizeError(err))
+	}
+	uiLog(fw.logs, fmt.Sprintf(tr("watch_decrypted"), filepath.Base(path), target))
+	return nil
+}
+
+// moveTo moves path into dir and returns the new path.
+func moveTo(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	target := qds.UniquePath(filepath.Join(dir, filepath.Base(path)))
+	return target, os.Rename(path, target)
+}
+
+func stopFolderWatcher() {
+	if activeWatcher != nil {
+		activeWatcher.Stop()
+		activeWatcher = nil
+	}
+}
+
+// restoreFolderWatcher starts the watch folders again after sign-in if they were on. A watcher
+// left from the last time the main window was built is stopped first.
+func restoreFolderWatcher(logs *widget.RichText) {
+	stopFolderWatcher()
+	p := fyne.CurrentApp().Preferences()
+	if !p.BoolWithFallback("watch_enabled", false) {
+		return
+	}
+	fw, err := startFolderWatcher(p.String("watch_outbox"), p.String("watch_inbox"), p.String("watch_plain"), logs)
+	if err != nil {
+		addLog(logs, fmt.Sprintf(tr("watch_error"), err))
+		return
+	}
+	activeWatcher = fw
+	addLog(logs, tr("watch_started"))
+}
+
+func ShowWatchFoldersWindow(win fyne.Window, logs *widget.RichText) {
+	prefs := fyne.CurrentApp().Preferences()
+
+	outboxEntry := widget.NewEntry()
+	outboxEntry.SetText(prefs.String("watch_outbox"))
+	inboxEntry := widget.NewEntry()
+	inboxEntry.SetText(prefs.String("watch_inbox"))
+	plainEntry := widget.NewEntry()
+	plainEntry.SetText(prefs.String("watch_plain"))
+
+	folderRow := func(caption string, e *widget.Entry) fyne.CanvasObject {
+		browse := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
+			d := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
+				if err != nil || uri == nil {
+					return
+				}
+				e.SetText(uri.Path())
+			}, win)
+			d.Resize(fyne.NewSize(800, 650))
+			d.Show()
+		})
+		return container.NewBorder(nil, nil,
+			container.NewGridWrap(fyne.NewSize(180, 36), widget.NewLabel(caption)), browse, e)
+	}
+
+	var names []string
+	users := 1
+	if isCenterMode {
+		users = keyring.Users()
+	}
+	for u := 0; u < users && u < 3; u++ {
+		names = append(names, outboxFolderName(u))
+	}
+	if users > 3 {
+		names = append(names, "…")
+	}
+	hint := widget.NewLabel(fmt.Sprintf(tr("watch_hint"), strings.Join(names, ", ")))
+	hint.Wrapping = fyne.TextWrapWord
+	hint.TextStyle.Italic = true
+
+	statusLbl := widget.NewLabelWithStyle("", fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+	var startBtn, stopBtn *widget.Button
+	update := func() {
+		if activeWatcher != nil {
+			statusLbl.SetText(tr("watch_status_on"))
+			startBtn.Disable()
+			stopBtn.Enable()
+		} else {
+			statusLbl.SetText(tr("watch_status_off"))
+			startBtn.Enable()
+			stopBtn.Disable()
+		}
+	}
+
+	startBtn = widget.NewButtonWithIcon(tr("watch_start"), theme.MediaPlayIcon(), func() {
+		outbox := strings.TrimSpace(outboxEntry.Text)
+		inbox := strings.TrimSpace(inboxEntry.Text)
+		plain := strings.TrimSpace(plainEntry.Text)
+		fw, err := startFolderWatcher(outbox, inbox, plain, logs)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		activeWatcher = fw
+		prefs.SetString("watch_outbox", outbox)
+		prefs.SetString("watch_inbox", inbox)
+		prefs.SetString("watch_plain", plain)
+		prefs.SetBool("watch_enabled", true)
+		addLog(logs, tr("watch_started"))
+		update()
+	})
+	stopBtn = widget.NewButtonWithIcon(tr("watch_stop"), theme.MediaStopIcon(), func() {
+		stopFolderWatcher()
+		prefs.SetBool("watch_enabled", false)
+		addLog(logs, tr("watch_stopped"))
+		update()
+	})
+	update()
+
+	form := container.NewVBox(
+		folderRow(tr("watch_outbox"), outboxEntry),
+		folderRow(tr("watch_inbox"), inboxEntry),
+		folderRow(tr("watch_plain"), plainEntry),
+		hint,
+		widget.NewSeparator(),
+		statusLbl,
+		container.NewHBox(layout.NewSpacer(),
+			container.NewGridWrap(fyne.NewSize(160, 40), startBtn),
+			container.NewGridWrap(fyne.NewSize(160, 40), stopBtn),
+			layout.NewSpacer()),
+	)
+
+	bg := canvas.NewImageFromFile("assets/background.png")
+	bg.FillMode = canvas.ImageFillStretch
+	d := dialog.NewCustom(tr("watch_folders"), tr("close"), container.NewStack(bg, container.NewPadded(form)), win)
+	d.Resize(fyne.NewSize(760, 420))
+	d.Show()
+}